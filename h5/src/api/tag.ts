@@ -6,12 +6,15 @@ export interface Tag {
   name: string
   type: 'global' | 'custom'
   userId?: string
+  parentId?: string
+  group?: string
   color: string
   icon?: string
   usageCount: number
   isActive: boolean
   createdAt: string
   updatedAt: string
+  children?: Tag[]
 }
 
 // 创建标签参数
@@ -19,6 +22,8 @@ export interface CreateTagParams {
   name: string
   color?: string
   icon?: string
+  parentId?: number
+  group?: string
 }
 
 // 更新标签参数
@@ -27,12 +32,34 @@ export interface UpdateTagParams {
   color?: string
   icon?: string
   isActive?: boolean
+  parentId?: number // 传 0 移到顶层
+  group?: string
+  merge?: boolean // 新名称与已有标签重名时合并到该标签
+}
+
+// 更新标签结果
+export interface UpdateTagResult extends Tag {
+  ticketsAffected: number
+}
+
+// 合并标签结果
+export interface MergeTagResult {
+  tag: Tag
+  merged: number
+  ticketsAffected: number
 }
 
 /**
  * 获取标签列表
  */
 export function getTagList(): Promise<Tag[]> {
+  return request.get('/tags', { params: { flat: true } })
+}
+
+/**
+ * 获取标签树（全局标签在顶层，自定义标签按父子层级嵌套）
+ */
+export function getTagTree(): Promise<Tag[]> {
   return request.get('/tags')
 }
 
@@ -50,6 +77,26 @@ export function getUserTags(): Promise<Tag[]> {
   return request.get('/tags/custom')
 }
 
+// 标签推荐参数
+export interface SuggestTagParams {
+  prefix?: string
+  ticketType?: string
+  city?: string
+  limit?: number
+}
+
+// 标签推荐结果
+export interface TagSuggestion extends Tag {
+  score: number
+}
+
+/**
+ * 标签推荐/自动补全
+ */
+export function suggestTags(params: SuggestTagParams): Promise<TagSuggestion[]> {
+  return request.get('/tags/suggest', { params })
+}
+
 /**
  * 创建标签
  */
@@ -60,10 +107,17 @@ export function createTag(data: CreateTagParams): Promise<Tag> {
 /**
  * 更新标签
  */
-export function updateTag(id: string, data: UpdateTagParams): Promise<Tag> {
+export function updateTag(id: string, data: UpdateTagParams): Promise<UpdateTagResult> {
   return request.put(`/tags/${id}`, data)
 }
 
+/**
+ * 将多个自定义标签合并到目标标签
+ */
+export function mergeTags(targetId: string, sourceIds: string[]): Promise<MergeTagResult> {
+  return request.post(`/tags/${targetId}/merge`, { sourceIds: sourceIds.map(Number) })
+}
+
 /**
  * 删除标签
  */
@@ -1,6 +1,47 @@
 import request from '@/utils/request'
 import type { TicketType, PrivacyLevel, Location } from '@/types'
 
+// 票据照片
+export interface TicketPhoto {
+  id: number
+  url: string
+  thumbnail: string
+  caption?: string
+  sort: number
+  width?: number
+  height?: number
+  bytes?: number
+  variants?: PhotoVariant[]  // 服务端生成的缩略图和 WebP 版本
+  createdAt: string
+  updatedAt: string
+}
+
+// 照片近似的已有票据
+export interface DuplicateTicket {
+  ticketId: number
+  name: string
+  distance: number  // 0 表示文件相同
+}
+
+// 照片的一个尺寸版本
+export interface PhotoVariant {
+  size: number
+  crop?: boolean  // 是否居中裁剪为正方形
+  format: 'jpeg' | 'webp'
+  width: number
+  height: number
+  url: string
+}
+
+// 提交的票据照片，按数组顺序排列，第一张为封面
+export interface TicketPhotoParams {
+  url: string
+  caption?: string
+  width?: number
+  height?: number
+  bytes?: number
+}
+
 // 后端返回的原始票据数据
 interface RawTicket {
   id: number
@@ -17,6 +58,7 @@ interface RawTicket {
   price?: number
   photo?: string
   thumbnail?: string
+  photos?: TicketPhoto[]
   date?: string
   sortTime: string
   location?: string | Location  // 可能是 JSON 字符串或对象
@@ -24,6 +66,8 @@ interface RawTicket {
   privacy: PrivacyLevel
   isDeleted: boolean
   deletedAt?: string
+  daysRemaining?: number  // 回收站中距离自动删除的剩余天数
+  duplicates?: DuplicateTicket[]  // 创建时发现的照片近似的已有票据
   createdAt: string
   updatedAt: string
 }
@@ -42,8 +86,9 @@ export interface Ticket {
   showtime?: string    // 场次时间（电影票）
   tags: string[]
   price?: number
-  photo?: string
-  thumbnail?: string
+  photo?: string      // 封面
+  thumbnail?: string  // 封面缩略图
+  photos: TicketPhoto[]
   date?: string
   sortTime: string
   location?: Location
@@ -51,6 +96,8 @@ export interface Ticket {
   privacy: PrivacyLevel
   isDeleted: boolean
   deletedAt?: string
+  daysRemaining?: number  // 回收站中距离自动删除的剩余天数
+  duplicates?: DuplicateTicket[]  // 创建时发现的照片近似的已有票据
   createdAt: string
   updatedAt: string
 }
@@ -98,6 +145,7 @@ function transformTicket(raw: RawTicket): Ticket {
     price: raw.price,
     photo: raw.photo,
     thumbnail: raw.thumbnail,
+    photos: raw.photos ?? [],
     date: raw.date,
     sortTime: raw.sortTime,
     location,
@@ -105,6 +153,8 @@ function transformTicket(raw: RawTicket): Ticket {
     privacy: raw.privacy,
     isDeleted: raw.isDeleted,
     deletedAt: raw.deletedAt,
+    daysRemaining: raw.daysRemaining,
+    duplicates: raw.duplicates,
     createdAt: raw.createdAt,
     updatedAt: raw.updatedAt
   }
@@ -116,6 +166,15 @@ export interface TicketListParams {
   limit?: number
   type?: TicketType
   tag?: string
+  tags?: string
+  tagMode?: 'and' | 'or'
+  from?: string
+  to?: string
+  city?: string
+  minPrice?: number
+  maxPrice?: number
+  privacy?: PrivacyLevel
+  hasPhoto?: boolean
   isDeleted?: boolean
 }
 
@@ -139,6 +198,7 @@ export interface CreateTicketParams {
   tags?: string[]
   price?: number
   photo?: string
+  photos?: TicketPhotoParams[]
   date?: string
   location?: Location
   note?: string
@@ -213,3 +273,45 @@ export async function restoreTicket(id: string): Promise<Ticket> {
 export function permanentDeleteTicket(id: string): Promise<void> {
   return request.delete(`/tickets/${id}/permanent`)
 }
+
+// 批量操作类型
+export type BatchAction = 'delete' | 'restore' | 'permanent_delete' | 'set_privacy' | 'add_tags' | 'remove_tags' | 'set_type'
+
+// 批量操作参数
+export interface BatchTicketParams {
+  action: BatchAction
+  ids: number[]
+  privacy?: PrivacyLevel
+  tags?: string[]
+  type?: TicketType
+}
+
+// 批量操作结果
+export interface BatchTicketResult {
+  results: { id: number; success: boolean; error?: string }[]
+  succeeded: number
+  failed: number
+}
+
+/**
+ * 批量操作票据
+ */
+export function batchTickets(data: BatchTicketParams): Promise<BatchTicketResult> {
+  return request.post('/tickets/batch', data)
+}
+
+// 疑似重复的一对票据，a 为较早创建的一张
+export interface DuplicatePair {
+  a: Ticket
+  b: Ticket
+  reasons: ('photo' | 'fields')[]  // photo：照片近似；fields：类型、日期、车次/航班号相同
+  distance?: number
+}
+
+/**
+ * 获取疑似重复的票据对
+ */
+export async function getDuplicateTickets(): Promise<DuplicatePair[]> {
+  const result = await request.get<{ pairs: { a: RawTicket; b: RawTicket; reasons: DuplicatePair['reasons']; distance?: number }[] }>('/tickets/duplicates')
+  return result.pairs.map(p => ({ ...p, a: transformTicket(p.a), b: transformTicket(p.b) }))
+}
@@ -2,10 +2,14 @@ import request from '@/utils/request'
 
 // 上传凭证响应
 export interface UploadTokenResult {
+  driver?: 'qiniu' | 'local' | 's3'  // 存储驱动
   token: string
   domain: string
   key: string
-  uploadUrl?: string  // 上传域名（可选，由后端返回）
+  uploadUrl?: string  // 上传地址（可选，由后端返回）
+  fields?: Record<string, string>  // 上传表单字段
+  url?: string  // 上传完成后的照片地址
+  thumbnailUrl?: string  // 缩略图地址
 }
 
 // 七牛云上传域名（华南区域 z2）
@@ -25,19 +29,19 @@ export function getUploadToken(): Promise<UploadTokenResult> {
 }
 
 /**
- * 上传图片到七牛云
+ * 上传图片到对象存储（七牛云 / 本地 / S3，由后端决定）
  */
 export async function uploadImage(file: File): Promise<{ url: string; thumbnailUrl: string }> {
   // 获取上传凭证
-  const { token, domain, key, uploadUrl } = await getUploadToken()
+  const { token, domain, key, uploadUrl, fields, url: fileUrl, thumbnailUrl: thumbUrl } = await getUploadToken()
   
-  // 构建 FormData
+  // 构建 FormData，文件放在最后（S3 要求）
   const formData = new FormData()
+  const formFields = fields || { token, key }
+  Object.keys(formFields).forEach((name) => formData.append(name, formFields[name]))
   formData.append('file', file)
-  formData.append('token', token)
-  formData.append('key', key)
   
-  // 上传到七牛云（优先使用后端返回的上传域名）
+  // 上传（优先使用后端返回的上传地址）
   const targetUrl = uploadUrl || QINIU_UPLOAD_URL
   const response = await fetch(targetUrl, {
     method: 'POST',
@@ -50,9 +54,9 @@ export async function uploadImage(file: File): Promise<{ url: string; thumbnailU
     throw new Error('上传失败')
   }
   
-  const result = await response.json()
-  const url = `${domain}/${result.key}`
-  const thumbnailUrl = `${url}?imageView2/1/w/300/h/300/q/80`
+  // S3 上传成功时响应体为空，地址以凭证中的为准
+  const url = fileUrl || `${domain}/${key}`
+  const thumbnailUrl = thumbUrl || `${url}?imageView2/1/w/300/h/300/q/80`
   
   console.log('[Upload] 上传成功:', { url, thumbnailUrl })
   return { url, thumbnailUrl }
@@ -7,6 +7,7 @@ export interface UserInfo {
   nickName?: string
   avatarUrl?: string
   phone?: string
+  email?: string
   ticketCount: number
   photoCount: number
   photoQuota: number
@@ -47,3 +48,53 @@ export function bindPhone(code: string): Promise<{ phone: string }> {
 export function unbindPhone(): Promise<void> {
   return request.post('/auth/unbind-phone')
 }
+
+// 登录返回的 token 和用户信息
+export interface LoginResult {
+  token: string
+  refreshToken: string
+  expiresIn: number
+  user: UserInfo
+}
+
+// 登录身份
+export interface Identity {
+  provider: 'wechat' | 'phone' | 'email'
+  display: string  // 邮箱地址、脱敏手机号，微信为空
+  createdAt: string
+}
+
+/**
+ * 发送邮箱登录验证码（邮箱须已绑定账号）
+ */
+export function sendLoginEmailCode(email: string): Promise<void> {
+  return request.post('/auth/email/code', { email })
+}
+
+/**
+ * 邮箱验证码登录
+ */
+export function emailLogin(email: string, code: string): Promise<LoginResult> {
+  return request.post('/auth/email/login', { email, code, deviceName: navigator.userAgent.slice(0, 64) })
+}
+
+/**
+ * 发送绑定邮箱的验证码
+ */
+export function sendBindEmailCode(email: string): Promise<void> {
+  return request.post('/auth/email/bind-code', { email })
+}
+
+/**
+ * 用验证码绑定邮箱
+ */
+export function bindEmail(email: string, code: string): Promise<{ email: string }> {
+  return request.post('/auth/email/bind', { email, code })
+}
+
+/**
+ * 已绑定的登录身份
+ */
+export function getIdentities(): Promise<{ list: Identity[] }> {
+  return request.get('/auth/identities')
+}
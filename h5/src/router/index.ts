@@ -44,6 +44,18 @@ const routes: RouteRecordRaw[] = [
     component: () => import('@/views/trash/index.vue'),
     meta: { title: '回收站' }
   },
+  {
+    path: '/login',
+    name: 'Login',
+    component: () => import('@/views/login/index.vue'),
+    meta: { title: '邮箱登录' }
+  },
+  {
+    path: '/bind-email',
+    name: 'BindEmail',
+    component: () => import('@/views/mine/email.vue'),
+    meta: { title: '绑定邮箱' }
+  },
   {
     path: '/about',
     name: 'About',
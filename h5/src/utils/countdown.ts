@@ -0,0 +1,32 @@
+// 发送验证码后的倒计时
+import { ref, computed, onBeforeUnmount } from 'vue'
+
+/**
+ * 倒计时，seconds 为 0 时可以再次发送
+ */
+export function useCountdown(duration = 60) {
+  const seconds = ref(0)
+  let timer: ReturnType<typeof setInterval> | null = null
+
+  const counting = computed(() => seconds.value > 0)
+
+  function stop() {
+    if (timer) {
+      clearInterval(timer)
+      timer = null
+    }
+  }
+
+  function start() {
+    stop()
+    seconds.value = duration
+    timer = setInterval(() => {
+      seconds.value--
+      if (seconds.value <= 0) stop()
+    }, 1000)
+  }
+
+  onBeforeUnmount(stop)
+
+  return { seconds, counting, start }
+}
@@ -1,9 +1,14 @@
 // app.ts
-import { login, checkToken } from './utils/auth'
+import { login, refresh, checkToken, type AuthTokens } from './utils/auth'
+
+// access token 过期前提前刷新的时间（毫秒）
+const REFRESH_AHEAD = 60 * 1000
 
 App<IAppOption>({
   globalData: {
     token: '',
+    refreshToken: '',
+    tokenExpiresAt: 0,
     userInfo: null,
     h5BaseUrl: 'https://your-domain.com' // H5 页面的基础 URL
   },
@@ -13,25 +18,44 @@ App<IAppOption>({
     const token = wx.getStorageSync('token')
     if (token) {
       this.globalData.token = token
+      this.globalData.refreshToken = wx.getStorageSync('refreshToken') || ''
+      this.globalData.tokenExpiresAt = wx.getStorageSync('tokenExpiresAt') || 0
       // 验证 token 有效性
       checkToken(token).then(valid => {
         if (!valid) {
-          // token 失效，清除并重新登录
-          wx.removeStorageSync('token')
+          // token 失效（过期或会话已下线），下次获取时先尝试刷新
           this.globalData.token = ''
+          wx.removeStorageSync('token')
         }
       })
     }
   },
 
-  // 获取 token，如果没有则进行登录
+  // 获取 token：未过期直接返回，过期时用 refresh token 刷新，都不可用时重新登录
   async getToken(): Promise<string> {
-    if (this.globalData.token) {
-      return this.globalData.token
+    const { token, refreshToken, tokenExpiresAt } = this.globalData
+    if (token && Date.now() < tokenExpiresAt - REFRESH_AHEAD) {
+      return token
     }
-    const token = await login()
-    this.globalData.token = token
-    wx.setStorageSync('token', token)
-    return token
+    if (refreshToken) {
+      try {
+        return this.saveTokens(await refresh(refreshToken))
+      } catch (error) {
+        console.warn('[App] 刷新 token 失败，重新登录:', error)
+      }
+    }
+    return this.saveTokens(await login())
+  },
+
+  // 保存登录/刷新返回的 token
+  saveTokens(tokens: AuthTokens): string {
+    const expiresAt = Date.now() + tokens.expiresIn * 1000
+    this.globalData.token = tokens.token
+    this.globalData.refreshToken = tokens.refreshToken
+    this.globalData.tokenExpiresAt = expiresAt
+    wx.setStorageSync('token', tokens.token)
+    wx.setStorageSync('refreshToken', tokens.refreshToken)
+    wx.setStorageSync('tokenExpiresAt', expiresAt)
+    return tokens.token
   }
 })
@@ -1,6 +1,7 @@
 // pages/webview/index.ts
 // web-view 容器页面
 import { handleH5Message } from '../../utils/bridge'
+import { decryptData } from '../../utils/auth'
 
 Page({
   data: {
@@ -30,10 +31,38 @@ Page({
     
     this.setData({ webviewUrl: h5Url })
     
+    // 分享到群聊时带上 shareTicket，打开时可以知道来自哪个群
+    wx.showShareMenu({ withShareTicket: true })
+    this.recordShareOpen(decodeURIComponent(path))
+    
     // 检查是否有桥接回调结果需要处理
     this.checkBridgeResult()
   },
 
+  // 从群聊分享卡片打开票据详情时，记录来自哪个群
+  recordShareOpen(path: string) {
+    const { shareTicket } = wx.getEnterOptionsSync()
+    const match = path.match(/^\/detail\/(\d+)/)
+    if (!shareTicket || !match) return
+
+    wx.getShareInfo({
+      shareTicket,
+      success: async (res) => {
+        try {
+          const token = await getApp<IAppOption>().getToken()
+          await decryptData({
+            type: 'shareInfo',
+            encryptedData: res.encryptedData,
+            iv: res.iv,
+            ticketId: Number(match[1])
+          }, token)
+        } catch (error) {
+          console.warn('[WebView] 记录分享来源失败:', error)
+        }
+      }
+    })
+  },
+
   onShow() {
     // 页面显示时检查桥接结果
     this.checkBridgeResult()
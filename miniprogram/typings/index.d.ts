@@ -3,10 +3,13 @@
 interface IAppOption {
   globalData: {
     token: string
+    refreshToken: string
+    tokenExpiresAt: number  // access token 过期时间（毫秒时间戳）
     userInfo: WechatMiniprogram.UserInfo | null
     h5BaseUrl: string
   }
   getToken(): Promise<string>
+  saveTokens(tokens: import('../utils/auth').AuthTokens): string
 }
 
 // 桥接消息类型
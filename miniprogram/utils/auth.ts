@@ -1,10 +1,17 @@
 // 登录相关工具函数
 const API_BASE_URL = 'https://your-api-domain.com/api'
 
+// 登录/刷新返回的 token
+export interface AuthTokens {
+  token: string         // access token
+  refreshToken: string  // 每次刷新后更换
+  expiresIn: number     // access token 有效期（秒）
+}
+
 /**
  * 微信登录，获取 token
  */
-export async function login(): Promise<string> {
+export async function login(): Promise<AuthTokens> {
   return new Promise((resolve, reject) => {
     // 1. 调用 wx.login 获取 code
     wx.login({
@@ -12,14 +19,15 @@ export async function login(): Promise<string> {
         if (loginRes.code) {
           try {
             // 2. 将 code 发送到后端换取 token
-            const result = await wxRequest<{ token: string }>({
+            const result = await wxRequest<AuthTokens>({
               url: `${API_BASE_URL}/auth/login`,
               method: 'POST',
               data: {
-                code: loginRes.code
+                code: loginRes.code,
+                deviceName: getDeviceName()
               }
             })
-            resolve(result.token)
+            resolve(result)
           } catch (error) {
             reject(error)
           }
@@ -34,6 +42,42 @@ export async function login(): Promise<string> {
   })
 }
 
+/**
+ * 用 refresh token 换取新的 token，会话已失效时抛出错误
+ */
+export function refresh(refreshToken: string): Promise<AuthTokens> {
+  return wxRequest<AuthTokens>({
+    url: `${API_BASE_URL}/auth/refresh`,
+    method: 'POST',
+    data: { refreshToken }
+  })
+}
+
+/**
+ * 退出登录，当前设备的 token 立即失效
+ */
+export async function logout(token: string): Promise<void> {
+  await wxRequest({
+    url: `${API_BASE_URL}/auth/logout`,
+    method: 'POST',
+    header: {
+      Authorization: `Bearer ${token}`
+    }
+  })
+}
+
+/**
+ * 设备名称，显示在登录设备列表中
+ */
+function getDeviceName(): string {
+  try {
+    const info = wx.getSystemInfoSync()
+    return `${info.brand} ${info.model}`.trim()
+  } catch {
+    return ''
+  }
+}
+
 /**
  * 检查 token 是否有效
  */
@@ -71,6 +115,31 @@ export async function bindPhone(code: string, token: string): Promise<boolean> {
   }
 }
 
+// 解密开放数据请求，type 为 userInfo / shareInfo / runData
+export interface DecryptPayload {
+  type: 'userInfo' | 'shareInfo' | 'runData'
+  encryptedData: string
+  iv: string
+  rawData?: string    // userInfo 必填
+  signature?: string  // userInfo 必填
+  ticketId?: number   // shareInfo：分享卡片对应的票据
+}
+
+/**
+ * 由服务端用登录时的 session_key 解密开放数据
+ * 解密失败通常是 session_key 已更换，需要重新登录后再试
+ */
+export function decryptData<T>(payload: DecryptPayload, token: string): Promise<T> {
+  return wxRequest<T>({
+    url: `${API_BASE_URL}/auth/decrypt`,
+    method: 'POST',
+    data: payload,
+    header: {
+      Authorization: `Bearer ${token}`
+    }
+  })
+}
+
 /**
  * 封装的 wx.request
  */
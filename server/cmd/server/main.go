@@ -1,17 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"piaoji-server/internal/config"
 	"piaoji-server/internal/database"
+	"piaoji-server/internal/dedup"
+	"piaoji-server/internal/imaging"
+	"piaoji-server/internal/job"
+	"piaoji-server/internal/mailer"
 	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/ocr"
 	"piaoji-server/internal/router"
+	"piaoji-server/internal/storage"
+	"piaoji-server/internal/wechat"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout 关闭服务时等待进行中请求的最长时间
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// 解析命令行参数
 	configPath := flag.String("config", "config/config.yaml", "配置文件路径")
@@ -29,6 +46,49 @@ func main() {
 	}
 	log.Println("[Database] 数据库连接成功")
 
+	// 初始化对象存储
+	if err := storage.Init(config.Cfg); err != nil {
+		log.Fatalf("初始化对象存储失败: %v", err)
+	}
+	log.Printf("[Storage] 使用存储驱动: %s", storage.Current().Name())
+
+	// 初始化微信接口客户端（access_token 在进程内缓存）
+	wechat.Init(&config.Cfg.Wechat)
+
+	// 初始化邮件发送（邮箱验证码）
+	if err := mailer.Init(&config.Cfg.Mail); err != nil {
+		log.Fatalf("初始化邮件发送失败: %v", err)
+	}
+	log.Printf("[Mail] 使用邮件驱动: %s", mailer.Current().Name())
+
+	// 启动后台定时任务
+	scheduler := job.NewScheduler()
+	scheduler.Every("trash-purge", config.Cfg.Trash.GetPurgeInterval(), job.PurgeTrash)
+	if config.Cfg.OrphanGC.Enabled {
+		scheduler.Every("orphan-gc", config.Cfg.OrphanGC.GetInterval(), job.CollectOrphans)
+	}
+	scheduler.Every("photo-hash", config.Cfg.Duplicate.GetHashInterval(), job.HashPhotos)
+	scheduler.Every("session-purge", 24*time.Hour, job.PurgeSessions)
+	scheduler.Every("email-code-purge", 24*time.Hour, job.PurgeEmailCodes)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// 启动图片处理队列（未启用时跳过），需在上传回调可用之前启动
+	if err := imaging.Start(&config.Cfg.Image); err != nil && !errors.Is(err, imaging.ErrDisabled) {
+		log.Printf("[Image] 图片处理启动失败: %v", err)
+	}
+	defer imaging.Stop()
+
+	// 启动照片哈希队列（新建/更新票据的照片在后台计算哈希）
+	dedup.Start()
+	defer dedup.Stop()
+
+	// 启动照片识别队列（未启用时跳过）
+	if err := ocr.Start(&config.Cfg.OCR); err != nil && !errors.Is(err, ocr.ErrDisabled) {
+		log.Printf("[OCR] 识别服务启动失败: %v", err)
+	}
+	defer ocr.Stop()
+
 	// 设置 Gin 模式
 	gin.SetMode(config.Cfg.Server.Mode)
 
@@ -55,7 +115,28 @@ func main() {
 	addr := fmt.Sprintf(":%d", config.Cfg.Server.Port)
 	log.Printf("[Server] 服务启动: http://localhost%s/api", addr)
 
-	if err := r.Run(addr); err != nil {
+	// 收到 SIGINT/SIGTERM 后停止接收新请求，等待进行中的请求结束，
+	// main 返回时再按 defer 顺序停止识别、哈希、图片处理队列和定时任务
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: addr, Handler: r}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		// 监听失败时还没有处理任何请求，直接退出
 		log.Fatalf("服务启动失败: %v", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("[Server] 正在关闭服务...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[Server] 等待请求结束超时: %v", err)
 	}
 }
@@ -1,16 +1,29 @@
 package config
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Wechat   WechatConfig   `mapstructure:"wechat"`
-	Qiniu    QiniuConfig    `mapstructure:"qiniu"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Wechat    WechatConfig    `mapstructure:"wechat"`
+	Qiniu     QiniuConfig     `mapstructure:"qiniu"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	Trash     TrashConfig     `mapstructure:"trash"`
+	OrphanGC  OrphanGCConfig  `mapstructure:"orphan_gc"`
+	OCR       OCRConfig       `mapstructure:"ocr"`
+	Image     ImageConfig     `mapstructure:"image"`
+	Duplicate DuplicateConfig `mapstructure:"duplicate"`
+	Security  SecurityConfig  `mapstructure:"security"`
+	Mail      MailConfig      `mapstructure:"mail"`
+	EmailCode EmailCodeConfig `mapstructure:"email_code"`
 }
 
 type ServerConfig struct {
@@ -33,13 +46,186 @@ func (c *DatabaseConfig) DSN() string {
 }
 
 type JWTConfig struct {
-	Secret string `mapstructure:"secret"`
-	Expire string `mapstructure:"expire"`
+	Secret        string `mapstructure:"secret"`
+	Expire        string `mapstructure:"expire"`         // 旧配置，未设置 refresh_expire 时作为 refresh token 有效期
+	AccessExpire  string `mapstructure:"access_expire"`  // access token 有效期
+	RefreshExpire string `mapstructure:"refresh_expire"` // refresh token 有效期，每次刷新顺延
+}
+
+// GetAccessExpire 获取 access token 有效期，默认 2 小时
+func (c *JWTConfig) GetAccessExpire() time.Duration {
+	d, err := time.ParseDuration(c.AccessExpire)
+	if err != nil || d <= 0 {
+		return 2 * time.Hour
+	}
+	return d
+}
+
+// GetRefreshExpire 获取 refresh token 有效期，默认 30 天
+func (c *JWTConfig) GetRefreshExpire() time.Duration {
+	for _, v := range []string{c.RefreshExpire, c.Expire} {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 30 * 24 * time.Hour
 }
 
 type WechatConfig struct {
-	AppID  string `mapstructure:"appid"`
-	Secret string `mapstructure:"secret"`
+	AppID       string `mapstructure:"appid"`
+	Secret      string `mapstructure:"secret"`
+	BaseURL     string `mapstructure:"base_url"`     // 微信接口地址，测试时可指向本地模拟服务
+	Timeout     string `mapstructure:"timeout"`      // 单次请求超时
+	MaxAttempts int    `mapstructure:"max_attempts"` // 网络错误或系统繁忙时的最多尝试次数（含第一次）
+}
+
+// GetBaseURL 获取微信接口地址，默认 https://api.weixin.qq.com
+func (c *WechatConfig) GetBaseURL() string {
+	if c.BaseURL == "" {
+		return "https://api.weixin.qq.com"
+	}
+	return strings.TrimRight(c.BaseURL, "/")
+}
+
+// GetTimeout 获取单次请求超时，默认 5 秒
+func (c *WechatConfig) GetTimeout() time.Duration {
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return 5 * time.Second
+	}
+	return d
+}
+
+// GetMaxAttempts 获取最多尝试次数，默认 3
+func (c *WechatConfig) GetMaxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return 3
+	}
+	return c.MaxAttempts
+}
+
+// SecurityConfig 敏感数据保护
+type SecurityConfig struct {
+	DataKey string `mapstructure:"data_key"` // 加密手机号等敏感字段的密钥，为空时由 jwt.secret 派生
+}
+
+// GetDataKey 获取数据密钥，未配置时使用 jwt.secret 的 SHA-256
+// 密钥更换后已加密的数据将无法解密
+func (c *SecurityConfig) GetDataKey() []byte {
+	key := c.DataKey
+	if key == "" {
+		key = Cfg.JWT.Secret
+	}
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// MailConfig 邮件发送（邮箱验证码）
+type MailConfig struct {
+	Driver string         `mapstructure:"driver"` // log（默认，只写日志）/ file / smtp
+	From   string         `mapstructure:"from"`   // 发件人，如 票迹 <noreply@example.com>
+	SMTP   SMTPMailConfig `mapstructure:"smtp"`
+	File   FileMailConfig `mapstructure:"file"`
+}
+
+// GetDriver 获取邮件驱动，默认 log
+func (c *MailConfig) GetDriver() string {
+	if c.Driver == "" {
+		return "log"
+	}
+	return c.Driver
+}
+
+// GetFrom 获取发件人，默认 noreply@localhost
+func (c *MailConfig) GetFrom() string {
+	if c.From == "" {
+		return "noreply@localhost"
+	}
+	return c.From
+}
+
+// SMTPMailConfig SMTP 发信
+type SMTPMailConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	TLS      bool   `mapstructure:"tls"` // 为 true 时直接使用 TLS 连接（465 端口），否则服务器支持时使用 STARTTLS
+}
+
+// GetPort 获取 SMTP 端口，默认 TLS 为 465，否则为 587
+func (c *SMTPMailConfig) GetPort() int {
+	if c.Port > 0 {
+		return c.Port
+	}
+	if c.TLS {
+		return 465
+	}
+	return 587
+}
+
+// FileMailConfig 把邮件写入目录，用于本地开发
+type FileMailConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+// GetDir 获取邮件保存目录，默认 ./mails
+func (c *FileMailConfig) GetDir() string {
+	if c.Dir == "" {
+		return "./mails"
+	}
+	return c.Dir
+}
+
+// EmailCodeConfig 邮箱验证码的有效期和发送频率限制
+type EmailCodeConfig struct {
+	TTL           string `mapstructure:"ttl"`             // 验证码有效期
+	Interval      string `mapstructure:"interval"`        // 同一邮箱两次发送的最小间隔
+	HourlyLimit   int    `mapstructure:"hourly_limit"`    // 同一邮箱每小时最多发送次数
+	IPHourlyLimit int    `mapstructure:"ip_hourly_limit"` // 同一 IP 每小时最多发送次数
+	MaxAttempts   int    `mapstructure:"max_attempts"`    // 每个验证码最多校验次数，超过后需重新获取
+}
+
+// GetTTL 获取验证码有效期，默认 10 分钟
+func (c *EmailCodeConfig) GetTTL() time.Duration {
+	d, err := time.ParseDuration(c.TTL)
+	if err != nil || d <= 0 {
+		return 10 * time.Minute
+	}
+	return d
+}
+
+// GetInterval 获取同一邮箱的发送间隔，默认 60 秒
+func (c *EmailCodeConfig) GetInterval() time.Duration {
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil || d <= 0 {
+		return time.Minute
+	}
+	return d
+}
+
+// GetHourlyLimit 获取同一邮箱每小时发送上限，默认 5
+func (c *EmailCodeConfig) GetHourlyLimit() int {
+	if c.HourlyLimit <= 0 {
+		return 5
+	}
+	return c.HourlyLimit
+}
+
+// GetIPHourlyLimit 获取同一 IP 每小时发送上限，默认 20
+func (c *EmailCodeConfig) GetIPHourlyLimit() int {
+	if c.IPHourlyLimit <= 0 {
+		return 20
+	}
+	return c.IPHourlyLimit
+}
+
+// GetMaxAttempts 获取每个验证码的校验次数上限，默认 5
+func (c *EmailCodeConfig) GetMaxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return 5
+	}
+	return c.MaxAttempts
 }
 
 type QiniuConfig struct {
@@ -48,6 +234,8 @@ type QiniuConfig struct {
 	Bucket    string `mapstructure:"bucket"`
 	Domain    string `mapstructure:"domain"`
 	Region    string `mapstructure:"region"` // 区域：z0(华东), z1(华北), z2(华南), na0(北美), as0(东南亚)
+	// 上传回调地址（指向 /api/upload/callback），为空时不回调，照片在创建票据时查询确认
+	CallbackURL string `mapstructure:"callback_url"`
 }
 
 // GetUploadURL 获取七牛云上传域名
@@ -65,11 +253,230 @@ func (c *QiniuConfig) GetUploadURL() string {
 	return "https://upload.qiniup.com" // 默认华东
 }
 
+// StorageConfig 对象存储配置，driver 选择存储实现，七牛云沿用顶层 qiniu 配置
+type StorageConfig struct {
+	Driver string             `mapstructure:"driver"` // qiniu（默认）/ local / s3
+	Local  LocalStorageConfig `mapstructure:"local"`
+	S3     S3StorageConfig    `mapstructure:"s3"`
+}
+
+// GetDriver 获取存储驱动，默认 qiniu
+func (c *StorageConfig) GetDriver() string {
+	if c.Driver == "" {
+		return "qiniu"
+	}
+	return c.Driver
+}
+
+// LocalStorageConfig 本地磁盘存储，文件由服务自身通过 /uploads 提供访问
+type LocalStorageConfig struct {
+	Dir     string `mapstructure:"dir"`      // 文件保存目录
+	BaseURL string `mapstructure:"base_url"` // 服务对外地址，如 http://localhost:3001
+	Secret  string `mapstructure:"secret"`   // 上传凭证和私有链接的签名密钥，为空时使用 jwt.secret
+	Private bool   `mapstructure:"private"`  // 为 true 时只能通过签名链接访问文件
+}
+
+// GetDir 获取文件保存目录，默认 ./uploads
+func (c *LocalStorageConfig) GetDir() string {
+	if c.Dir == "" {
+		return "./uploads"
+	}
+	return c.Dir
+}
+
+// S3StorageConfig S3 兼容存储（AWS S3、MinIO 等）
+type S3StorageConfig struct {
+	Endpoint  string `mapstructure:"endpoint"`   // 服务地址，如 http://localhost:9000
+	Region    string `mapstructure:"region"`     // 区域
+	Bucket    string `mapstructure:"bucket"`     // 存储桶
+	AccessKey string `mapstructure:"access_key"` // 访问密钥
+	SecretKey string `mapstructure:"secret_key"` // 私有密钥
+	PublicURL string `mapstructure:"public_url"` // 对外访问地址，为空时使用 endpoint 拼接 bucket
+	PathStyle bool   `mapstructure:"path_style"` // 使用路径风格地址（MinIO 需要开启）
+}
+
+// GetRegion 获取区域，默认 us-east-1
+func (c *S3StorageConfig) GetRegion() string {
+	if c.Region == "" {
+		return "us-east-1"
+	}
+	return c.Region
+}
+
+type TrashConfig struct {
+	Retention     string `mapstructure:"retention"`      // 回收站保留时长，到期后自动永久删除
+	PurgeInterval string `mapstructure:"purge_interval"` // 清理任务执行间隔
+	BatchSize     int    `mapstructure:"batch_size"`     // 每批清理条数
+	DryRun        bool   `mapstructure:"dry_run"`        // 只记录日志，不实际删除
+}
+
+// GetRetention 获取回收站保留时长，默认 30 天
+func (c *TrashConfig) GetRetention() time.Duration {
+	d, err := time.ParseDuration(c.Retention)
+	if err != nil || d <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return d
+}
+
+// GetPurgeInterval 获取清理任务执行间隔，默认 1 小时
+func (c *TrashConfig) GetPurgeInterval() time.Duration {
+	d, err := time.ParseDuration(c.PurgeInterval)
+	if err != nil || d <= 0 {
+		return time.Hour
+	}
+	return d
+}
+
+// GetBatchSize 获取每批清理条数，默认 100
+func (c *TrashConfig) GetBatchSize() int {
+	if c.BatchSize <= 0 {
+		return 100
+	}
+	return c.BatchSize
+}
+
+// OrphanGCConfig 孤儿照片清理：删除存储中没有被任何票据引用的上传文件
+type OrphanGCConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Interval    string `mapstructure:"interval"`     // 清理任务执行间隔
+	GracePeriod string `mapstructure:"grace_period"` // 上传后超过该时长仍未被引用才删除
+	DryRun      bool   `mapstructure:"dry_run"`      // 只报告，不实际删除
+}
+
+// GetInterval 获取清理任务执行间隔，默认 24 小时
+func (c *OrphanGCConfig) GetInterval() time.Duration {
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil || d <= 0 {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// GetGracePeriod 获取宽限期，默认 72 小时，不少于 1 小时
+func (c *OrphanGCConfig) GetGracePeriod() time.Duration {
+	d, err := time.ParseDuration(c.GracePeriod)
+	if err != nil || d <= 0 {
+		return 72 * time.Hour
+	}
+	return max(d, time.Hour)
+}
+
+// DuplicateConfig 重复照片检测
+type DuplicateConfig struct {
+	MaxDistance  int    `mapstructure:"max_distance"`  // 感知哈希差异不超过该值视为同一张照片（0~64）
+	HashInterval string `mapstructure:"hash_interval"` // 为历史照片补算哈希的任务执行间隔
+}
+
+// GetMaxDistance 获取近似照片的最大差异，默认 8
+func (c *DuplicateConfig) GetMaxDistance() int {
+	if c.MaxDistance <= 0 || c.MaxDistance > 64 {
+		return 8
+	}
+	return c.MaxDistance
+}
+
+// GetHashInterval 获取补算哈希的任务执行间隔，默认 1 小时
+func (c *DuplicateConfig) GetHashInterval() time.Duration {
+	d, err := time.ParseDuration(c.HashInterval)
+	if err != nil || d <= 0 {
+		return time.Hour
+	}
+	return d
+}
+
+type OCRConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Provider  string `mapstructure:"provider"` // tesseract / cloud / stub
+	Workers   int    `mapstructure:"workers"`  // 并发识别数
+	Timeout   string `mapstructure:"timeout"`  // 单张照片识别超时
+	Tesseract struct {
+		Path      string `mapstructure:"path"`      // tesseract 可执行文件路径
+		Languages string `mapstructure:"languages"` // 语言包，如 chi_sim+eng
+	} `mapstructure:"tesseract"`
+	Cloud struct {
+		Endpoint string `mapstructure:"endpoint"` // 识别服务地址
+		APIKey   string `mapstructure:"api_key"`
+	} `mapstructure:"cloud"`
+	StubText string `mapstructure:"stub_text"` // stub 识别器固定返回的文本，用于开发调试
+}
+
+// GetWorkers 获取并发识别数，默认 2
+func (c *OCRConfig) GetWorkers() int {
+	if c.Workers <= 0 {
+		return 2
+	}
+	return c.Workers
+}
+
+// GetTimeout 获取单张照片识别超时，默认 30 秒
+func (c *OCRConfig) GetTimeout() time.Duration {
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// ImageConfig 上传照片的服务端处理：按 EXIF 校正方向、去除 EXIF、生成缩略图和 WebP
+type ImageConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Workers         int    `mapstructure:"workers"`          // 并发处理数
+	Quality         int    `mapstructure:"quality"`          // JPEG/WebP 压缩质量
+	ThumbnailSize   int    `mapstructure:"thumbnail_size"`   // 列表缩略图边长（居中裁剪为正方形）
+	Sizes           []int  `mapstructure:"sizes"`            // 其他尺寸（长边像素），大于原图的尺寸跳过
+	WebP            bool   `mapstructure:"webp"`             // 是否为每个尺寸生成 WebP 版本
+	CWebP           string `mapstructure:"cwebp"`            // cwebp 可执行文件路径
+	ExtractMetadata bool   `mapstructure:"extract_metadata"` // 去除 EXIF 前记录拍摄时间和 GPS，用于识别草稿预填
+}
+
+// GetWorkers 获取并发处理数，默认 2
+func (c *ImageConfig) GetWorkers() int {
+	if c.Workers <= 0 {
+		return 2
+	}
+	return c.Workers
+}
+
+// GetQuality 获取压缩质量，默认 80
+func (c *ImageConfig) GetQuality() int {
+	if c.Quality <= 0 || c.Quality > 100 {
+		return 80
+	}
+	return c.Quality
+}
+
+// GetThumbnailSize 获取缩略图边长，默认 300
+func (c *ImageConfig) GetThumbnailSize() int {
+	if c.ThumbnailSize <= 0 {
+		return 300
+	}
+	return c.ThumbnailSize
+}
+
+// GetSizes 获取其他尺寸，默认 1080
+func (c *ImageConfig) GetSizes() []int {
+	if len(c.Sizes) == 0 {
+		return []int{1080}
+	}
+	return c.Sizes
+}
+
+// GetCWebP 获取 cwebp 路径，默认从 PATH 查找
+func (c *ImageConfig) GetCWebP() string {
+	if c.CWebP == "" {
+		return "cwebp"
+	}
+	return c.CWebP
+}
+
 var Cfg *Config
 
 func Load(path string) error {
 	viper.SetConfigFile(path)
 	viper.SetConfigType("yaml")
+	// 图片处理负责去除照片中的 EXIF/GPS，未配置时默认开启
+	viper.SetDefault("image.enabled", true)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return fmt.Errorf("读取配置文件失败: %w", err)
@@ -3,7 +3,11 @@ package database
 import (
 	"fmt"
 	"piaoji-server/internal/config"
+	"piaoji-server/internal/identity"
 	"piaoji-server/internal/model"
+	"piaoji-server/internal/phone"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/tagging"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -34,10 +38,43 @@ func Init() error {
 		&model.User{},
 		&model.Ticket{},
 		&model.Tag{},
+		&model.OCRJob{},
+		&model.TicketTag{},
+		&model.TicketPhoto{},
+		&model.Upload{},
+		&model.Session{},
+		&model.TicketShareOpen{},
+		&model.Identity{},
+		&model.EmailCode{},
 	); err != nil {
 		return fmt.Errorf("数据库迁移失败: %w", err)
 	}
 
+	// 旧版 JSON 标签迁移到 ticket_tags
+	if err := tagging.Backfill(db); err != nil {
+		return fmt.Errorf("数据库迁移失败: %w", err)
+	}
+
+	// 合并仅大小写不同的重名标签，并创建标签名唯一索引
+	if err := tagging.EnsureUniqueNames(db); err != nil {
+		return fmt.Errorf("数据库迁移失败: %w", err)
+	}
+
+	// 旧版单张照片补齐到 ticket_photos
+	if err := photo.Backfill(db); err != nil {
+		return fmt.Errorf("数据库迁移失败: %w", err)
+	}
+
+	// 明文手机号改为加密保存
+	if err := phone.Backfill(db); err != nil {
+		return fmt.Errorf("数据库迁移失败: %w", err)
+	}
+
+	// 已有用户补齐微信和手机号登录身份
+	if err := identity.Backfill(db); err != nil {
+		return fmt.Errorf("数据库迁移失败: %w", err)
+	}
+
 	// 初始化全局标签
 	if err := initGlobalTags(db); err != nil {
 		return fmt.Errorf("初始化全局标签失败: %w", err)
@@ -0,0 +1,280 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"piaoji-server/internal/imaging"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/storage"
+	"piaoji-server/internal/tagging"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// maxPairs 疑似重复列表最多返回的票据对数
+const maxPairs = 200
+
+// Hash 为缺少哈希的照片计算内容哈希并保存，计算失败的照片跳过，由补算任务重试
+// 返回无法计算的照片（对象不存在或不是图片）ID，这些照片重试也不会成功
+func Hash(ctx context.Context, db *gorm.DB, photos []model.TicketPhoto) []int64 {
+	var invalid []int64
+	for i := range photos {
+		p := &photos[i]
+		if p.SHA256 != nil {
+			continue
+		}
+		key, ok := storage.KeyFromURL(p.URL)
+		if !ok {
+			invalid = append(invalid, p.ID)
+			continue
+		}
+		fp, err := imaging.Hash(ctx, db, key)
+		if err != nil {
+			log.Printf("[Dedup] 计算照片哈希失败: key=%s, err=%v", key, err)
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, imaging.ErrInvalidImage) {
+				invalid = append(invalid, p.ID)
+			}
+			continue
+		}
+		if err := save(db, p.ID, fp); err != nil {
+			log.Printf("[Dedup] 保存照片哈希失败: id=%d, err=%v", p.ID, err)
+			continue
+		}
+		p.SHA256, p.DHash, p.PHash = &fp.SHA256, &fp.DHash, &fp.PHash
+	}
+	return invalid
+}
+
+func save(db *gorm.DB, photoID int64, fp imaging.Fingerprint) error {
+	return db.Model(&model.TicketPhoto{}).Where("id = ?", photoID).Updates(map[string]interface{}{
+		"sha256": fp.SHA256,
+		"dhash":  fp.DHash,
+		"phash":  fp.PHash,
+	}).Error
+}
+
+// hashed 已计算哈希的照片
+type hashed struct {
+	TicketID int64
+	SHA256   string
+	DHash    uint64
+	PHash    uint64
+}
+
+func (h hashed) fingerprint() imaging.Fingerprint {
+	return imaging.Fingerprint{SHA256: h.SHA256, DHash: h.DHash, PHash: h.PHash}
+}
+
+// loadHashed 用户未删除票据中已计算哈希的照片
+func loadHashed(db *gorm.DB, userID int64) ([]hashed, error) {
+	var photos []hashed
+	err := db.Model(&model.TicketPhoto{}).
+		Select("ticket_id", "sha256", "dhash", "phash").
+		Where("user_id = ? AND is_deleted = ? AND sha256 <> '' AND dhash IS NOT NULL AND phash IS NOT NULL", userID, false).
+		Order("ticket_id ASC").
+		Scan(&photos).Error
+	return photos, err
+}
+
+// Similar 查找照片与 ticket 的照片近似的其他票据，按差异从小到大排列
+// ticket.Photos 需已计算哈希
+func Similar(db *gorm.DB, ticket *model.Ticket, maxDistance int) ([]model.DuplicateTicket, error) {
+	var own []imaging.Fingerprint
+	for _, p := range ticket.Photos {
+		if p.SHA256 != nil && *p.SHA256 != "" && p.DHash != nil && p.PHash != nil {
+			own = append(own, imaging.Fingerprint{SHA256: *p.SHA256, DHash: *p.DHash, PHash: *p.PHash})
+		}
+	}
+	if len(own) == 0 {
+		return nil, nil
+	}
+
+	photos, err := loadHashed(db, ticket.UserID)
+	if err != nil {
+		return nil, err
+	}
+	best := map[int64]int{}
+	for _, other := range photos {
+		if other.TicketID == ticket.ID {
+			continue
+		}
+		for _, fp := range own {
+			d := imaging.Distance(fp, other.fingerprint())
+			if d > maxDistance {
+				continue
+			}
+			if old, ok := best[other.TicketID]; !ok || d < old {
+				best[other.TicketID] = d
+			}
+		}
+	}
+	if len(best) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, 0, len(best))
+	for id := range best {
+		ids = append(ids, id)
+	}
+	var tickets []model.Ticket
+	if err := db.Select("id", "name").Where("id IN ?", ids).Find(&tickets).Error; err != nil {
+		return nil, err
+	}
+	result := make([]model.DuplicateTicket, len(tickets))
+	for i, t := range tickets {
+		result[i] = model.DuplicateTicket{TicketID: t.ID, Name: t.Name, Distance: best[t.ID]}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Distance != result[j].Distance {
+			return result[i].Distance < result[j].Distance
+		}
+		return result[i].TicketID > result[j].TicketID
+	})
+	return result, nil
+}
+
+// pairKey 一对票据，a < b
+type pairKey struct{ a, b int64 }
+
+func newPairKey(x, y int64) pairKey {
+	if x > y {
+		x, y = y, x
+	}
+	return pairKey{x, y}
+}
+
+// candidate 疑似重复的一对票据及依据
+type candidate struct {
+	key      pairKey
+	distance *int // 照片近似时的最小差异
+	fields   bool // 类型、日期、车次/航班号相同
+}
+
+// Pairs 查找用户未删除票据中疑似重复的票据对
+// 照片近似（含完全相同）或者类型、日期、车次/航班号都相同即视为疑似重复；
+// 两项依据都满足的排在前面，其次按照片差异从小到大；返回的票据已填充标签和照片
+func Pairs(db *gorm.DB, userID int64, maxDistance int) ([]model.DuplicatePair, error) {
+	candidates := map[pairKey]*candidate{}
+	get := func(k pairKey) *candidate {
+		c, ok := candidates[k]
+		if !ok {
+			c = &candidate{key: k}
+			candidates[k] = c
+		}
+		return c
+	}
+
+	// 照片数量受配额限制，逐对比较即可
+	photos, err := loadHashed(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range photos {
+		for j := i + 1; j < len(photos); j++ {
+			if photos[i].TicketID == photos[j].TicketID {
+				continue
+			}
+			d := imaging.Distance(photos[i].fingerprint(), photos[j].fingerprint())
+			if d > maxDistance {
+				continue
+			}
+			c := get(newPairKey(photos[i].TicketID, photos[j].TicketID))
+			if c.distance == nil || d < *c.distance {
+				c.distance = &d
+			}
+		}
+	}
+
+	var same []struct {
+		AID int64
+		BID int64
+	}
+	if err := db.Raw(`SELECT a.id AS a_id, b.id AS b_id FROM tickets a
+		JOIN tickets b ON b.user_id = a.user_id AND b.id > a.id AND b.type = a.type
+			AND b.trip_number = a.trip_number AND DATE(b.date) = DATE(a.date)
+		WHERE a.user_id = ? AND a.is_deleted = ? AND b.is_deleted = ?
+			AND a.trip_number <> '' AND a.date IS NOT NULL`, userID, false, false).
+		Scan(&same).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range same {
+		get(newPairKey(s.AID, s.BID)).fields = true
+	}
+	if len(candidates) == 0 {
+		return []model.DuplicatePair{}, nil
+	}
+
+	list := make([]*candidate, 0, len(candidates))
+	for _, c := range candidates {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if sa, sb := a.score(), b.score(); sa != sb {
+			return sa > sb
+		}
+		if a.distance != nil && b.distance != nil && *a.distance != *b.distance {
+			return *a.distance < *b.distance
+		}
+		return a.key.b > b.key.b
+	})
+	if len(list) > maxPairs {
+		list = list[:maxPairs]
+	}
+
+	idSet := map[int64]bool{}
+	for _, c := range list {
+		idSet[c.key.a], idSet[c.key.b] = true, true
+	}
+	ids := make([]int64, 0, len(idSet))
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+	var tickets []model.Ticket
+	if err := db.Where("id IN ?", ids).Find(&tickets).Error; err != nil {
+		return nil, err
+	}
+	if err := tagging.Fill(db, tickets); err != nil {
+		return nil, err
+	}
+	if err := photo.Fill(db, tickets); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]model.Ticket, len(tickets))
+	for _, t := range tickets {
+		byID[t.ID] = t
+	}
+
+	pairs := make([]model.DuplicatePair, 0, len(list))
+	for _, c := range list {
+		a, okA := byID[c.key.a]
+		b, okB := byID[c.key.b]
+		if !okA || !okB {
+			continue
+		}
+		var reasons []string
+		if c.distance != nil {
+			reasons = append(reasons, model.DuplicateReasonPhoto)
+		}
+		if c.fields {
+			reasons = append(reasons, model.DuplicateReasonFields)
+		}
+		pairs = append(pairs, model.DuplicatePair{A: a, B: b, Reasons: reasons, Distance: c.distance})
+	}
+	return pairs, nil
+}
+
+// score 排序权重，照片近似优先于字段相同
+func (c *candidate) score() int {
+	s := 0
+	if c.distance != nil {
+		s += 2
+	}
+	if c.fields {
+		s++
+	}
+	return s
+}
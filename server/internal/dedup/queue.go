@@ -0,0 +1,118 @@
+package dedup
+
+import (
+	"context"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	queueSize   = 100 // 排队中的票据上限
+	hashTimeout = 2 * time.Minute
+
+	// 创建票据时同步计算哈希的时限，单张票据最多 9 张照片，超时未算完的照片交给队列
+	checkTimeout = 10 * time.Second
+)
+
+// queue 进程内异步计算照片哈希的队列，创建/更新票据时提交，不阻塞请求
+// 队列已满或进程退出时未处理的照片保持 sha256 为空，由补算任务处理
+type queue struct {
+	tickets chan int64
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+var q *queue
+
+// Start 启动计算哈希的 worker
+func Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q = &queue{
+		tickets: make(chan int64, queueSize),
+		cancel:  cancel,
+	}
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case id := <-q.tickets:
+				hashTicket(ctx, id)
+			}
+		}
+	}()
+}
+
+// Stop 停止 worker，等待进行中的任务结束
+func Stop() {
+	if q == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Submit 为票据中还没有哈希的照片排队计算哈希，未启动或队列已满时交给补算任务
+func Submit(ticketID int64) {
+	if q == nil {
+		return
+	}
+	select {
+	case q.tickets <- ticketID:
+	default:
+		log.Printf("[Dedup] 哈希队列已满，由补算任务处理: ticket=%d", ticketID)
+	}
+}
+
+// hashTicket 计算一张票据中缺少哈希的照片
+func hashTicket(ctx context.Context, ticketID int64) {
+	ctx, cancel := context.WithTimeout(ctx, hashTimeout)
+	defer cancel()
+
+	var photos []model.TicketPhoto
+	if err := database.DB.Select("id", "url", "sha256").
+		Where("ticket_id = ? AND sha256 IS NULL", ticketID).
+		Find(&photos).Error; err != nil {
+		log.Printf("[Dedup] 查询票据照片失败: ticket=%d, err=%v", ticketID, err)
+		return
+	}
+	if len(photos) == 0 {
+		return
+	}
+	if err := MarkInvalid(database.DB, Hash(ctx, database.DB, photos)); err != nil {
+		log.Printf("[Dedup] 标记无法计算哈希的照片失败: ticket=%d, err=%v", ticketID, err)
+	}
+}
+
+// MarkInvalid 把无法计算哈希的照片记为空哈希，不再重试
+func MarkInvalid(db *gorm.DB, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Model(&model.TicketPhoto{}).Where("id IN ?", ids).UpdateColumn("sha256", "").Error
+}
+
+// Check 创建票据时同步计算照片哈希，返回照片近似（含文件相同）的用户其他票据
+// 超时或计算失败的照片不参与比较，提交到队列补算
+func Check(ctx context.Context, db *gorm.DB, ticket *model.Ticket, maxDistance int) ([]model.DuplicateTicket, error) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	if err := MarkInvalid(db, Hash(ctx, db, ticket.Photos)); err != nil {
+		log.Printf("[Dedup] 标记无法计算哈希的照片失败: ticket=%d, err=%v", ticket.ID, err)
+	}
+	for _, p := range ticket.Photos {
+		if p.SHA256 == nil {
+			Submit(ticket.ID)
+			break
+		}
+	}
+	return Similar(db, ticket, maxDistance)
+}
@@ -1,15 +1,19 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"piaoji-server/internal/config"
 	"piaoji-server/internal/database"
+	"piaoji-server/internal/identity"
 	"piaoji-server/internal/middleware"
 	"piaoji-server/internal/model"
+	"piaoji-server/internal/phone"
 	"piaoji-server/internal/response"
+	"piaoji-server/internal/secret"
+	"piaoji-server/internal/wechat"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,22 +26,14 @@ func NewAuthHandler() *AuthHandler {
 
 // LoginRequest 登录请求
 type LoginRequest struct {
-	Code string `json:"code"` // 在 debug 模式下可以为空
+	Code       string `json:"code"`       // 在 debug 模式下可以为空
+	DeviceName string `json:"deviceName"` // 设备名称，显示在登录设备列表中
 }
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Token string              `json:"token"`
-	User  *model.UserResponse `json:"user"`
-}
-
-// WxSessionResponse 微信 code2session 响应
-type WxSessionResponse struct {
-	OpenID     string `json:"openid"`
-	SessionKey string `json:"session_key"`
-	UnionID    string `json:"unionid"`
-	ErrCode    int    `json:"errcode"`
-	ErrMsg     string `json:"errmsg"`
+	TokenPair
+	User *model.UserResponse `json:"user"`
 }
 
 // Login 微信登录
@@ -64,16 +60,16 @@ func (h *AuthHandler) Login(c *gin.Context) {
 				return
 			}
 
-			// 生成 JWT token
-			token, err := middleware.GenerateToken(user.ID, user.Openid)
+			// 创建会话并生成 token
+			tokens, err := issueTokens(c, &user, req.DeviceName)
 			if err != nil {
 				response.ServerError(c, "生成 token 失败")
 				return
 			}
 
 			response.Success(c, LoginResponse{
-				Token: token,
-				User:  user.ToResponse(),
+				TokenPair: *tokens,
+				User:      user.ToResponse(),
 			})
 			return
 		}
@@ -86,23 +82,21 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	var openid string
+	var wxSession *wechat.Session
 
 	// 开发模式：支持模拟登录
 	if config.Cfg.Server.Mode == "debug" && (req.Code == "test" || req.Code == "dev") {
 		openid = "dev_test_openid_" + req.Code
 	} else {
-		// 调用微信接口获取 openid
-		wxResp, err := h.code2Session(req.Code)
+		// 调用微信接口获取 openid 和 session_key
+		var err error
+		wxSession, err = wechat.Default().Code2Session(c.Request.Context(), req.Code)
 		if err != nil {
-			response.ServerError(c, "微信登录失败")
+			log.Printf("[AuthHandler] code2Session 失败: %v", err)
+			wechatError(c, err, "微信登录失败")
 			return
 		}
-
-		if wxResp.ErrCode != 0 {
-			response.BadRequest(c, fmt.Sprintf("微信登录失败: %s", wxResp.ErrMsg))
-			return
-		}
-		openid = wxResp.OpenID
+		openid = wxSession.OpenID
 	}
 
 	// 查找或创建用户
@@ -120,18 +114,28 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			response.ServerError(c, "创建用户失败")
 			return
 		}
+		if err := identity.Link(database.DB, user.ID, model.IdentityWechat, openid); err != nil {
+			log.Printf("[AuthHandler] 保存微信登录身份失败: user=%d, err=%v", user.ID, err)
+		}
 	}
 
-	// 生成 JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Openid)
+	// 保存 unionid 和 session_key，之后解密 getUserInfo 等开放数据时使用
+	if wxSession != nil {
+		if err := saveWechatSession(&user, wxSession); err != nil {
+			log.Printf("[AuthHandler] 保存 session_key 失败: user=%d, err=%v", user.ID, err)
+		}
+	}
+
+	// 创建会话并生成 token
+	tokens, err := issueTokens(c, &user, req.DeviceName)
 	if err != nil {
 		response.ServerError(c, "生成 token 失败")
 		return
 	}
 
 	response.Success(c, LoginResponse{
-		Token: token,
-		User:  user.ToResponse(),
+		TokenPair: *tokens,
+		User:      user.ToResponse(),
 	})
 }
 
@@ -145,34 +149,6 @@ func (h *AuthHandler) Verify(c *gin.Context) {
 	response.SuccessMessage(c, "token 有效")
 }
 
-// code2Session 调用微信 code2session 接口
-func (h *AuthHandler) code2Session(code string) (*WxSessionResponse, error) {
-	url := fmt.Sprintf(
-		"https://api.weixin.qq.com/sns/jscode2session?appid=%s&secret=%s&js_code=%s&grant_type=authorization_code",
-		config.Cfg.Wechat.AppID,
-		config.Cfg.Wechat.Secret,
-		code,
-	)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var wxResp WxSessionResponse
-	if err := json.Unmarshal(body, &wxResp); err != nil {
-		return nil, err
-	}
-
-	return &wxResp, nil
-}
-
 // BindPhoneRequest 绑定手机号请求
 type BindPhoneRequest struct {
 	Code string `json:"code" binding:"required"`
@@ -188,25 +164,94 @@ func (h *AuthHandler) BindPhone(c *gin.Context) {
 
 	userID := middleware.GetUserID(c)
 
-	// TODO: 调用微信接口获取手机号
-	// 这里需要通过 req.Code 调用微信的 getPhoneNumber 接口
-	// 获取到手机号后更新用户信息
-
-	// 模拟获取手机号（实际需要调用微信接口）
-	phone := "138****0000"
+	number, ok := h.phoneNumber(c, req.Code)
+	if !ok {
+		return
+	}
 
-	// 检查手机号是否已被绑定
-	var existingUser model.User
-	if err := database.DB.Where("phone = ? AND id != ?", phone, userID).First(&existingUser).Error; err == nil {
+	// 检查手机号是否已被绑定（按哈希比对，库中不保存明文）
+	owner, err := phone.Owner(database.DB, number)
+	if err != nil {
+		response.ServerError(c, "绑定手机号失败")
+		return
+	}
+	if owner != 0 && owner != userID {
 		response.BadRequest(c, "该手机号已被其他账号绑定")
 		return
 	}
 
 	// 更新用户手机号
-	if err := database.DB.Model(&model.User{}).Where("id = ?", userID).Update("phone", phone).Error; err != nil {
+	fields, err := phone.Fields(number)
+	if err != nil {
+		log.Printf("[AuthHandler] 加密手机号失败: %v", err)
 		response.ServerError(c, "绑定手机号失败")
 		return
 	}
+	if err := database.DB.Model(&model.User{}).Where("id = ?", userID).Updates(fields).Error; err != nil {
+		response.ServerError(c, "绑定手机号失败")
+		return
+	}
+	if err := identity.Link(database.DB, userID, model.IdentityPhone, secret.Hash(number)); err != nil {
+		log.Printf("[AuthHandler] 保存手机号登录身份失败: user=%d, err=%v", userID, err)
+	}
 
-	response.Success(c, gin.H{"phone": phone})
+	response.Success(c, gin.H{"phone": fields["phone"]})
+}
+
+// phoneNumber 用 getPhoneNumber 的 code 换取手机号，失败时写入响应并返回 false
+func (h *AuthHandler) phoneNumber(c *gin.Context, code string) (string, bool) {
+	// 开发模式：code=test 时使用固定的测试手机号
+	if config.Cfg.Server.Mode == "debug" && code == "test" {
+		return "13800000000", true
+	}
+
+	info, err := wechat.Default().GetPhoneNumber(c.Request.Context(), code)
+	if err != nil {
+		log.Printf("[AuthHandler] 获取手机号失败: %v", err)
+		wechatError(c, err, "获取手机号失败")
+		return "", false
+	}
+	if info.PhoneNumber == "" {
+		response.BadRequest(c, "获取手机号失败")
+		return "", false
+	}
+	return info.PhoneNumber, true
+}
+
+// saveWechatSession 保存 code2Session 返回的 unionid 和加密后的 session_key
+func saveWechatSession(user *model.User, s *wechat.Session) error {
+	cipher, err := secret.Encrypt(s.SessionKey)
+	if err != nil {
+		return err
+	}
+	fields := map[string]interface{}{"session_key_cipher": cipher}
+	if s.UnionID != "" {
+		fields["unionid"] = s.UnionID
+	}
+	if err := database.DB.Model(&model.User{}).Where("id = ?", user.ID).Updates(fields).Error; err != nil {
+		return err
+	}
+	user.SessionKeyCipher = &cipher
+	if s.UnionID != "" {
+		user.Unionid = &s.UnionID
+	}
+	return nil
+}
+
+// wechatError 按微信接口错误的类型写入响应：
+// 用户可处理的错误（code 失效、操作频繁等）返回 400，微信服务不可用返回 503，其他返回 500
+func wechatError(c *gin.Context, err error, fallback string) {
+	var wxErr *wechat.Error
+	switch {
+	case errors.As(err, &wxErr) && wxErr.UserMessage() != "":
+		if wxErr.Temporary() {
+			response.Error(c, http.StatusServiceUnavailable, wxErr.UserMessage())
+			return
+		}
+		response.BadRequest(c, fmt.Sprintf("%s: %s", fallback, wxErr.UserMessage()))
+	case errors.Is(err, wechat.ErrUnavailable):
+		response.Error(c, http.StatusServiceUnavailable, wechat.Message(err, fallback))
+	default:
+		response.ServerError(c, fallback)
+	}
 }
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/response"
+	"piaoji-server/internal/secret"
+	"piaoji-server/internal/wechat"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// 开放数据类型
+const (
+	DecryptTypeUserInfo  = "userInfo"  // wx.getUserInfo
+	DecryptTypeShareInfo = "shareInfo" // wx.getShareInfo，从群聊分享卡片打开时
+	DecryptTypeRunData   = "runData"   // wx.getWeRunData
+)
+
+// 与 users 表列长度一致
+const (
+	maxNickNameLen  = 64
+	maxAvatarURLLen = 512
+)
+
+// anonymousNickName 微信不再返回真实昵称时的占位昵称，不覆盖用户已有的昵称
+const anonymousNickName = "微信用户"
+
+// DecryptRequest 解密开放数据请求
+type DecryptRequest struct {
+	Type          string `json:"type" binding:"required"`
+	EncryptedData string `json:"encryptedData" binding:"required"`
+	IV            string `json:"iv" binding:"required"`
+	RawData       string `json:"rawData"`   // userInfo 必填，用于校验签名
+	Signature     string `json:"signature"` // userInfo 必填
+	TicketID      int64  `json:"ticketId"`  // shareInfo：分享卡片对应的票据，为 0 时只返回群标识
+}
+
+// wxUserInfo getUserInfo 解密后的数据
+type wxUserInfo struct {
+	OpenID    string `json:"openId"`
+	UnionID   string `json:"unionId"`
+	NickName  string `json:"nickName"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+// wxShareInfo getShareInfo 解密后的数据
+type wxShareInfo struct {
+	OpenGID string `json:"openGId"`
+}
+
+// wxRunData getWeRunData 解密后的数据
+type wxRunData struct {
+	StepInfoList []struct {
+		Timestamp int64 `json:"timestamp"`
+		Step      int   `json:"step"`
+	} `json:"stepInfoList"`
+}
+
+// Decrypt 用登录时保存的 session_key 解密小程序开放数据并应用：
+// userInfo 更新昵称和头像，shareInfo 记录票据从哪个群打开，runData 直接返回步数
+func (h *AuthHandler) Decrypt(c *gin.Context) {
+	var req DecryptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	var user model.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		response.NotFound(c, "用户不存在")
+		return
+	}
+	if user.SessionKeyCipher == nil {
+		response.BadRequest(c, wechat.ErrDecrypt.Error())
+		return
+	}
+	sessionKey, err := secret.Decrypt(*user.SessionKeyCipher)
+	if err != nil {
+		log.Printf("[AuthHandler] 解密 session_key 失败: user=%d, err=%v", userID, err)
+		response.BadRequest(c, wechat.ErrDecrypt.Error())
+		return
+	}
+
+	client := wechat.Default()
+	switch req.Type {
+	case DecryptTypeUserInfo:
+		if req.RawData == "" || req.Signature == "" {
+			response.BadRequest(c, "参数错误：缺少 rawData 或 signature")
+			return
+		}
+		if err := wechat.CheckSignature(req.RawData, sessionKey, req.Signature); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		var info wxUserInfo
+		if err := client.DecryptData(sessionKey, req.EncryptedData, req.IV, &info); err != nil {
+			decryptError(c, err)
+			return
+		}
+		h.applyUserInfo(c, &user, &info)
+
+	case DecryptTypeShareInfo:
+		var info wxShareInfo
+		if err := client.DecryptData(sessionKey, req.EncryptedData, req.IV, &info); err != nil {
+			decryptError(c, err)
+			return
+		}
+		if info.OpenGID == "" {
+			response.BadRequest(c, "缺少群标识")
+			return
+		}
+		if req.TicketID != 0 {
+			if err := recordShareOpen(req.TicketID, userID, info.OpenGID); err != nil {
+				log.Printf("[AuthHandler] 记录分享打开失败: ticket=%d, err=%v", req.TicketID, err)
+				response.ServerError(c, "记录分享失败")
+				return
+			}
+		}
+		response.Success(c, gin.H{"openGId": info.OpenGID})
+
+	case DecryptTypeRunData:
+		var data wxRunData
+		if err := client.DecryptData(sessionKey, req.EncryptedData, req.IV, &data); err != nil {
+			decryptError(c, err)
+			return
+		}
+		response.Success(c, data)
+
+	default:
+		response.BadRequest(c, "不支持的数据类型")
+	}
+}
+
+// applyUserInfo 用解密的用户信息更新昵称、头像和 unionid
+func (h *AuthHandler) applyUserInfo(c *gin.Context, user *model.User, info *wxUserInfo) {
+	if info.OpenID != "" && info.OpenID != user.Openid {
+		response.BadRequest(c, "数据不属于当前用户")
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if info.NickName != "" && info.NickName != anonymousNickName && utf8.RuneCountInString(info.NickName) <= maxNickNameLen {
+		updates["nick_name"] = info.NickName
+	}
+	if info.AvatarURL != "" && len(info.AvatarURL) <= maxAvatarURLLen {
+		updates["avatar_url"] = info.AvatarURL
+	}
+	if info.UnionID != "" && user.Unionid == nil {
+		updates["unionid"] = info.UnionID
+	}
+	if len(updates) > 0 {
+		if err := database.DB.Model(&model.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			response.ServerError(c, "更新失败")
+			return
+		}
+		database.DB.First(user, user.ID)
+	}
+	response.Success(c, user.ToResponse())
+}
+
+// recordShareOpen 记录用户从群聊分享卡片打开票据，重复打开不重复记录
+// 只记录可以分享的票据（非私密，或打开者就是票据所有者）；票据不存在、已删除或不可分享时
+// 不记录也不报错，调用方对这些情况返回相同的响应，避免被用来探测票据是否存在
+func recordShareOpen(ticketID, userID int64, openGID string) error {
+	var count int64
+	if err := database.DB.Model(&model.Ticket{}).
+		Where("id = ? AND is_deleted = ?", ticketID, false).
+		Where("privacy <> ? OR user_id = ?", model.PrivacyPrivate, userID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.TicketShareOpen{
+		TicketID: ticketID,
+		UserID:   userID,
+		OpenGID:  openGID,
+	}).Error
+}
+
+// decryptError 解密或校验失败返回 400，其他错误返回 500
+func decryptError(c *gin.Context, err error) {
+	if errors.Is(err, wechat.ErrDecrypt) || errors.Is(err, wechat.ErrWatermark) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	log.Printf("[AuthHandler] 解密开放数据失败: %v", err)
+	response.ServerError(c, "解密失败")
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/identity"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmailCodeRequest 发送邮箱验证码请求
+type EmailCodeRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// EmailVerifyRequest 提交邮箱验证码请求
+type EmailVerifyRequest struct {
+	Email      string `json:"email" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"deviceName"` // 仅登录使用
+}
+
+// SendLoginEmailCode 发送邮箱登录验证码
+// 邮箱未绑定账号时同样返回成功但不发送，避免被用来探测邮箱是否注册
+func (h *AuthHandler) SendLoginEmailCode(c *gin.Context) {
+	var req EmailCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	email, err := identity.NormalizeEmail(req.Email)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	id, err := identity.Find(database.DB, model.IdentityEmail, email)
+	if errors.Is(err, identity.ErrNotFound) {
+		response.SuccessMessage(c, "验证码已发送")
+		return
+	}
+	if err != nil {
+		response.ServerError(c, "发送验证码失败")
+		return
+	}
+	if err := identity.SendCode(c.Request.Context(), database.DB, email, model.EmailCodeLogin, id.UserID, c.ClientIP()); err != nil {
+		emailCodeError(c, err, "发送验证码失败")
+		return
+	}
+	response.SuccessMessage(c, "验证码已发送")
+}
+
+// EmailLogin 邮箱验证码登录，邮箱须已绑定账号
+func (h *AuthHandler) EmailLogin(c *gin.Context) {
+	var req EmailVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	email, err := identity.NormalizeEmail(req.Email)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	rec, err := identity.VerifyCode(database.DB, email, model.EmailCodeLogin, req.Code, 0)
+	if err != nil {
+		emailCodeError(c, err, "登录失败")
+		return
+	}
+	// 发送验证码之后邮箱可能已解绑或换绑
+	id, err := identity.Find(database.DB, model.IdentityEmail, email)
+	if err != nil || id.UserID != rec.UserID {
+		response.BadRequest(c, identity.ErrCodeInvalid.Error())
+		return
+	}
+
+	var user model.User
+	if err := database.DB.First(&user, id.UserID).Error; err != nil {
+		response.NotFound(c, "用户不存在")
+		return
+	}
+	tokens, err := issueTokens(c, &user, req.DeviceName)
+	if err != nil {
+		response.ServerError(c, "生成 token 失败")
+		return
+	}
+	resp := user.ToResponse()
+	resp.Email = email
+	response.Success(c, LoginResponse{
+		TokenPair: *tokens,
+		User:      resp,
+	})
+}
+
+// SendBindEmailCode 发送绑定邮箱的验证码
+func (h *AuthHandler) SendBindEmailCode(c *gin.Context) {
+	var req EmailCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	email, err := identity.NormalizeEmail(req.Email)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	id, err := identity.Find(database.DB, model.IdentityEmail, email)
+	if err == nil {
+		if id.UserID == userID {
+			response.BadRequest(c, "已绑定该邮箱")
+		} else {
+			response.BadRequest(c, "该邮箱已被其他账号绑定")
+		}
+		return
+	}
+	if !errors.Is(err, identity.ErrNotFound) {
+		response.ServerError(c, "发送验证码失败")
+		return
+	}
+
+	if err := identity.SendCode(c.Request.Context(), database.DB, email, model.EmailCodeBind, userID, c.ClientIP()); err != nil {
+		emailCodeError(c, err, "发送验证码失败")
+		return
+	}
+	response.SuccessMessage(c, "验证码已发送")
+}
+
+// BindEmail 用验证码绑定邮箱，已绑定其他邮箱时替换
+func (h *AuthHandler) BindEmail(c *gin.Context) {
+	var req EmailVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	email, err := identity.NormalizeEmail(req.Email)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	if _, err := identity.VerifyCode(database.DB, email, model.EmailCodeBind, req.Code, userID); err != nil {
+		emailCodeError(c, err, "绑定邮箱失败")
+		return
+	}
+	if err := identity.Link(database.DB, userID, model.IdentityEmail, email); err != nil {
+		if errors.Is(err, identity.ErrTaken) {
+			response.BadRequest(c, "该邮箱已被其他账号绑定")
+			return
+		}
+		response.ServerError(c, "绑定邮箱失败")
+		return
+	}
+	response.Success(c, gin.H{"email": email})
+}
+
+// Identities 当前用户的登录身份（微信、手机号、邮箱）
+func (h *AuthHandler) Identities(c *gin.Context) {
+	var user model.User
+	if err := database.DB.First(&user, middleware.GetUserID(c)).Error; err != nil {
+		response.NotFound(c, "用户不存在")
+		return
+	}
+	ids, err := identity.List(database.DB, &user)
+	if err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	response.Success(c, gin.H{"list": ids})
+}
+
+// emailCodeError 按验证码错误的类型写入响应：发送太频繁返回 429，
+// 邮箱或验证码错误返回 400，其他错误（如邮件发送失败）返回 500
+func emailCodeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, identity.ErrTooFrequent):
+		response.Error(c, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, identity.ErrInvalidEmail),
+		errors.Is(err, identity.ErrCodeInvalid),
+		errors.Is(err, identity.ErrTooManyAttempts):
+		response.BadRequest(c, err.Error())
+	default:
+		log.Printf("[AuthHandler] %s: %v", fallback, err)
+		response.ServerError(c, fallback)
+	}
+}
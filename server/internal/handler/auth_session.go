@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/response"
+	"piaoji-server/internal/session"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenPair 登录和刷新返回的 token
+type TokenPair struct {
+	Token        string `json:"token"`        // access token，放在 Authorization: Bearer 中
+	RefreshToken string `json:"refreshToken"` // 用于换取新的 token，每次刷新后更换
+	ExpiresIn    int64  `json:"expiresIn"`    // access token 有效期（秒）
+}
+
+// RefreshRequest 刷新 token 请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// issueTokens 为用户创建新会话并生成 token
+func issueTokens(c *gin.Context, user *model.User, deviceName string) (*TokenPair, error) {
+	s, refreshToken, err := session.Create(database.DB, user.ID, session.Device{
+		Name:      deviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newTokenPair(user, s.ID, refreshToken)
+}
+
+func newTokenPair(user *model.User, sessionID int64, refreshToken string) (*TokenPair, error) {
+	token, err := middleware.GenerateToken(user.ID, user.Openid, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(config.Cfg.JWT.GetAccessExpire().Seconds()),
+	}, nil
+}
+
+// Refresh 用 refresh token 换取新的 access token 和 refresh token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	s, refreshToken, err := session.Rotate(database.DB, req.RefreshToken, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, session.ErrInvalid) {
+			response.Unauthorized(c, err.Error())
+			return
+		}
+		log.Printf("[AuthHandler] 刷新 token 失败: %v", err)
+		response.ServerError(c, "刷新 token 失败")
+		return
+	}
+
+	var user model.User
+	if err := database.DB.First(&user, s.UserID).Error; err != nil {
+		response.Unauthorized(c, session.ErrInvalid.Error())
+		return
+	}
+	tokens, err := newTokenPair(&user, s.ID, refreshToken)
+	if err != nil {
+		response.ServerError(c, "生成 token 失败")
+		return
+	}
+	response.Success(c, tokens)
+}
+
+// Logout 退出当前会话，access token 和 refresh token 立即失效
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID := middleware.GetSessionID(c)
+	if sessionID == 0 {
+		response.SuccessMessage(c, "已退出登录")
+		return
+	}
+	err := session.Revoke(database.DB, middleware.GetUserID(c), sessionID)
+	if err != nil && !errors.Is(err, session.ErrNotFound) {
+		response.ServerError(c, "退出登录失败")
+		return
+	}
+	response.SuccessMessage(c, "已退出登录")
+}
+
+// Sessions 当前用户已登录的设备
+func (h *AuthHandler) Sessions(c *gin.Context) {
+	sessions, err := session.List(database.DB, middleware.GetUserID(c))
+	if err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	current := middleware.GetSessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	response.Success(c, gin.H{"list": sessions})
+}
+
+// RevokeSession 让指定设备下线
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "无效的 ID")
+		return
+	}
+	if err := session.Revoke(database.DB, middleware.GetUserID(c), id); err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			response.NotFound(c, err.Error())
+			return
+		}
+		response.ServerError(c, "操作失败")
+		return
+	}
+	response.SuccessMessage(c, "已下线")
+}
+
+// RevokeOtherSessions 让除当前设备以外的所有设备下线
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	n, err := session.RevokeOthers(database.DB, middleware.GetUserID(c), middleware.GetSessionID(c))
+	if err != nil {
+		response.ServerError(c, "操作失败")
+		return
+	}
+	response.Success(c, gin.H{"revoked": n})
+}
@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/response"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	icsTimeFormat      = "20060102T150405Z"
+	icsDateFormat      = "20060102"
+	icsLineLimit       = 75            // RFC 5545 每行最多 75 字节
+	icsDefaultDuration = 2 * time.Hour // 无结束时间时的默认时长
+	calendarTokenBytes = 24
+)
+
+type CalendarHandler struct{}
+
+func NewCalendarHandler() *CalendarHandler {
+	return &CalendarHandler{}
+}
+
+// CalendarTokenResponse 日历订阅地址响应
+type CalendarTokenResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// Feed 输出用户的 iCalendar 订阅（无需登录，通过 URL 中的密钥识别用户）
+func (h *CalendarHandler) Feed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("file"), ".ics")
+	if token == "" || token == c.Param("file") {
+		response.NotFound(c, "日历不存在")
+		return
+	}
+
+	var user model.User
+	if err := database.DB.Where("calendar_token = ?", token).First(&user).Error; err != nil {
+		response.NotFound(c, "日历不存在")
+		return
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="piaoji.ics"`)
+	c.Status(200)
+
+	if err := writeCalendar(c.Writer, user.ID); err != nil {
+		log.Printf("[CalendarHandler] 生成日历失败: UserID=%d, err=%v", user.ID, err)
+	}
+}
+
+// ResetToken 生成（或重新生成）日历订阅密钥，旧地址立即失效
+func (h *CalendarHandler) ResetToken(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	token, err := secureToken(calendarTokenBytes)
+	if err != nil {
+		response.ServerError(c, "生成订阅地址失败")
+		return
+	}
+
+	if err := database.DB.Model(&model.User{}).Where("id = ?", userID).Update("calendar_token", token).Error; err != nil {
+		response.ServerError(c, "生成订阅地址失败")
+		return
+	}
+
+	response.Success(c, CalendarTokenResponse{
+		Token: token,
+		URL:   calendarURL(c, token),
+	})
+}
+
+// RevokeToken 关闭日历订阅
+func (h *CalendarHandler) RevokeToken(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	if err := database.DB.Model(&model.User{}).Where("id = ?", userID).Update("calendar_token", nil).Error; err != nil {
+		response.ServerError(c, "关闭订阅失败")
+		return
+	}
+
+	response.SuccessMessage(c, "已关闭日历订阅")
+}
+
+// calendarURL 根据当前请求拼出订阅地址
+func calendarURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/api/calendar/%s.ics", scheme, c.Request.Host, token)
+}
+
+// secureToken 生成 n 字节的随机十六进制字符串
+func secureToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeCalendar 写出 VCALENDAR，每张有日期且未删除的票据对应一个 VEVENT
+func writeCalendar(w io.Writer, userID int64) error {
+	bw := bufio.NewWriter(w)
+	iw := &icsWriter{w: bw}
+
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:-//piaoji//calendar//CN")
+	iw.line("CALSCALE:GREGORIAN")
+	iw.prop("X-WR-CALNAME", "票迹")
+
+	var batch []model.Ticket
+	err := database.DB.Where("user_id = ? AND is_deleted = ? AND date IS NOT NULL", userID, false).
+		Order("id ASC").
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				writeEvent(iw, &batch[i])
+			}
+			return iw.err
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	iw.line("END:VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return bw.Flush()
+}
+
+// writeEvent 写出单张票据的 VEVENT
+func writeEvent(iw *icsWriter, t *model.Ticket) {
+	var loc model.Location
+	if len(t.Location) > 0 {
+		json.Unmarshal(t.Location, &loc)
+	}
+
+	iw.line("BEGIN:VEVENT")
+	iw.prop("UID", t.TicketClientID+"@piaoji")
+	iw.line("DTSTAMP:" + t.UpdatedAt.UTC().Format(icsTimeFormat))
+
+	start, allDay := eventStart(t)
+	if allDay {
+		iw.line("DTSTART;VALUE=DATE:" + start.Format(icsDateFormat))
+		iw.line("DTEND;VALUE=DATE:" + start.AddDate(0, 0, 1).Format(icsDateFormat))
+	} else {
+		iw.line("DTSTART:" + start.UTC().Format(icsTimeFormat))
+		iw.line("DTEND:" + start.Add(icsDefaultDuration).UTC().Format(icsTimeFormat))
+	}
+
+	iw.prop("SUMMARY", eventSummary(t, &loc))
+	if location := eventLocation(&loc); location != "" {
+		iw.prop("LOCATION", location)
+	}
+	if desc := eventDescription(t); desc != "" {
+		iw.prop("DESCRIPTION", desc)
+	}
+	if loc.Type != "route" && loc.Coordinate != nil {
+		iw.line(fmt.Sprintf("GEO:%f;%f", loc.Coordinate.Latitude, loc.Coordinate.Longitude))
+	}
+	iw.prop("CATEGORIES", string(t.Type))
+	iw.line("END:VEVENT")
+}
+
+// eventStart 计算开始时间
+// 电影票优先使用场次时间；日期为零点（客户端只选日期时传 UTC 零点）且无场次时按全天事件处理
+func eventStart(t *model.Ticket) (time.Time, bool) {
+	date := t.Date.In(time.Local)
+	if utc := t.Date.UTC(); isMidnight(utc) {
+		date = time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.Local)
+	}
+	if t.Type == model.TicketTypeMovie && t.Showtime != nil {
+		if st, err := time.Parse("15:04", strings.TrimSpace(*t.Showtime)); err == nil {
+			return time.Date(date.Year(), date.Month(), date.Day(), st.Hour(), st.Minute(), 0, 0, time.Local), false
+		}
+	}
+	return date, isMidnight(date)
+}
+
+func isMidnight(t time.Time) bool {
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0
+}
+
+// eventSummary 标题：火车/飞机为「车次 出发 → 到达」，其余为票据名称
+func eventSummary(t *model.Ticket, loc *model.Location) string {
+	if t.Type != model.TicketTypeTrain && t.Type != model.TicketTypeFlight {
+		return t.Name
+	}
+
+	var parts []string
+	if t.TripNumber != nil && *t.TripNumber != "" {
+		parts = append(parts, *t.TripNumber)
+	}
+	if loc.Departure != nil && loc.Arrival != nil {
+		parts = append(parts, routePointName(loc.Departure)+" → "+routePointName(loc.Arrival))
+	}
+	if len(parts) == 0 {
+		return t.Name
+	}
+	return strings.Join(parts, " ")
+}
+
+// eventLocation 地点：行程取出发站，单地点取地址或城市
+func eventLocation(loc *model.Location) string {
+	if loc.Departure != nil {
+		return routePointName(loc.Departure)
+	}
+	if loc.Address != "" {
+		return loc.Address
+	}
+	return loc.City
+}
+
+// eventDescription 描述：影厅/座位/版本/场次等补充信息及备注
+func eventDescription(t *model.Ticket) string {
+	var lines []string
+	add := func(label string, value *string) {
+		if value != nil && *value != "" {
+			lines = append(lines, label+": "+*value)
+		}
+	}
+
+	add("影厅", t.Hall)
+	add("座位", t.Seat)
+	add("版本", t.Version)
+	add("场次", t.Showtime)
+	add("备注", t.Note)
+	return strings.Join(lines, "\n")
+}
+
+func routePointName(p *model.RoutePoint) string {
+	if p.Station != "" {
+		return p.Station
+	}
+	return p.City
+}
+
+// icsWriter 负责 iCalendar 的转义和折行，记录第一个写入错误
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+// prop 写出需要转义的文本属性
+func (iw *icsWriter) prop(name, value string) {
+	iw.line(name + ":" + icsEscape(value))
+}
+
+// line 写出一行，超过 75 字节时按 RFC 5545 折行（不拆分 UTF-8 字符）
+func (iw *icsWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > icsLineLimit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	_, iw.err = io.WriteString(iw.w, b.String())
+}
+
+func icsEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/response"
+	"piaoji-server/internal/storage"
+	"piaoji-server/internal/tagging"
+	"piaoji-server/internal/upload"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 导出时每批从数据库读取的票据数
+const exportBatchSize = 200
+
+type ExportHandler struct{}
+
+func NewExportHandler() *ExportHandler {
+	return &ExportHandler{}
+}
+
+// Export 导出用户数据
+// format=json（默认）/ csv / zip，数据边读边写，不在内存中缓存全部票据
+func (h *ExportHandler) Export(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	format := c.DefaultQuery("format", "json")
+	filename := fmt.Sprintf("piaoji-export-%s", time.Now().Format("20060102"))
+
+	var err error
+	switch format {
+	case "json":
+		setAttachment(c, "application/json; charset=utf-8", filename+".json")
+		err = writeExportJSON(c.Writer, userID, nil)
+	case "csv":
+		setAttachment(c, "text/csv; charset=utf-8", filename+".csv")
+		err = writeExportCSV(c.Writer, userID)
+	case "zip":
+		setAttachment(c, "application/zip", filename+".zip")
+		err = h.writeExportZip(c, userID)
+	default:
+		response.BadRequest(c, "不支持的导出格式")
+		return
+	}
+
+	// 响应已经开始写出，只能记录日志
+	if err != nil {
+		log.Printf("[ExportHandler] 导出失败: UserID=%d, format=%s, err=%v", userID, format, err)
+	}
+}
+
+func setAttachment(c *gin.Context, contentType, filename string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(200)
+}
+
+// eachExportTicket 分批遍历用户未删除的票据
+func eachExportTicket(userID int64, fn func(t *model.Ticket) error) error {
+	var batch []model.Ticket
+	return database.DB.Where("user_id = ? AND is_deleted = ?", userID, false).
+		Order("id ASC").
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			if err := tagging.Fill(database.DB, batch); err != nil {
+				return err
+			}
+			if err := photo.Fill(database.DB, batch); err != nil {
+				return err
+			}
+			for i := range batch {
+				if err := fn(&batch[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// toExportTicket 转换为导出格式
+func toExportTicket(t *model.Ticket) model.ExportTicket {
+	et := model.ExportTicket{
+		CreateTicketRequest: model.CreateTicketRequest{
+			TicketClientID: t.TicketClientID,
+			Name:           t.Name,
+			Type:           t.Type,
+			TripNumber:     t.TripNumber,
+			Seat:           t.Seat,
+			Hall:           t.Hall,
+			Version:        t.Version,
+			Showtime:       t.Showtime,
+			Tags:           t.Tags,
+			Price:          t.Price,
+			Photo:          t.Photo,
+			Photos:         make([]model.TicketPhotoInput, len(t.Photos)),
+			Note:           t.Note,
+			Privacy:        t.Privacy,
+		},
+		CreatedAt: t.CreatedAt.Format(time.RFC3339),
+	}
+	for i, p := range t.Photos {
+		et.Photos[i] = model.TicketPhotoInput{URL: p.URL, Caption: p.Caption, Width: p.Width, Height: p.Height, Bytes: p.Bytes}
+	}
+	if t.Date != nil {
+		date := t.Date.Format(time.RFC3339)
+		et.Date = &date
+	}
+	if len(t.Location) > 0 {
+		var loc model.Location
+		if err := json.Unmarshal(t.Location, &loc); err == nil {
+			et.Location = &loc
+		}
+	}
+	return et
+}
+
+// writeExportJSON 以流式方式写出 JSON 导出
+// photoFile 不为空时用于填充 zip 包内各照片的路径，返回空字符串表示该照片不在包内
+func writeExportJSON(w io.Writer, userID int64, photoFile func(t *model.Ticket, i int) string) error {
+	var tags []model.Tag
+	if err := database.DB.Where("type = ? AND user_id = ?", model.TagTypeCustom, userID).
+		Order("id ASC").Find(&tags).Error; err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(tags))
+	for _, tag := range tags {
+		names[tag.ID] = tag.Name
+	}
+	exportTags := make([]model.ExportTag, len(tags))
+	for i, tag := range tags {
+		exportTags[i] = model.ExportTag{Name: tag.Name, Color: tag.Color, Icon: tag.Icon, Group: tag.Group}
+		if tag.ParentID != nil {
+			exportTags[i].Parent = names[*tag.ParentID]
+		}
+	}
+	tagsJSON, _ := json.Marshal(exportTags)
+
+	if _, err := fmt.Fprintf(w, `{"version":%d,"exportedAt":%q,"tags":%s,"tickets":[`,
+		model.ExportVersion, time.Now().Format(time.RFC3339), tagsJSON); err != nil {
+		return err
+	}
+
+	first := true
+	err := eachExportTicket(userID, func(t *model.Ticket) error {
+		et := toExportTicket(t)
+		if photoFile != nil {
+			for i := range et.Photos {
+				et.Photos[i].File = photoFile(t, i)
+			}
+			if len(et.Photos) > 0 {
+				et.PhotoFile = et.Photos[0].File
+			}
+		}
+		data, err := json.Marshal(et)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("]}"))
+	return err
+}
+
+// writeExportCSV 以流式方式写出 CSV 导出，location 展开为多列
+func writeExportCSV(w io.Writer, userID int64) error {
+	// UTF-8 BOM，便于 Excel 正确识别中文
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(model.CSVColumns); err != nil {
+		return err
+	}
+
+	err := eachExportTicket(userID, func(t *model.Ticket) error {
+		return cw.Write(ticketCSVRow(toExportTicket(t)))
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ticketCSVRow 按 model.CSVColumns 的顺序生成一行
+func ticketCSVRow(et model.ExportTicket) []string {
+	str := func(p *string) string {
+		if p == nil {
+			return ""
+		}
+		return *p
+	}
+	coord := func(c *model.Coordinate) (string, string) {
+		if c == nil {
+			return "", ""
+		}
+		return strconv.FormatFloat(c.Latitude, 'f', -1, 64), strconv.FormatFloat(c.Longitude, 'f', -1, 64)
+	}
+
+	var price string
+	if et.Price != nil {
+		price = strconv.FormatFloat(*et.Price, 'f', 2, 64)
+	}
+
+	var locType, city, address, lat, lng, depCity, depStation, arrCity, arrStation string
+	if loc := et.Location; loc != nil {
+		locType, city, address = loc.Type, loc.City, loc.Address
+		lat, lng = coord(loc.Coordinate)
+		if loc.Departure != nil {
+			depCity, depStation = loc.Departure.City, loc.Departure.Station
+		}
+		if loc.Arrival != nil {
+			arrCity, arrStation = loc.Arrival.City, loc.Arrival.Station
+		}
+	}
+
+	return []string{
+		et.TicketClientID, et.Name, string(et.Type), str(et.TripNumber), str(et.Seat), str(et.Hall),
+		str(et.Version), str(et.Showtime),
+		strings.Join(et.Tags, model.CSVTagSeparator), price, str(et.Photo), str(et.Date),
+		locType, city, address, lat, lng,
+		depCity, depStation, arrCity, arrStation,
+		str(et.Note), string(et.Privacy), et.CreatedAt,
+	}
+}
+
+// writeExportZip 写出 zip 包：manifest.json（同 JSON 导出）+ photos/ 下的原图
+// 不是本账号上传的照片不下载，与读取失败的照片一起记录在 missing.json 中
+func (h *ExportHandler) writeExportZip(c *gin.Context, userID int64) error {
+	zw := zip.NewWriter(c.Writer)
+
+	type missingPhoto struct {
+		TicketClientID string `json:"ticketClientId"`
+		Photo          string `json:"photo"`
+		Error          string `json:"error"`
+	}
+	var missing []missingPhoto
+	written := map[string]bool{} // 已写入 zip 包的照片路径
+
+	err := eachExportTicket(userID, func(t *model.Ticket) error {
+		for i, p := range t.Photos {
+			if err := c.Request.Context().Err(); err != nil {
+				return err
+			}
+
+			// 只读取当前用户上传目录下的对象，其他地址（旧数据、导入的外部地址）不下载，记为缺失
+			key, ok := storage.KeyFromURL(p.URL)
+			if !ok || !strings.HasPrefix(key, upload.KeyPrefix(userID)) {
+				missing = append(missing, missingPhoto{t.TicketClientID, p.URL, "不是本账号上传的照片"})
+				continue
+			}
+			body, err := storage.Current().Open(c.Request.Context(), key)
+			if err != nil {
+				missing = append(missing, missingPhoto{t.TicketClientID, p.URL, err.Error()})
+				continue
+			}
+			err = func() error {
+				defer body.Close()
+				name := exportPhotoFile(t, i)
+				fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: p.CreatedAt})
+				if err != nil {
+					return err
+				}
+				if _, err := io.Copy(fw, body); err != nil {
+					return err
+				}
+				written[name] = true
+				return nil
+			}()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		fw, err := zw.Create("missing.json")
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(fw).Encode(missing); err != nil {
+			return err
+		}
+	}
+
+	// 清单在照片之后写出，缺失的照片不带路径，避免指向包内不存在的文件
+	manifest, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	err = writeExportJSON(manifest, userID, func(t *model.Ticket, i int) string {
+		if name := exportPhotoFile(t, i); written[name] {
+			return name
+		}
+		return ""
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// exportPhotoFile zip 包内第 i 张照片的相对路径，封面为 photos/<id>.jpg，其余为 photos/<id>_<序号>.jpg
+func exportPhotoFile(t *model.Ticket, i int) string {
+	url := t.Photos[i].URL
+	ext := path.Ext(strings.SplitN(url, "?", 2)[0])
+	if ext == "" || len(ext) > 5 {
+		ext = ".jpg"
+	}
+	if i == 0 {
+		return fmt.Sprintf("photos/%d%s", t.ID, ext)
+	}
+	return fmt.Sprintf("photos/%d_%d%s", t.ID, i+1, ext)
+}
@@ -0,0 +1,539 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/response"
+	"piaoji-server/internal/tagging"
+	"piaoji-server/internal/upload"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+const (
+	maxImportSize  = 10 << 20 // 导入文件最大 10MB
+	maxImportRows  = 5000     // 单次最多导入的票据数
+	maxTagNameLen  = 32       // 与 tags.name 列长度一致
+	importQueryLen = 500      // 查询已存在 ticketClientId 时每批的数量
+)
+
+type ImportHandler struct{}
+
+func NewImportHandler() *ImportHandler {
+	return &ImportHandler{}
+}
+
+// importRow 解析后的单行数据，err 不为空表示该行解析失败
+type importRow struct {
+	ticket model.ExportTicket
+	err    error
+}
+
+// Import 从 JSON / CSV 导入票据
+// 文件可通过 multipart 的 file 字段或直接作为请求体上传；dryRun=true 时只返回处理结果，不写入数据库
+func (h *ImportHandler) Import(c *gin.Context) {
+	dryRun := c.Query("dryRun") == "true"
+
+	data, filename, err := readImportPayload(c)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = detectImportFormat(filename, data)
+	}
+
+	var tagDefs []model.ExportTag
+	var rows []importRow
+	switch format {
+	case "json":
+		tagDefs, rows, err = parseImportJSON(data)
+	case "csv":
+		rows, err = parseImportCSV(data)
+	default:
+		err = errors.New("不支持的导入格式")
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		response.BadRequest(c, "文件中没有票据")
+		return
+	}
+	if len(rows) > maxImportRows {
+		response.BadRequest(c, fmt.Sprintf("单次最多导入 %d 张票据", maxImportRows))
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+
+	var user model.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		response.NotFound(c, "用户不存在")
+		return
+	}
+
+	// 补全 ticketClientId 并查询已存在的票据
+	for i := range rows {
+		if rows[i].err == nil && rows[i].ticket.TicketClientID == "" {
+			rows[i].ticket.TicketClientID = importClientID(&rows[i].ticket.CreateTicketRequest)
+		}
+	}
+	owners, err := existingClientIDs(rows)
+	if err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+
+	knownTags, err := userTagNames(userID)
+	if err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+
+	resp := model.ImportResponse{DryRun: dryRun, TagsCreated: []string{}, Rows: make([]model.ImportRowResult, 0, len(rows))}
+	var tickets []model.Ticket
+	var newTags []model.Tag
+	var uploads []model.Upload // 待补记的上传
+	seen := make(map[string]bool)
+	photosLeft := user.PhotoQuota - user.PhotoCount
+	photos := 0
+
+	// 文件中附带的自定义标签定义优先使用其颜色和图标
+	defs := make(map[string]model.ExportTag, len(tagDefs))
+	for _, def := range tagDefs {
+		defs[tagging.Key(def.Name)] = def
+	}
+	addTag := func(name string) {
+		if knownTags[tagging.Key(name)] {
+			return
+		}
+		knownTags[tagging.Key(name)] = true
+		tag := model.Tag{Name: name, Type: model.TagTypeCustom, UserID: &userID, Color: "#07c160"}
+		if def, ok := defs[tagging.Key(name)]; ok {
+			if def.Color != "" {
+				tag.Color = def.Color
+			}
+			tag.Icon = def.Icon
+			tag.Group = def.Group
+		}
+		newTags = append(newTags, tag)
+		resp.TagsCreated = append(resp.TagsCreated, name)
+	}
+	for _, def := range tagDefs {
+		if def.Name != "" && utf8.RuneCountInString(def.Name) <= maxTagNameLen {
+			addTag(def.Name)
+		}
+	}
+
+	for i, row := range rows {
+		req := row.ticket.CreateTicketRequest
+		result := model.ImportRowResult{Row: i + 1, TicketClientID: req.TicketClientID, Name: req.Name}
+
+		err := row.err
+		if err == nil {
+			err = validateImportRow(&req)
+		}
+		rowPhotos := len(photo.Inputs(req.Photo, req.Photos))
+		if err == nil && rowPhotos > 0 && photos+rowPhotos > photosLeft {
+			err = errors.New("已达到照片上限")
+		}
+
+		switch owner, exists := owners[req.TicketClientID]; {
+		case err != nil:
+			result.Status = model.ImportError
+			result.Error = err.Error()
+			resp.Failed++
+		case exists && owner != userID:
+			result.Status = model.ImportError
+			result.Error = "ticketClientId 已被占用"
+			resp.Failed++
+		case exists || seen[req.TicketClientID]:
+			result.Status = model.ImportSkip
+			result.Error = "票据已存在"
+			resp.Skipped++
+		default:
+			// 与 Create 一致，照片须是当前用户已完成的上传，不能引用其他用户或外部的地址
+			// dryRun 时不写入任何内容，存储中存在但还没有记录的上传在导入时才补记
+			missing, err := upload.Check(c.Request.Context(), database.DB, userID, photo.URLs(photo.Inputs(req.Photo, req.Photos)))
+			if err != nil {
+				if !errors.Is(err, upload.ErrNotConfirmed) {
+					log.Printf("[ImportHandler] 校验照片上传失败: UserID=%d, err=%v", userID, err)
+					response.ServerError(c, "校验照片失败")
+					return
+				}
+				result.Status = model.ImportError
+				result.Error = err.Error()
+				resp.Failed++
+				break
+			}
+			seen[req.TicketClientID] = true
+			uploads = append(uploads, missing...)
+			for _, tag := range tagging.Normalize(req.Tags) {
+				addTag(tag)
+			}
+			photos += rowPhotos
+			tickets = append(tickets, buildTicket(userID, &req))
+			result.Status = model.ImportCreate
+			resp.Created++
+		}
+		resp.Rows = append(resp.Rows, result)
+	}
+
+	if dryRun || len(tickets) == 0 {
+		response.Success(c, resp)
+		return
+	}
+
+	if err := upload.RecordAll(database.DB, uploads); err != nil {
+		log.Printf("[ImportHandler] 记录照片上传失败: UserID=%d, err=%v", userID, err)
+		response.ServerError(c, "导入失败")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(newTags) > 0 {
+			if err := tx.Create(&newTags).Error; err != nil {
+				return err
+			}
+			if err := linkImportedTags(tx, userID, newTags, defs); err != nil {
+				return err
+			}
+		}
+		if err := tx.CreateInBatches(&tickets, 100).Error; err != nil {
+			return err
+		}
+		if err := photo.Attach(tx, tickets); err != nil {
+			return err
+		}
+		if err := tagging.Attach(tx, userID, tickets); err != nil {
+			return err
+		}
+		// 与 Create 保持一致，同步增加用户统计
+		return tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"ticket_count": gorm.Expr("ticket_count + ?", len(tickets)),
+			"photo_count":  gorm.Expr("photo_count + ?", photos),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("[ImportHandler] 导入失败: UserID=%d, err=%v", userID, err)
+		response.ServerError(c, "导入失败")
+		return
+	}
+
+	response.Success(c, resp)
+}
+
+// readImportPayload 读取 multipart 的 file 字段，没有时读取整个请求体
+func readImportPayload(c *gin.Context) ([]byte, string, error) {
+	// 预留 1MB 给 multipart 边界等开销
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+1<<20)
+
+	var r io.Reader = c.Request.Body
+	filename := ""
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("请上传导入文件")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, "", errors.New("读取文件失败")
+		}
+		defer f.Close()
+		r, filename = f, fh.Filename
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxImportSize+1))
+	if err != nil {
+		return nil, "", errors.New("读取文件失败")
+	}
+	if len(data) > maxImportSize {
+		return nil, "", errors.New("导入文件不能超过 10MB")
+	}
+	return bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")), filename, nil
+}
+
+// detectImportFormat 根据文件扩展名或内容判断格式
+func detectImportFormat(filename string, data []byte) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".json":
+		return "json"
+	case ".csv":
+		return "csv"
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return "json"
+	}
+	return "csv"
+}
+
+// parseImportJSON 解析 JSON 导出文件，也接受只包含票据数组的文件
+func parseImportJSON(data []byte) ([]model.ExportTag, []importRow, error) {
+	var file model.ExportFile
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &file.Tickets); err != nil {
+			return nil, nil, errors.New("JSON 格式错误")
+		}
+	} else if err := json.Unmarshal(trimmed, &file); err != nil {
+		return nil, nil, errors.New("JSON 格式错误")
+	}
+	if file.Version > model.ExportVersion {
+		return nil, nil, errors.New("导入文件版本过新，请升级后再试")
+	}
+
+	rows := make([]importRow, len(file.Tickets))
+	for i, t := range file.Tickets {
+		rows[i] = importRow{ticket: t}
+	}
+	return file.Tags, rows, nil
+}
+
+// parseImportCSV 解析 CSV，按表头名称对应 model.CSVColumns 中的列，顺序不限
+func parseImportCSV(data []byte) ([]importRow, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("CSV 格式错误：缺少表头")
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, errors.New("CSV 缺少 name 列")
+	}
+	if _, ok := index["type"]; !ok {
+		return nil, errors.New("CSV 缺少 type 列")
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV 格式错误: %v", err)
+		}
+		get := func(col string) string {
+			if i, ok := index[col]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		t, err := csvRowToTicket(get)
+		rows = append(rows, importRow{ticket: t, err: err})
+	}
+	return rows, nil
+}
+
+// csvRowToTicket 将 CSV 行还原为导出票据，是 ticketCSVRow 的逆过程
+func csvRowToTicket(get func(col string) string) (model.ExportTicket, error) {
+	opt := func(col string) *string {
+		if v := get(col); v != "" {
+			return &v
+		}
+		return nil
+	}
+
+	et := model.ExportTicket{
+		CreateTicketRequest: model.CreateTicketRequest{
+			TicketClientID: get("ticketClientId"),
+			Name:           get("name"),
+			Type:           model.TicketType(get("type")),
+			TripNumber:     opt("tripNumber"),
+			Seat:           opt("seat"),
+			Hall:           opt("hall"),
+			Version:        opt("version"),
+			Showtime:       opt("showtime"),
+			Photo:          opt("photo"),
+			Date:           opt("date"),
+			Note:           opt("note"),
+			Privacy:        model.PrivacyLevel(get("privacy")),
+		},
+		CreatedAt: get("createdAt"),
+	}
+
+	if tags := get("tags"); tags != "" {
+		for _, tag := range strings.Split(tags, model.CSVTagSeparator) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				et.Tags = append(et.Tags, tag)
+			}
+		}
+	}
+
+	if v := get("price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return et, errors.New("价格格式错误")
+		}
+		et.Price = &price
+	}
+
+	loc := model.Location{
+		Type:    get("locationType"),
+		City:    get("city"),
+		Address: get("address"),
+	}
+	if lat, lng := get("latitude"), get("longitude"); lat != "" && lng != "" {
+		latF, err1 := strconv.ParseFloat(lat, 64)
+		lngF, err2 := strconv.ParseFloat(lng, 64)
+		if err1 != nil || err2 != nil {
+			return et, errors.New("经纬度格式错误")
+		}
+		loc.Coordinate = &model.Coordinate{Latitude: latF, Longitude: lngF}
+	}
+	if city, station := get("departureCity"), get("departureStation"); city != "" || station != "" {
+		loc.Departure = &model.RoutePoint{City: city, Station: station}
+	}
+	if city, station := get("arrivalCity"), get("arrivalStation"); city != "" || station != "" {
+		loc.Arrival = &model.RoutePoint{City: city, Station: station}
+	}
+	if loc.Type == "" {
+		if loc.Departure != nil || loc.Arrival != nil {
+			loc.Type = "route"
+		} else if loc.City != "" || loc.Address != "" || loc.Coordinate != nil {
+			loc.Type = "single"
+		}
+	}
+	if loc.Type != "" {
+		et.Location = &loc
+	}
+
+	return et, nil
+}
+
+// validateImportRow 复用创建票据的校验规则
+func validateImportRow(req *model.CreateTicketRequest) error {
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		var verrs validator.ValidationErrors
+		if errors.As(err, &verrs) {
+			fields := make([]string, len(verrs))
+			for i, fe := range verrs {
+				fields[i] = fe.Field()
+			}
+			return fmt.Errorf("字段缺失或过长: %s", strings.Join(fields, ", "))
+		}
+		return err
+	}
+	if err := validateTicketRequest(req); err != nil {
+		return err
+	}
+	return nil
+}
+
+// importClientID 为缺少 ticketClientId 的行生成稳定的 ID，重复导入同一文件时可去重
+func importClientID(req *model.CreateTicketRequest) string {
+	str := func(p *string) string {
+		if p == nil {
+			return ""
+		}
+		return *p
+	}
+	sum := sha1.Sum([]byte(strings.Join([]string{
+		req.Name, string(req.Type), str(req.Date), str(req.TripNumber), str(req.Seat),
+	}, "\x00")))
+	return "import_" + hex.EncodeToString(sum[:16])
+}
+
+// existingClientIDs 查询已存在的 ticketClientId 及其所属用户
+func existingClientIDs(rows []importRow) (map[string]int64, error) {
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.ticket.TicketClientID != "" {
+			ids = append(ids, row.ticket.TicketClientID)
+		}
+	}
+
+	owners := make(map[string]int64, len(ids))
+	for start := 0; start < len(ids); start += importQueryLen {
+		end := start + importQueryLen
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var found []model.Ticket
+		if err := database.DB.Select("ticket_client_id", "user_id").
+			Where("ticket_client_id IN ?", ids[start:end]).
+			Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range found {
+			owners[t.TicketClientID] = t.UserID
+		}
+	}
+	return owners, nil
+}
+
+// linkImportedTags 按标签定义中的父标签名称恢复新建标签的层级
+// 父标签不存在或会超出层数限制时保留在顶层
+func linkImportedTags(tx *gorm.DB, userID int64, created []model.Tag, defs map[string]model.ExportTag) error {
+	var custom []model.Tag
+	if err := tx.Select("id, name").Where("type = ? AND user_id = ?", model.TagTypeCustom, userID).
+		Find(&custom).Error; err != nil {
+		return err
+	}
+	ids := make(map[string]int64, len(custom))
+	for _, tag := range custom {
+		ids[tagging.Key(tag.Name)] = tag.ID
+	}
+
+	for _, tag := range created {
+		parentID, ok := ids[tagging.Key(defs[tagging.Key(tag.Name)].Parent)]
+		if !ok {
+			continue
+		}
+		err := tagging.CheckParent(tx, userID, tag.ID, parentID)
+		if errors.Is(err, tagging.ErrParentCycle) || errors.Is(err, tagging.ErrTooDeep) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Tag{}).Where("id = ?", tag.ID).Update("parent_id", parentID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userTagNames 用户可用的标签名（全局 + 自定义），键为 tagging.Key(名称)
+func userTagNames(userID int64) (map[string]bool, error) {
+	var names []string
+	if err := database.DB.Model(&model.Tag{}).
+		Where("type = ? OR user_id = ?", model.TagTypeGlobal, userID).
+		Pluck("name", &names).Error; err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[tagging.Key(name)] = true
+	}
+	return known, nil
+}
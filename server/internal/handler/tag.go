@@ -1,13 +1,20 @@
 package handler
 
 import (
+	"errors"
+	"log"
 	"piaoji-server/internal/database"
 	"piaoji-server/internal/middleware"
 	"piaoji-server/internal/model"
+	"piaoji-server/internal/pagination"
 	"piaoji-server/internal/response"
+	"piaoji-server/internal/tagging"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type TagHandler struct{}
@@ -17,18 +24,27 @@ func NewTagHandler() *TagHandler {
 }
 
 // List 获取所有标签（全局 + 用户自定义）
+// 默认返回标签树，全局标签始终在顶层；flat=true 时返回扁平数组
 func (h *TagHandler) List(c *gin.Context) {
+	var req model.TagTreeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
 	userID := middleware.GetUserID(c)
 
-	var tags []model.Tag
-	if err := database.DB.Where("type = ? OR user_id = ?", model.TagTypeGlobal, userID).
-		Order("type ASC, sort ASC, usage_count DESC").
-		Find(&tags).Error; err != nil {
+	tags, err := tagging.Available(database.DB, userID)
+	if err != nil {
 		response.ServerError(c, "查询失败")
 		return
 	}
 
-	response.Success(c, tags)
+	if req.Flat {
+		response.Success(c, tags)
+		return
+	}
+	response.Success(c, tagging.Tree(tags))
 }
 
 // GetGlobal 获取全局标签
@@ -44,19 +60,74 @@ func (h *TagHandler) GetGlobal(c *gin.Context) {
 	response.Success(c, tags)
 }
 
+// tagSortKeys 自定义标签分页可用的排序字段
+var tagSortKeys = map[string]pagination.SortKey[model.Tag]{
+	"usage_count": {
+		Column: "usage_count",
+		Kind:   pagination.KindNumber,
+		Value:  func(t model.Tag) interface{} { return t.UsageCount },
+	},
+	"name": {
+		Column: "name",
+		Kind:   pagination.KindString,
+		Value:  func(t model.Tag) interface{} { return t.Name },
+	},
+	"created_at": {
+		Column: "created_at",
+		Kind:   pagination.KindTime,
+		Value:  func(t model.Tag) interface{} { return t.CreatedAt },
+	},
+}
+
 // GetCustom 获取用户自定义标签
+// 传入 limit 或 cursor 时返回分页结构，否则返回全部标签数组（兼容旧客户端）
 func (h *TagHandler) GetCustom(c *gin.Context) {
 	userID := middleware.GetUserID(c)
+	query := database.DB.Model(&model.Tag{}).Where("type = ? AND user_id = ?", model.TagTypeCustom, userID)
+
+	var req model.TagListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	if req.Limit == 0 && req.Cursor == "" {
+		var tags []model.Tag
+		if err := query.Order("usage_count DESC").Find(&tags).Error; err != nil {
+			response.ServerError(c, "查询失败")
+			return
+		}
+		response.Success(c, tags)
+		return
+	}
+
+	paginator, err := pagination.New(pagination.Request{
+		Cursor: req.Cursor,
+		Limit:  req.Limit,
+		Sort:   req.Sort,
+		Order:  req.Order,
+	}, tagSortKeys, "usage_count", pagination.Desc, func(t model.Tag) int64 { return t.ID })
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	var total int64
+	query.Count(&total)
 
 	var tags []model.Tag
-	if err := database.DB.Where("type = ? AND user_id = ?", model.TagTypeCustom, userID).
-		Order("usage_count DESC").
-		Find(&tags).Error; err != nil {
+	if err := paginator.Apply(query).Find(&tags).Error; err != nil {
 		response.ServerError(c, "查询失败")
 		return
 	}
-
-	response.Success(c, tags)
+	tags, cursor, hasMore := paginator.Page(tags)
+
+	response.Success(c, model.TagListResponse{
+		List:    tags,
+		Cursor:  cursor,
+		HasMore: hasMore,
+		Total:   total,
+	})
 }
 
 // Create 创建标签
@@ -92,6 +163,16 @@ func (h *TagHandler) Create(c *gin.Context) {
 	if req.Icon != nil {
 		tag.Icon = req.Icon
 	}
+	if req.Group != nil {
+		tag.Group = strings.TrimSpace(*req.Group)
+	}
+	if req.ParentID != nil && *req.ParentID != 0 {
+		if err := tagging.CheckParent(database.DB, userID, 0, *req.ParentID); err != nil {
+			respondParentError(c, err)
+			return
+		}
+		tag.ParentID = req.ParentID
+	}
 
 	if err := database.DB.Create(&tag).Error; err != nil {
 		response.ServerError(c, "创建失败")
@@ -102,6 +183,8 @@ func (h *TagHandler) Create(c *gin.Context) {
 }
 
 // Update 更新标签
+// 票据通过 ticket_tags 引用标签 ID，改名和停用会体现在所有票据上；
+// 新名称与已有标签重名时，merge=true 则把当前标签合并到该标签
 func (h *TagHandler) Update(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -126,17 +209,25 @@ func (h *TagHandler) Update(c *gin.Context) {
 
 	// 构建更新
 	updates := make(map[string]interface{})
+	var mergeTarget *model.Tag
 	if req.Name != nil {
-		// 检查新名称是否重复
-		var existingCount int64
-		database.DB.Model(&model.Tag{}).
-			Where("name = ? AND id != ? AND (type = ? OR user_id = ?)", *req.Name, id, model.TagTypeGlobal, userID).
-			Count(&existingCount)
-		if existingCount > 0 {
-			response.BadRequest(c, "标签名称已存在")
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxTagNameLen {
+			response.BadRequest(c, "标签名称不能为空且不超过 32 个字符")
 			return
 		}
-		updates["name"] = *req.Name
+		// 检查新名称是否重复
+		var existing model.Tag
+		err := database.DB.Where("name = ? AND id != ? AND (type = ? OR user_id = ?)", name, id, model.TagTypeGlobal, userID).
+			First(&existing).Error
+		if err == nil {
+			if !req.Merge {
+				response.BadRequest(c, "标签名称已存在")
+				return
+			}
+			mergeTarget = &existing
+		}
+		updates["name"] = name
 	}
 	if req.Color != nil {
 		updates["color"] = *req.Color
@@ -147,19 +238,135 @@ func (h *TagHandler) Update(c *gin.Context) {
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	if req.Group != nil {
+		updates["tag_group"] = strings.TrimSpace(*req.Group)
+	}
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			updates["parent_id"] = nil
+		} else {
+			if err := tagging.CheckParent(database.DB, userID, tag.ID, *req.ParentID); err != nil {
+				respondParentError(c, err)
+				return
+			}
+			updates["parent_id"] = *req.ParentID
+		}
+	}
 
 	if len(updates) == 0 {
 		response.BadRequest(c, "没有需要更新的字段")
 		return
 	}
 
-	if err := database.DB.Model(&tag).Updates(updates).Error; err != nil {
+	if mergeTarget != nil {
+		affected, err := mergeInto(mergeTarget, []model.Tag{tag})
+		if err != nil {
+			response.ServerError(c, "合并失败")
+			return
+		}
+		response.Success(c, model.TagUpdateResponse{Tag: *mergeTarget, TicketsAffected: affected})
+		return
+	}
+
+	var affected int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&tag).Updates(updates).Error; err != nil {
+			return err
+		}
+		// 改名或启用状态变化时，票据上显示的标签随之变化
+		_, renamed := updates["name"]
+		_, toggled := updates["is_active"]
+		if renamed || toggled {
+			var err error
+			affected, err = tagging.Touch(tx, []int64{tag.ID})
+			return err
+		}
+		return nil
+	})
+	if err != nil {
 		response.ServerError(c, "更新失败")
 		return
 	}
 
 	database.DB.First(&tag, id)
-	response.Success(c, tag)
+	response.Success(c, model.TagUpdateResponse{Tag: tag, TicketsAffected: affected})
+}
+
+// Merge 将多个自定义标签合并到目标标签（自己的自定义标签或全局标签）
+func (h *TagHandler) Merge(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "无效的 ID")
+		return
+	}
+
+	var req model.MergeTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+
+	var target model.Tag
+	if err := database.DB.Where("id = ? AND (type = ? OR user_id = ?)", id, model.TagTypeGlobal, userID).
+		First(&target).Error; err != nil {
+		response.NotFound(c, "目标标签不存在")
+		return
+	}
+
+	sourceIDs := uniqueIDs(req.SourceIDs)
+	for _, sourceID := range sourceIDs {
+		if sourceID == id {
+			response.BadRequest(c, "不能将标签合并到自身")
+			return
+		}
+	}
+
+	var sources []model.Tag
+	if err := database.DB.Where("id IN ? AND type = ? AND user_id = ?", sourceIDs, model.TagTypeCustom, userID).
+		Find(&sources).Error; err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	if len(sources) != len(sourceIDs) {
+		response.NotFound(c, "部分标签不存在或不可合并")
+		return
+	}
+
+	affected, err := mergeInto(&target, sources)
+	if err != nil {
+		response.ServerError(c, "合并失败")
+		return
+	}
+
+	response.Success(c, model.MergeTagResponse{
+		Tag:             target,
+		Merged:          len(sources),
+		TicketsAffected: affected,
+	})
+}
+
+// mergeInto 在一个事务内把 sources 合并到 target，并重新读取 target（使用次数已更新）
+func mergeInto(target *model.Tag, sources []model.Tag) (int64, error) {
+	sourceIDs := make([]int64, len(sources))
+	for i, tag := range sources {
+		sourceIDs[i] = tag.ID
+	}
+
+	var affected int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		affected, err = tagging.Merge(tx, target.ID, sourceIDs)
+		return err
+	})
+	if err != nil {
+		log.Printf("[TagHandler] 合并标签失败: target=%d, sources=%v, err=%v", target.ID, sourceIDs, err)
+		return 0, err
+	}
+
+	database.DB.First(target, target.ID)
+	return affected, nil
 }
 
 // Delete 删除标签
@@ -179,13 +386,26 @@ func (h *TagHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	// 删除标签
-	if err := database.DB.Delete(&tag).Error; err != nil {
+	// 删除标签，子标签移到它的父标签下，票据上的关联由 ticket_tags 外键级联删除
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tagging.Detach(tx, []int64{tag.ID}); err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
 		response.ServerError(c, "删除失败")
 		return
 	}
 
-	// TODO: 从所有关联的票据中移除该标签
-
 	response.SuccessMessage(c, "删除成功")
 }
+
+// respondParentError 父标签校验失败时返回对应的错误
+func respondParentError(c *gin.Context, err error) {
+	if errors.Is(err, tagging.ErrParentNotFound) || errors.Is(err, tagging.ErrParentCycle) || errors.Is(err, tagging.ErrTooDeep) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.ServerError(c, "查询失败")
+}
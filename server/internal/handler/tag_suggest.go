@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"math"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/response"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+	suggestRecencyDays  = 30.0 // 最近使用加分的半衰期（天）
+)
+
+// 各信号的权重
+const (
+	weightFrequency = 3.0 // 用户自己的使用次数
+	weightRecency   = 2.0 // 最近一次使用距今的时间
+	weightType      = 3.0 // 与正在录入的票据类型同时出现
+	weightCity      = 2.0 // 与正在录入的城市同时出现
+	weightPopular   = 1.0 // 全局热度
+)
+
+// tagUsage 用户对单个标签的使用统计
+type tagUsage struct {
+	TagID    int64
+	Uses     int64
+	LastUsed time.Time
+	TypeUses int64
+	CityUses int64
+}
+
+// Suggest 标签推荐/自动补全
+// 综合用户使用频率、最近使用、与票据类型/城市的共现以及全局热度排序
+func (h *TagHandler) Suggest(c *gin.Context) {
+	var req model.TagSuggestRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	if req.Limit <= 0 || req.Limit > maxSuggestLimit {
+		req.Limit = defaultSuggestLimit
+	}
+
+	userID := middleware.GetUserID(c)
+
+	// 候选：启用的全局标签和自己的自定义标签
+	query := database.DB.Where("is_active = ? AND (type = ? OR user_id = ?)", true, model.TagTypeGlobal, userID)
+	if prefix := strings.TrimSpace(req.Prefix); prefix != "" {
+		query = query.Where("name LIKE ?", escapeLike(prefix)+"%")
+	}
+	var tags []model.Tag
+	if err := query.Find(&tags).Error; err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	if len(tags) == 0 {
+		response.Success(c, []model.TagSuggestion{})
+		return
+	}
+
+	usage, err := userTagUsage(userID, req.TicketType, req.City)
+	if err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+
+	var maxUses, maxType, maxCity int64
+	maxPopular := 0
+	for _, u := range usage {
+		maxUses = max(maxUses, u.Uses)
+		maxType = max(maxType, u.TypeUses)
+		maxCity = max(maxCity, u.CityUses)
+	}
+	for _, tag := range tags {
+		maxPopular = max(maxPopular, tag.UsageCount)
+	}
+
+	now := time.Now()
+	suggestions := make([]model.TagSuggestion, len(tags))
+	for i, tag := range tags {
+		score := 0.0
+		if u, ok := usage[tag.ID]; ok {
+			score += weightFrequency * ratio(u.Uses, maxUses)
+			days := now.Sub(u.LastUsed).Hours() / 24
+			score += weightRecency * math.Exp2(-math.Max(days, 0)/suggestRecencyDays)
+			score += weightType * ratio(u.TypeUses, maxType)
+			score += weightCity * ratio(u.CityUses, maxCity)
+		}
+		// 全局热度取对数，避免热门全局标签压过个人习惯
+		if maxPopular > 0 {
+			score += weightPopular * math.Log1p(float64(tag.UsageCount)) / math.Log1p(float64(maxPopular))
+		}
+		suggestions[i] = model.TagSuggestion{Tag: tag, Score: math.Round(score*1000) / 1000}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Sort < suggestions[j].Sort
+	})
+	if len(suggestions) > req.Limit {
+		suggestions = suggestions[:req.Limit]
+	}
+
+	response.Success(c, suggestions)
+}
+
+// userTagUsage 统计用户未删除票据上各标签的使用情况
+func userTagUsage(userID int64, ticketType model.TicketType, city string) (map[int64]tagUsage, error) {
+	typeCond, cityCond := "0", "0"
+	var args []interface{}
+	if ticketType != "" {
+		typeCond = "t.type = ?"
+		args = append(args, ticketType)
+	}
+	if city != "" {
+		cityCond = "(JSON_UNQUOTE(JSON_EXTRACT(t.location, '$.city')) = ? OR " +
+			"JSON_UNQUOTE(JSON_EXTRACT(t.location, '$.departure.city')) = ? OR " +
+			"JSON_UNQUOTE(JSON_EXTRACT(t.location, '$.arrival.city')) = ?)"
+		args = append(args, city, city, city)
+	}
+
+	var rows []tagUsage
+	if err := database.DB.Table("ticket_tags AS tt").
+		Select("tt.tag_id, COUNT(*) AS uses, MAX(tt.created_at) AS last_used, "+
+			"SUM(CASE WHEN "+typeCond+" THEN 1 ELSE 0 END) AS type_uses, "+
+			"SUM(CASE WHEN "+cityCond+" THEN 1 ELSE 0 END) AS city_uses", args...).
+		Joins("JOIN tickets t ON t.id = tt.ticket_id").
+		Where("t.user_id = ? AND t.is_deleted = ?", userID, false).
+		Group("tt.tag_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	usage := make(map[int64]tagUsage, len(rows))
+	for _, row := range rows {
+		usage[row.TagID] = row
+	}
+	return usage, nil
+}
+
+func ratio(n, max int64) float64 {
+	if max == 0 {
+		return 0
+	}
+	return float64(n) / float64(max)
+}
@@ -2,15 +2,28 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"piaoji-server/internal/config"
 	"piaoji-server/internal/database"
+	"piaoji-server/internal/dedup"
+	"piaoji-server/internal/imaging"
 	"piaoji-server/internal/middleware"
 	"piaoji-server/internal/model"
+	"piaoji-server/internal/pagination"
+	"piaoji-server/internal/photo"
 	"piaoji-server/internal/response"
+	"piaoji-server/internal/storage"
+	"piaoji-server/internal/tagging"
+	"piaoji-server/internal/upload"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type TicketHandler struct{}
@@ -27,8 +40,20 @@ func (h *TicketHandler) List(c *gin.Context) {
 		return
 	}
 
-	if req.Limit <= 0 || req.Limit > 100 {
-		req.Limit = 20
+	// 回收站默认按删除时间倒序，并额外支持 deleted_at 排序
+	sortKeys, defaultSort := ticketSortKeys, "sort_time"
+	if req.IsDeleted {
+		sortKeys, defaultSort = trashSortKeys, "deleted_at"
+	}
+	paginator, err := pagination.New(pagination.Request{
+		Cursor: req.Cursor,
+		Limit:  req.Limit,
+		Sort:   req.Sort,
+		Order:  req.Order,
+	}, sortKeys, defaultSort, pagination.Desc, ticketID)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
 	}
 
 	userID := middleware.GetUserID(c)
@@ -39,14 +64,11 @@ func (h *TicketHandler) List(c *gin.Context) {
 	// 是否查询回收站
 	query = query.Where("is_deleted = ?", req.IsDeleted)
 
-	// 按类型筛选
-	if req.Type != "" {
-		query = query.Where("type = ?", req.Type)
-	}
-
-	// 按标签筛选
-	if req.Tag != "" {
-		query = query.Where("JSON_CONTAINS(tags, ?)", fmt.Sprintf(`"%s"`, req.Tag))
+	// 组合筛选（类型、标签、时间、城市、价格等）
+	query, err = applyTicketFilters(query, userID, &req)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
 	}
 
 	// 获取总数
@@ -54,29 +76,27 @@ func (h *TicketHandler) List(c *gin.Context) {
 	query.Count(&total)
 
 	// 游标分页
-	if req.Cursor != "" {
-		// 游标格式: sortTime_id
-		query = query.Where("CONCAT(sort_time, '_', id) < ?", req.Cursor)
-	}
-
-	// 查询数据
 	var tickets []model.Ticket
-	if err := query.Order("sort_time DESC, id DESC").Limit(req.Limit + 1).Find(&tickets).Error; err != nil {
+	if err := paginator.Apply(query).Find(&tickets).Error; err != nil {
 		response.ServerError(c, "查询失败")
 		return
 	}
-
-	// 判断是否还有更多
-	hasMore := len(tickets) > req.Limit
-	if hasMore {
-		tickets = tickets[:req.Limit]
+	tickets, cursor, hasMore := paginator.Page(tickets)
+	if err := tagging.Fill(database.DB, tickets); err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	if err := photo.Fill(database.DB, tickets); err != nil {
+		response.ServerError(c, "查询失败")
+		return
 	}
 
-	// 生成下一页游标
-	var cursor string
-	if len(tickets) > 0 && hasMore {
-		last := tickets[len(tickets)-1]
-		cursor = fmt.Sprintf("%s_%d", last.SortTime.Format(time.RFC3339Nano), last.ID)
+	// 回收站展示距离自动删除的剩余天数
+	if req.IsDeleted {
+		retention, now := config.Cfg.Trash.GetRetention(), time.Now()
+		for i := range tickets {
+			tickets[i].FillDaysRemaining(retention, now)
+		}
 	}
 
 	response.Success(c, model.TicketListResponse{
@@ -102,6 +122,14 @@ func (h *TicketHandler) Get(c *gin.Context) {
 		response.NotFound(c, "票据不存在")
 		return
 	}
+	if err := tagging.FillOne(database.DB, &ticket); err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	if err := photo.FillOne(database.DB, &ticket); err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
 
 	response.Success(c, ticket)
 }
@@ -110,16 +138,16 @@ func (h *TicketHandler) Get(c *gin.Context) {
 func (h *TicketHandler) Create(c *gin.Context) {
 	var req model.CreateTicketRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		fmt.Printf("[TicketHandler] 参数绑定失败: %v\n", err)
 		response.BadRequest(c, "参数错误")
 		return
 	}
+	if err := validateTicketRequest(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
 
 	userID := middleware.GetUserID(c)
-	fmt.Printf("[TicketHandler] 创建票据请求 - UserID: %d, Name: %s, Type: %s\n", userID, req.Name, req.Type)
-	
 	if userID == 0 {
-		fmt.Printf("[TicketHandler] 错误: UserID 为 0\n")
 		response.ServerError(c, "用户ID无效")
 		return
 	}
@@ -127,13 +155,15 @@ func (h *TicketHandler) Create(c *gin.Context) {
 	// 检查用户配额
 	var user model.User
 	if err := database.DB.First(&user, userID).Error; err != nil {
-		fmt.Printf("[TicketHandler] 获取用户信息失败: %v, UserID: %d\n", err, userID)
-		response.ServerError(c, fmt.Sprintf("获取用户信息失败: %v", err))
+		log.Printf("[TicketHandler] 获取用户信息失败: UserID=%d, err=%v", userID, err)
+		response.ServerError(c, "获取用户信息失败")
 		return
 	}
-	fmt.Printf("[TicketHandler] 用户信息获取成功: ID=%d, Name=%s\n", user.ID, *user.NickName)
 
-	if user.PhotoCount >= user.PhotoQuota && req.Photo != nil {
+	// 每张照片都计入配额
+	photoInputs := photo.Inputs(req.Photo, req.Photos)
+	photoCount := len(photoInputs)
+	if photoCount > 0 && user.PhotoCount+photoCount > user.PhotoQuota {
 		response.BadRequest(c, "已达到照片上限，请清理回收站或升级会员")
 		return
 	}
@@ -146,6 +176,95 @@ func (h *TicketHandler) Create(c *gin.Context) {
 		return
 	}
 
+	// 照片必须是当前用户已完成的上传
+	if !confirmUploads(c, userID, photo.URLs(photoInputs)) {
+		return
+	}
+
+	// 创建票据
+	ticket := buildTicket(userID, &req)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		if err := photo.Attach(tx, []model.Ticket{ticket}); err != nil {
+			return err
+		}
+		if err := tagging.Attach(tx, userID, []model.Ticket{ticket}); err != nil {
+			return err
+		}
+		// 更新用户统计，在数据库中累加，避免并发创建时互相覆盖
+		return tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"ticket_count": gorm.Expr("ticket_count + 1"),
+			"photo_count":  gorm.Expr("photo_count + ?", photoCount),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("[TicketHandler] 创建票据失败: UserID=%d, err=%v", userID, err)
+		response.ServerError(c, "创建票据失败")
+		return
+	}
+
+	// 照片在保存前已处理完成时，同步缩略图和各尺寸版本
+	if n, err := imaging.Link(database.DB, userID, photo.URLs(photoInputs)); err != nil {
+		log.Printf("[TicketHandler] 同步照片处理结果失败: %v", err)
+	} else if n > 0 {
+		photo.FillOne(database.DB, &ticket)
+		photo.SetCover(&ticket)
+	}
+
+	// 照片与已有票据的照片近似时提醒用户，不阻止创建
+	if len(ticket.Photos) > 0 {
+		duplicates, err := dedup.Check(c.Request.Context(), database.DB, &ticket, config.Cfg.Duplicate.GetMaxDistance())
+		if err != nil {
+			log.Printf("[TicketHandler] 查找重复照片失败: %v", err)
+		}
+		ticket.Duplicates = duplicates
+	}
+
+	response.Success(c, ticket)
+}
+
+// validateTicketRequest 校验创建票据请求中的枚举和日期字段（必填项由 binding 校验）
+func validateTicketRequest(req *model.CreateTicketRequest) error {
+	if !req.Type.IsValid() {
+		return errors.New("无效的票据类型")
+	}
+	if req.Privacy != "" && !req.Privacy.IsValid() {
+		return errors.New("无效的隐私级别")
+	}
+	if req.Date != nil && *req.Date != "" {
+		if _, err := time.Parse(time.RFC3339, *req.Date); err != nil {
+			return errors.New("日期格式错误，应为 RFC3339")
+		}
+	}
+	if err := photo.Validate(photo.Inputs(req.Photo, req.Photos)); err != nil {
+		return err
+	}
+	return validateTagNames(req.Tags)
+}
+
+// validateTagNames 校验单张票据的标签数量和名称长度
+func validateTagNames(names []string) error {
+	if len(tagging.Normalize(names)) > model.MaxTagsPerTicket {
+		return fmt.Errorf("每张票据最多 %d 个标签", model.MaxTagsPerTicket)
+	}
+	return validateTagNameLen(names)
+}
+
+// validateTagNameLen 校验标签名称长度（与 tags.name 列长度一致）
+func validateTagNameLen(names []string) error {
+	for _, name := range names {
+		if utf8.RuneCountInString(strings.TrimSpace(name)) > maxTagNameLen {
+			return fmt.Errorf("标签过长: %s", name)
+		}
+	}
+	return nil
+}
+
+// buildTicket 根据创建请求构造票据（解析日期、序列化 tags/location、整理照片和封面）
+func buildTicket(userID int64, req *model.CreateTicketRequest) model.Ticket {
 	// 解析日期
 	var date *time.Time
 	if req.Date != nil && *req.Date != "" {
@@ -161,31 +280,15 @@ func (h *TicketHandler) Create(c *gin.Context) {
 		sortTime = *date
 	}
 
-	// 转换 tags 为 JSON
-	var tagsJSON model.JSON
-	if len(req.Tags) > 0 {
-		tagsBytes, err := json.Marshal(req.Tags)
-		if err != nil {
-			fmt.Printf("[TicketHandler] Tags JSON 序列化失败: %v\n", err)
-			tagsJSON = []byte("[]")
-		} else {
-			tagsJSON = tagsBytes
-		}
-	} else {
-		tagsJSON = []byte("[]")
-	}
-	fmt.Printf("[TicketHandler] Tags JSON: %s\n", string(tagsJSON))
-
 	// 转换 location 为 JSON
 	var locationJSON model.JSON
 	if req.Location != nil {
 		locationBytes, err := json.Marshal(req.Location)
 		if err != nil {
-			fmt.Printf("[TicketHandler] Location JSON 序列化失败: %v\n", err)
+			log.Printf("[TicketHandler] Location JSON 序列化失败: %v", err)
 			locationJSON = nil
 		} else {
 			locationJSON = locationBytes
-			fmt.Printf("[TicketHandler] Location JSON: %s\n", string(locationJSON))
 		}
 	}
 
@@ -195,7 +298,6 @@ func (h *TicketHandler) Create(c *gin.Context) {
 		privacy = model.PrivacyPublic
 	}
 
-	// 创建票据
 	ticket := model.Ticket{
 		TicketClientID: req.TicketClientID,
 		UserID:         userID,
@@ -206,9 +308,9 @@ func (h *TicketHandler) Create(c *gin.Context) {
 		Hall:           req.Hall,
 		Version:        req.Version,
 		Showtime:       req.Showtime,
-		Tags:           tagsJSON,
+		Tags:           tagging.Normalize(req.Tags),
 		Price:          req.Price,
-		Photo:          req.Photo,
+		Photos:         photo.Build(userID, photo.Inputs(req.Photo, req.Photos)),
 		Date:           date,
 		SortTime:       sortTime,
 		Location:       locationJSON,
@@ -216,41 +318,10 @@ func (h *TicketHandler) Create(c *gin.Context) {
 		Privacy:        privacy,
 	}
 
-	// 自动生成缩略图 URL
-	if req.Photo != nil && *req.Photo != "" {
-		thumbnailURL := *req.Photo + "?imageView2/1/w/300/h/300/q/80"
-		ticket.Thumbnail = &thumbnailURL
-	}
-
-	// 打印完整的票据数据用于调试
-	fmt.Printf("[TicketHandler] 准备创建票据，数据详情:\n")
-	fmt.Printf("  TicketClientID: %s\n", ticket.TicketClientID)
-	fmt.Printf("  UserID: %d\n", ticket.UserID)
-	fmt.Printf("  Name: %s\n", ticket.Name)
-	fmt.Printf("  Type: %s\n", ticket.Type)
-	fmt.Printf("  Tags: %s\n", string(ticket.Tags))
-	fmt.Printf("  SortTime: %v\n", ticket.SortTime)
-	
-	if err := database.DB.Create(&ticket).Error; err != nil {
-		fmt.Printf("[TicketHandler] 数据库创建失败: %v\n", err)
-		fmt.Printf("[TicketHandler] 错误类型: %T\n", err)
-		fmt.Printf("[TicketHandler] 票据数据: %+v\n", ticket)
-		response.ServerError(c, fmt.Sprintf("创建票据失败: %v", err))
-		return
-	}
-
-	fmt.Printf("[TicketHandler] 票据创建成功 - ID: %d\n", ticket.ID)
-
-	// 更新用户统计
-	updates := map[string]interface{}{
-		"ticket_count": user.TicketCount + 1,
-	}
-	if req.Photo != nil {
-		updates["photo_count"] = user.PhotoCount + 1
-	}
-	database.DB.Model(&model.User{}).Where("id = ?", userID).Updates(updates)
+	// 第一张照片作为封面
+	photo.SetCover(&ticket)
 
-	response.Success(c, ticket)
+	return ticket
 }
 
 // Update 更新票据
@@ -299,20 +370,9 @@ func (h *TicketHandler) Update(c *gin.Context) {
 	if req.Showtime != nil {
 		updates["showtime"] = *req.Showtime
 	}
-	if req.Tags != nil {
-		tagsJSON, _ := json.Marshal(req.Tags)
-		updates["tags"] = tagsJSON
-	}
 	if req.Price != nil {
 		updates["price"] = *req.Price
 	}
-	if req.Photo != nil {
-		updates["photo"] = *req.Photo
-		if *req.Photo != "" {
-			thumbnailURL := *req.Photo + "?imageView2/1/w/300/h/300/q/80"
-			updates["thumbnail"] = thumbnailURL
-		}
-	}
 	if req.Date != nil {
 		if *req.Date != "" {
 			t, err := time.Parse(time.RFC3339, *req.Date)
@@ -336,18 +396,97 @@ func (h *TicketHandler) Update(c *gin.Context) {
 		updates["privacy"] = req.Privacy
 	}
 
-	if len(updates) == 0 {
+	if len(updates) == 0 && req.Tags == nil && req.Photos == nil && req.Photo == nil {
 		response.BadRequest(c, "没有需要更新的字段")
 		return
 	}
+	if err := validateTagNames(req.Tags); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
 
-	if err := database.DB.Model(&ticket).Updates(updates).Error; err != nil {
+	// 照片：photos 替换全部照片；只传 photo 的旧客户端替换封面
+	var photoInputs []model.TicketPhotoInput
+	photoDelta := 0
+	if req.Photos != nil || req.Photo != nil {
+		existing, err := photo.Load(database.DB, []int64{ticket.ID})
+		if err != nil {
+			response.ServerError(c, "查询失败")
+			return
+		}
+		if req.Photos != nil {
+			photoInputs = photo.Normalize(req.Photos)
+		} else {
+			photoInputs = photo.ReplaceCover(existing[ticket.ID], *req.Photo)
+		}
+		if err := photo.Validate(photoInputs); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+
+		added, delta := photoChanges(existing[ticket.ID], photoInputs)
+		if !confirmUploads(c, userID, added) {
+			return
+		}
+		if len(added) > 0 {
+			var user model.User
+			if err := database.DB.Select("photo_count", "photo_quota").First(&user, userID).Error; err != nil {
+				response.ServerError(c, "查询失败")
+				return
+			}
+			if user.PhotoCount+delta > user.PhotoQuota {
+				response.BadRequest(c, "已达到照片上限，请清理回收站或升级会员")
+				return
+			}
+		}
+		photoDelta = delta
+	}
+
+	var removed []model.TicketPhoto
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&ticket).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if photoInputs != nil {
+			var err error
+			if _, removed, err = photo.Set(tx, &ticket, photoInputs); err != nil {
+				return err
+			}
+			if photoDelta != 0 {
+				if err := tx.Model(&model.User{}).Where("id = ?", userID).
+					UpdateColumn("photo_count", gorm.Expr("GREATEST(photo_count + ?, 0)", photoDelta)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if req.Tags != nil {
+			_, err := tagging.Set(tx, userID, ticket.ID, req.Tags)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
 		response.ServerError(c, "更新失败")
 		return
 	}
 
+	// 数据库已提交，存储删除失败只记录日志
+	deletePhotoObjects(userID, removed)
+	if photoInputs != nil {
+		if _, err := imaging.Link(database.DB, userID, photo.URLs(photoInputs)); err != nil {
+			log.Printf("[TicketHandler] 同步照片处理结果失败: %v", err)
+		}
+	}
+
 	// 重新查询返回
 	database.DB.First(&ticket, id)
+	tagging.FillOne(database.DB, &ticket)
+	photo.FillOne(database.DB, &ticket)
+	if photoInputs != nil {
+		dedup.Submit(ticket.ID)
+	}
 	response.Success(c, ticket)
 }
 
@@ -368,12 +507,21 @@ func (h *TicketHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	// 软删除
+	// 软删除，回收站中的票据不计入标签使用次数
 	now := time.Now()
-	if err := database.DB.Model(&ticket).Updates(map[string]interface{}{
-		"is_deleted": true,
-		"deleted_at": now,
-	}).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ticket).Updates(map[string]interface{}{
+			"is_deleted": true,
+			"deleted_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := photo.SetDeleted(tx, []int64{ticket.ID}, true); err != nil {
+			return err
+		}
+		return tagging.RefreshTicketUsage(tx, []int64{ticket.ID})
+	})
+	if err != nil {
 		response.ServerError(c, "删除失败")
 		return
 	}
@@ -399,14 +547,25 @@ func (h *TicketHandler) Restore(c *gin.Context) {
 	}
 
 	// 恢复
-	if err := database.DB.Model(&ticket).Updates(map[string]interface{}{
-		"is_deleted": false,
-		"deleted_at": nil,
-	}).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ticket).Updates(map[string]interface{}{
+			"is_deleted": false,
+			"deleted_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := photo.SetDeleted(tx, []int64{ticket.ID}, false); err != nil {
+			return err
+		}
+		return tagging.RefreshTicketUsage(tx, []int64{ticket.ID})
+	})
+	if err != nil {
 		response.ServerError(c, "恢复失败")
 		return
 	}
 
+	tagging.FillOne(database.DB, &ticket)
+	photo.FillOne(database.DB, &ticket)
 	response.Success(c, ticket)
 }
 
@@ -427,21 +586,68 @@ func (h *TicketHandler) PermanentDelete(c *gin.Context) {
 		return
 	}
 
-	// 永久删除
-	if err := database.DB.Unscoped().Delete(&ticket).Error; err != nil {
+	// 永久删除，照片记录由外键级联删除，每张照片都从配额中扣减
+	var photos []model.TicketPhoto
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ticket_id = ?", ticket.ID).Find(&photos).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&ticket).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"ticket_count": gorm.Expr("GREATEST(ticket_count - 1, 0)"),
+			"photo_count":  gorm.Expr("GREATEST(photo_count - ?, 0)", len(photos)),
+		}).Error
+	})
+	if err != nil {
 		response.ServerError(c, "删除失败")
 		return
 	}
 
-	// 更新用户统计
-	updates := map[string]interface{}{}
-	database.DB.Model(&model.User{}).Where("id = ?", userID).
-		UpdateColumn("ticket_count", database.DB.Raw("ticket_count - 1"))
-	if ticket.Photo != nil {
-		database.DB.Model(&model.User{}).Where("id = ?", userID).
-			UpdateColumn("photo_count", database.DB.Raw("photo_count - 1"))
-	}
-	database.DB.Model(&model.User{}).Where("id = ?", userID).Updates(updates)
+	// 数据库已提交，存储删除失败只记录日志
+	deletePhotoObjects(userID, photos)
 
 	response.SuccessMessage(c, "已永久删除")
 }
+
+// deletePhotoObjects 删除照片记录后清理存储中的对象，只删除用户自己上传且不再被引用的对象
+func deletePhotoObjects(userID int64, photos []model.TicketPhoto) {
+	keys, err := photo.Keys(database.DB, userID, photos)
+	if err != nil {
+		log.Printf("[TicketHandler] 查询照片引用失败: %v", err)
+		return
+	}
+	if err := storage.DeleteObjects(keys); err != nil {
+		log.Printf("[TicketHandler] 删除照片失败: %v", err)
+	}
+}
+
+// photoChanges 计算替换照片后新增的照片地址和照片总数的变化
+func photoChanges(existing []model.TicketPhoto, inputs []model.TicketPhotoInput) (added []string, delta int) {
+	urls := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		urls[p.URL] = true
+	}
+	for _, in := range inputs {
+		if !urls[in.URL] {
+			added = append(added, in.URL)
+		}
+	}
+	return added, len(inputs) - len(existing)
+}
+
+// confirmUploads 校验照片都是当前用户已完成的上传，不通过时写入响应并返回 false
+func confirmUploads(c *gin.Context, userID int64, urls []string) bool {
+	err := upload.Confirm(c.Request.Context(), database.DB, userID, urls)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, upload.ErrNotConfirmed):
+		response.BadRequest(c, err.Error())
+	default:
+		log.Printf("[TicketHandler] 校验照片上传失败: %v", err)
+		response.ServerError(c, "校验照片失败")
+	}
+	return false
+}
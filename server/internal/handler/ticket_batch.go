@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/response"
+	"piaoji-server/internal/tagging"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Batch 批量操作票据
+// 整批在一个事务内执行；不存在或状态不符的票据记为失败，不影响其他票据
+func (h *TicketHandler) Batch(c *gin.Context) {
+	var req model.BatchTicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := validateBatchRequest(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	ids := uniqueIDs(req.IDs)
+
+	results := make(map[int64]string, len(ids)) // id -> 错误信息，空串表示成功
+	var removedPhotos []model.TicketPhoto
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var tickets []model.Ticket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND user_id = ?", ids, userID).
+			Find(&tickets).Error; err != nil {
+			return err
+		}
+
+		// 追加标签后的标签数，用于检查数量上限
+		var tagCounts map[int64]int
+		if req.Action == model.BatchAddTags {
+			ticketIDs := make([]int64, len(tickets))
+			for i, t := range tickets {
+				ticketIDs[i] = t.ID
+			}
+			var err error
+			if tagCounts, err = tagging.CountAfterAdd(tx, userID, ticketIDs, req.Tags); err != nil {
+				return err
+			}
+		}
+
+		found := make(map[int64]bool, len(tickets))
+		var targets []model.Ticket
+		for _, t := range tickets {
+			found[t.ID] = true
+			if msg := batchPrecondition(req.Action, &t); msg != "" {
+				results[t.ID] = msg
+				continue
+			}
+			if req.Action == model.BatchAddTags && tagCounts[t.ID] > model.MaxTagsPerTicket {
+				results[t.ID] = fmt.Sprintf("每张票据最多 %d 个标签", model.MaxTagsPerTicket)
+				continue
+			}
+			targets = append(targets, t)
+		}
+		for _, id := range ids {
+			if !found[id] {
+				results[id] = "票据不存在"
+			}
+		}
+		if len(targets) == 0 {
+			return nil
+		}
+
+		targetIDs := make([]int64, len(targets))
+		for i, t := range targets {
+			targetIDs[i] = t.ID
+			results[t.ID] = ""
+		}
+		targetQuery := tx.Model(&model.Ticket{}).Where("id IN ?", targetIDs)
+
+		switch req.Action {
+		case model.BatchDelete:
+			if err := targetQuery.Updates(map[string]interface{}{
+				"is_deleted": true,
+				"deleted_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			if err := photo.SetDeleted(tx, targetIDs, true); err != nil {
+				return err
+			}
+			return tagging.RefreshTicketUsage(tx, targetIDs)
+
+		case model.BatchRestore:
+			if err := targetQuery.Updates(map[string]interface{}{
+				"is_deleted": false,
+				"deleted_at": nil,
+			}).Error; err != nil {
+				return err
+			}
+			if err := photo.SetDeleted(tx, targetIDs, false); err != nil {
+				return err
+			}
+			return tagging.RefreshTicketUsage(tx, targetIDs)
+
+		case model.BatchSetPrivacy:
+			return targetQuery.Update("privacy", req.Privacy).Error
+
+		case model.BatchSetType:
+			return targetQuery.Update("type", req.Type).Error
+
+		case model.BatchAddTags:
+			return tagging.Add(tx, userID, targetIDs, req.Tags)
+
+		case model.BatchRemoveTags:
+			return tagging.Remove(tx, userID, targetIDs, req.Tags)
+
+		case model.BatchPermanentDelete:
+			if err := tx.Where("ticket_id IN ?", targetIDs).Find(&removedPhotos).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", targetIDs).Delete(&model.Ticket{}).Error; err != nil {
+				return err
+			}
+			// 与 PermanentDelete 保持一致，同步扣减用户统计
+			return tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+				"ticket_count": gorm.Expr("GREATEST(ticket_count - ?, 0)", len(targets)),
+				"photo_count":  gorm.Expr("GREATEST(photo_count - ?, 0)", len(removedPhotos)),
+			}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[TicketHandler] 批量操作失败: action=%s, err=%v", req.Action, err)
+		response.ServerError(c, "批量操作失败")
+		return
+	}
+
+	// 事务提交后再删除存储中的照片
+	if len(removedPhotos) > 0 {
+		deletePhotoObjects(userID, removedPhotos)
+	}
+
+	resp := model.BatchTicketResponse{Results: make([]model.BatchTicketResult, 0, len(ids))}
+	for _, id := range ids {
+		msg := results[id]
+		resp.Results = append(resp.Results, model.BatchTicketResult{
+			ID:      id,
+			Success: msg == "",
+			Error:   msg,
+		})
+		if msg == "" {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	response.Success(c, resp)
+}
+
+// validateBatchRequest 校验操作类型及其附带参数
+func validateBatchRequest(req *model.BatchTicketRequest) error {
+	switch req.Action {
+	case model.BatchDelete, model.BatchRestore, model.BatchPermanentDelete:
+	case model.BatchSetPrivacy:
+		if !req.Privacy.IsValid() {
+			return errors.New("无效的隐私级别")
+		}
+	case model.BatchSetType:
+		if !req.Type.IsValid() {
+			return errors.New("无效的票据类型")
+		}
+	case model.BatchAddTags, model.BatchRemoveTags:
+		if len(tagging.Normalize(req.Tags)) == 0 {
+			return errors.New("标签不能为空")
+		}
+		// 数量上限按票据逐张检查
+		return validateTagNameLen(req.Tags)
+	default:
+		return errors.New("不支持的批量操作")
+	}
+	return nil
+}
+
+// batchPrecondition 检查票据当前状态是否允许执行该操作，返回失败原因
+func batchPrecondition(action model.BatchAction, t *model.Ticket) string {
+	switch action {
+	case model.BatchRestore, model.BatchPermanentDelete:
+		if !t.IsDeleted {
+			return "票据不在回收站中"
+		}
+	default:
+		if t.IsDeleted {
+			return "票据已在回收站中"
+		}
+	}
+	return ""
+}
+
+// uniqueIDs 去重并保持原顺序
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"log"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/dedup"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Duplicates 疑似重复的票据对（照片近似，或类型、日期、车次/航班号相同）
+func (h *TicketHandler) Duplicates(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	pairs, err := dedup.Pairs(database.DB, userID, config.Cfg.Duplicate.GetMaxDistance())
+	if err != nil {
+		log.Printf("[TicketHandler] 查找重复票据失败: %v", err)
+		response.ServerError(c, "查询失败")
+		return
+	}
+	response.Success(c, model.DuplicateListResponse{Pairs: pairs})
+}
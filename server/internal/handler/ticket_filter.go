@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/pagination"
+	"piaoji-server/internal/tagging"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ticketSortKeys 票据列表可用的排序字段
+// price 为空时按 0 处理，保证 keyset 比较有确定顺序
+var ticketSortKeys = map[string]pagination.SortKey[model.Ticket]{
+	"sort_time": {
+		Column: "sort_time",
+		Kind:   pagination.KindTime,
+		Value:  func(t model.Ticket) interface{} { return t.SortTime },
+	},
+	"created_at": {
+		Column: "created_at",
+		Kind:   pagination.KindTime,
+		Value:  func(t model.Ticket) interface{} { return t.CreatedAt },
+	},
+	"price": {
+		Column: "COALESCE(price, 0)",
+		Kind:   pagination.KindNumber,
+		Value: func(t model.Ticket) interface{} {
+			if t.Price == nil {
+				return 0.0
+			}
+			return *t.Price
+		},
+	},
+	"name": {
+		Column: "name",
+		Kind:   pagination.KindString,
+		Value:  func(t model.Ticket) interface{} { return t.Name },
+	},
+}
+
+// trashSortKeys 回收站列表可用的排序字段
+var trashSortKeys = map[string]pagination.SortKey[model.Ticket]{
+	"deleted_at": {
+		Column: "deleted_at",
+		Kind:   pagination.KindTime,
+		Value: func(t model.Ticket) interface{} {
+			if t.DeletedAt == nil {
+				return time.Time{}
+			}
+			return *t.DeletedAt
+		},
+	},
+}
+
+func init() {
+	for name, key := range ticketSortKeys {
+		trashSortKeys[name] = key
+	}
+}
+
+// ticketID 取票据主键，供分页器使用
+func ticketID(t model.Ticket) int64 {
+	return t.ID
+}
+
+// ticketTagExists 票据带有 ID 在给定列表中的标签（停用的标签不参与匹配）
+const ticketTagExists = "EXISTS (SELECT 1 FROM ticket_tags tt JOIN tags tg ON tg.id = tt.tag_id " +
+	"WHERE tt.ticket_id = tickets.id AND tg.is_active = ? AND tt.tag_id IN ?)"
+
+// applyTicketFilters 根据列表请求追加筛选条件（不含用户和回收站条件）
+func applyTicketFilters(query *gorm.DB, userID int64, req *model.TicketListRequest) (*gorm.DB, error) {
+	// 按类型筛选
+	if req.Type != "" {
+		query = query.Where("type = ?", req.Type)
+	}
+
+	// 按标签筛选，父标签同时匹配带有其子孙标签的票据
+	tags := collectFilterTags(req)
+	if len(tags) > 0 {
+		expanded, err := tagging.Expand(database.DB, userID, tags)
+		if err != nil {
+			log.Printf("[TicketHandler] 查询标签失败: UserID=%d, err=%v", userID, err)
+			return nil, errors.New("查询失败")
+		}
+		switch req.TagMode {
+		case "", model.TagMatchAll:
+			for _, tag := range tags {
+				query = query.Where(ticketTagExists, true, expanded[tag])
+			}
+		case model.TagMatchAny:
+			var ids []int64
+			for _, tag := range tags {
+				ids = append(ids, expanded[tag]...)
+			}
+			query = query.Where(ticketTagExists, true, ids)
+		default:
+			return nil, errors.New("无效的标签组合方式")
+		}
+	}
+
+	// 按时间范围筛选
+	if req.From != "" {
+		from, _, err := parseFilterTime(req.From)
+		if err != nil {
+			return nil, errors.New("无效的起始时间")
+		}
+		query = query.Where("sort_time >= ?", from)
+	}
+	if req.To != "" {
+		to, dateOnly, err := parseFilterTime(req.To)
+		if err != nil {
+			return nil, errors.New("无效的截止时间")
+		}
+		if dateOnly {
+			query = query.Where("sort_time < ?", to.AddDate(0, 0, 1))
+		} else {
+			query = query.Where("sort_time <= ?", to)
+		}
+	}
+
+	// 按城市筛选
+	if req.City != "" {
+		query = query.Where(
+			"(JSON_UNQUOTE(JSON_EXTRACT(location, '$.city')) = ? OR "+
+				"JSON_UNQUOTE(JSON_EXTRACT(location, '$.departure.city')) = ? OR "+
+				"JSON_UNQUOTE(JSON_EXTRACT(location, '$.arrival.city')) = ?)",
+			req.City, req.City, req.City,
+		)
+	}
+
+	// 按价格筛选
+	if req.MinPrice != nil {
+		query = query.Where("price >= ?", *req.MinPrice)
+	}
+	if req.MaxPrice != nil {
+		query = query.Where("price <= ?", *req.MaxPrice)
+	}
+
+	// 按隐私级别筛选
+	if req.Privacy != "" {
+		query = query.Where("privacy = ?", req.Privacy)
+	}
+
+	// 按是否有照片筛选
+	if req.HasPhoto != nil {
+		if *req.HasPhoto {
+			query = query.Where("photo IS NOT NULL AND photo != ''")
+		} else {
+			query = query.Where("(photo IS NULL OR photo = '')")
+		}
+	}
+
+	return query, nil
+}
+
+// collectFilterTags 合并 tag 与 tags 参数，支持逗号分隔并去重
+func collectFilterTags(req *model.TicketListRequest) []string {
+	raw := append([]string{req.Tag}, req.Tags...)
+	seen := make(map[string]bool)
+	var tags []string
+	for _, item := range raw {
+		for _, tag := range strings.Split(item, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseFilterTime 解析筛选时间，支持 YYYY-MM-DD 和 RFC3339
+// 第二个返回值表示是否为仅日期格式
+func parseFilterTime(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, false, err
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+	"piaoji-server/internal/parser"
+	"piaoji-server/internal/response"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxParseTextLen = 20000   // 粘贴文本最大长度（字节）
+	maxParseFileLen = 2 << 20 // .eml/.txt 文件最大 2MB
+)
+
+// ParseTicketRequest 解析粘贴的短信/邮件文本
+type ParseTicketRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// ParseTicketResponse 解析结果，草稿需用户确认后再调用创建接口
+type ParseTicketResponse struct {
+	Drafts    []parser.Draft `json:"drafts"`
+	Providers []string       `json:"providers"`
+}
+
+// Parse 解析第三方购票确认信息（12306、航司、猫眼、淘票票）
+// 支持 JSON {"text": "..."} 或 multipart 上传 .eml/.txt 文件（字段名 file）
+func (h *TicketHandler) Parse(c *gin.Context) {
+	var text string
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxParseFileLen+1<<20)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			response.BadRequest(c, "请上传文件")
+			return
+		}
+		if fh.Size > maxParseFileLen {
+			response.BadRequest(c, "文件不能超过 2MB")
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			response.BadRequest(c, "读取文件失败")
+			return
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			response.BadRequest(c, "读取文件失败")
+			return
+		}
+
+		switch strings.ToLower(path.Ext(fh.Filename)) {
+		case ".eml":
+			text, err = parser.EmailText(bytes.NewReader(data))
+			if err != nil {
+				response.BadRequest(c, "无法解析邮件文件")
+				return
+			}
+		case ".txt":
+			text = string(data)
+		default:
+			response.BadRequest(c, "仅支持 .eml 和 .txt 文件")
+			return
+		}
+	} else {
+		var req ParseTicketRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, "参数错误")
+			return
+		}
+		if len(req.Text) > maxParseTextLen {
+			response.BadRequest(c, "文本过长")
+			return
+		}
+		text = req.Text
+		// 直接粘贴的邮件 HTML 源码
+		if strings.Contains(text, "</") {
+			text = parser.StripHTML(text)
+		}
+	}
+
+	response.Success(c, ParseTicketResponse{
+		Drafts:    parser.Parse(text, time.Now()),
+		Providers: parser.Providers(),
+	})
+}
@@ -0,0 +1,341 @@
+package handler
+
+import (
+	"encoding/json"
+	"html"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/pagination"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/response"
+	"piaoji-server/internal/tagging"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxSearchTerms      = 5   // 单次搜索最多关键词数
+	maxSearchCandidates = 500 // 参与相关度排序的最多票据数，按时间取最近的
+	fragmentContext     = 10  // 命中片段前保留的字符数
+	fragmentMaxLen      = 40  // 命中片段最大长度
+)
+
+// 参与搜索的数据库列（location 中的字段通过 JSON_EXTRACT 取出）
+var searchColumns = []string{
+	"name",
+	"note",
+	"trip_number",
+	"seat",
+	"hall",
+	"JSON_UNQUOTE(JSON_EXTRACT(location, '$.city'))",
+	"JSON_UNQUOTE(JSON_EXTRACT(location, '$.address'))",
+	"JSON_UNQUOTE(JSON_EXTRACT(location, '$.departure.city'))",
+	"JSON_UNQUOTE(JSON_EXTRACT(location, '$.departure.station'))",
+	"JSON_UNQUOTE(JSON_EXTRACT(location, '$.arrival.city'))",
+	"JSON_UNQUOTE(JSON_EXTRACT(location, '$.arrival.station'))",
+}
+
+// searchField 票据中一个可搜索的字段及其权重
+type searchField struct {
+	name   string
+	value  string
+	weight int
+}
+
+// Search 关键词搜索票据
+func (h *TicketHandler) Search(c *gin.Context) {
+	var req model.TicketSearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	if req.Limit <= 0 || req.Limit > pagination.MaxLimit {
+		req.Limit = pagination.DefaultLimit
+	}
+
+	// 按相关度排序无法使用 keyset，游标中记录偏移量
+	offset, err := pagination.DecodeOffset(req.Cursor)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	terms := splitSearchTerms(req.Q)
+	if len(terms) == 0 {
+		response.BadRequest(c, "搜索关键词不能为空")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+
+	// 每个关键词至少命中一个字段
+	query := database.DB.Model(&model.Ticket{}).Where("user_id = ? AND is_deleted = ?", userID, false)
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		conds := make([]string, len(searchColumns))
+		args := make([]interface{}, len(searchColumns))
+		for i, col := range searchColumns {
+			conds[i] = col + " LIKE ?"
+			args[i] = pattern
+		}
+		query = query.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+
+	// 打分只用到票据本身的列，标签和照片只为当前页填充
+	// 多取一条用于判断是否超出上限
+	var tickets []model.Ticket
+	if err := query.Order("sort_time DESC, id DESC").Limit(maxSearchCandidates + 1).Find(&tickets).Error; err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	truncated := len(tickets) > maxSearchCandidates
+	if truncated {
+		tickets = tickets[:maxSearchCandidates]
+	}
+
+	// 计算相关度并生成高亮片段
+	results := make([]model.TicketSearchResult, 0, len(tickets))
+	for _, ticket := range tickets {
+		score, highlights := scoreTicket(&ticket, terms)
+		if score == 0 {
+			continue
+		}
+		results = append(results, model.TicketSearchResult{
+			Ticket:     ticket,
+			Score:      score,
+			Highlights: highlights,
+		})
+	}
+
+	// 相关度相同时保持时间倒序
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	total := len(results)
+	if offset > total {
+		offset = total
+	}
+	end := offset + req.Limit
+	if end > total {
+		end = total
+	}
+	hasMore := end < total
+
+	var cursor string
+	if hasMore {
+		cursor = pagination.EncodeOffset(end)
+	}
+
+	page := results[offset:end]
+	pageTickets := make([]model.Ticket, len(page))
+	for i := range page {
+		pageTickets[i] = page[i].Ticket
+	}
+	if err := tagging.Fill(database.DB, pageTickets); err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	if err := photo.Fill(database.DB, pageTickets); err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	for i := range page {
+		page[i].Ticket = pageTickets[i]
+	}
+
+	response.Success(c, model.TicketSearchResponse{
+		List:      page,
+		Cursor:    cursor,
+		HasMore:   hasMore,
+		Total:     int64(total),
+		Truncated: truncated,
+	})
+}
+
+// splitSearchTerms 按空白拆分关键词并去重
+func splitSearchTerms(q string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, term := range strings.Fields(q) {
+		key := strings.ToLower(term)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		terms = append(terms, term)
+		if len(terms) >= maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ticketSearchFields 列出票据中参与打分的字段
+func ticketSearchFields(t *model.Ticket) []searchField {
+	fields := []searchField{{name: "name", value: t.Name, weight: 10}}
+	if t.TripNumber != nil {
+		fields = append(fields, searchField{name: "tripNumber", value: *t.TripNumber, weight: 8})
+	}
+
+	if len(t.Location) > 0 {
+		var loc model.Location
+		if err := json.Unmarshal(t.Location, &loc); err == nil {
+			fields = append(fields,
+				searchField{name: "location.city", value: loc.City, weight: 6},
+				searchField{name: "location.address", value: loc.Address, weight: 4},
+			)
+			if loc.Departure != nil {
+				fields = append(fields,
+					searchField{name: "location.departure.city", value: loc.Departure.City, weight: 6},
+					searchField{name: "location.departure.station", value: loc.Departure.Station, weight: 4},
+				)
+			}
+			if loc.Arrival != nil {
+				fields = append(fields,
+					searchField{name: "location.arrival.city", value: loc.Arrival.City, weight: 6},
+					searchField{name: "location.arrival.station", value: loc.Arrival.Station, weight: 4},
+				)
+			}
+		}
+	}
+
+	if t.Seat != nil {
+		fields = append(fields, searchField{name: "seat", value: *t.Seat, weight: 3})
+	}
+	if t.Hall != nil {
+		fields = append(fields, searchField{name: "hall", value: *t.Hall, weight: 3})
+	}
+	if t.Note != nil {
+		fields = append(fields, searchField{name: "note", value: *t.Note, weight: 2})
+	}
+	return fields
+}
+
+// scoreTicket 计算票据与关键词的相关度
+// 每个命中字段累加其权重，前缀命中和完全匹配额外加分
+func scoreTicket(t *model.Ticket, terms []string) (int, []model.SearchHighlight) {
+	foldedTerms := make([][]rune, len(terms))
+	for i, term := range terms {
+		foldedTerms[i] = foldRunes(term)
+	}
+
+	score := 0
+	var highlights []model.SearchHighlight
+	for _, field := range ticketSearchFields(t) {
+		if field.value == "" {
+			continue
+		}
+		value := foldRunes(field.value)
+		matched := false
+		for _, term := range foldedTerms {
+			pos := indexRunes(value, term, 0)
+			if pos < 0 {
+				continue
+			}
+			matched = true
+			score += field.weight
+			if pos == 0 {
+				score += field.weight / 2
+			}
+			if len(term) == len(value) {
+				score += field.weight
+			}
+		}
+		if matched {
+			highlights = append(highlights, model.SearchHighlight{
+				Field:    field.name,
+				Fragment: highlightFragment(field.value, foldedTerms),
+			})
+		}
+	}
+	return score, highlights
+}
+
+// highlightFragment 截取首个命中位置附近的片段，并用 <em> 包裹所有命中部分
+// 票据内容经过 HTML 转义，片段中只有 <em> 标签是未转义的
+func highlightFragment(value string, foldedTerms [][]rune) string {
+	runes := []rune(value)
+	folded := foldRunes(value)
+	marks := make([]bool, len(runes))
+	first := -1
+	for _, term := range foldedTerms {
+		for pos := indexRunes(folded, term, 0); pos >= 0; pos = indexRunes(folded, term, pos+1) {
+			for i := pos; i < pos+len(term); i++ {
+				marks[i] = true
+			}
+			if first < 0 || pos < first {
+				first = pos
+			}
+		}
+	}
+	if first < 0 {
+		return html.EscapeString(value)
+	}
+
+	start := first - fragmentContext
+	if start < 0 {
+		start = 0
+	}
+	end := start + fragmentMaxLen
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marks[i] && (i == start || !marks[i-1]) {
+			b.WriteString("<em>")
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marks[i] && (i == end-1 || !marks[i+1]) {
+			b.WriteString("</em>")
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// foldRunes 转小写，按字符（rune）逐个转换以保证下标与原文一一对应
+func foldRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// indexRunes 从 from 开始查找 needle 在 hay 中的位置，找不到返回 -1
+func indexRunes(hay, needle []rune, from int) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := from; i+len(needle) <= len(hay); i++ {
+		match := true
+		for j := range needle {
+			if hay[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
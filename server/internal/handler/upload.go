@@ -1,15 +1,22 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
-	"piaoji-server/internal/config"
+	"log"
+	"net/http"
+	"piaoji-server/internal/database"
 	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/ocr"
 	"piaoji-server/internal/response"
+	"piaoji-server/internal/storage"
+	"piaoji-server/internal/upload"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/qiniu/go-sdk/v7/auth/qbox"
-	"github.com/qiniu/go-sdk/v7/storage"
 )
 
 type UploadHandler struct{}
@@ -18,51 +25,147 @@ func NewUploadHandler() *UploadHandler {
 	return &UploadHandler{}
 }
 
+const (
+	uploadTokenExpires = time.Hour // 上传凭证有效期
+	maxUploadBytes     = 20 << 20  // 单张照片最大 20MB
+)
+
 // UploadTokenResponse 上传凭证响应
+// 客户端把 fields 中的全部字段和文件（字段名 file，放在最后）以 multipart/form-data POST 到 uploadUrl
 type UploadTokenResponse struct {
-	Token     string `json:"token"`
-	Domain    string `json:"domain"`
-	Key       string `json:"key"`
-	UploadUrl string `json:"uploadUrl"` // 七牛云上传域名
+	Driver       string            `json:"driver"` // 存储驱动：qiniu / local / s3
+	Token        string            `json:"token"`  // 七牛云和本地存储的上传凭证，兼容旧客户端
+	Domain       string            `json:"domain"`
+	Key          string            `json:"key"`
+	UploadUrl    string            `json:"uploadUrl"`
+	Fields       map[string]string `json:"fields"`
+	URL          string            `json:"url"`          // 上传完成后的照片地址
+	ThumbnailUrl string            `json:"thumbnailUrl"` // 照片缩略图地址
+	OCR          bool              `json:"ocr"`          // 是否可在上传后调用 /upload/ocr 识别
 }
 
-// GetToken 获取七牛云上传凭证
+// GetToken 获取照片直传凭证
 func (h *UploadHandler) GetToken(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
-	cfg := config.Cfg.Qiniu
-
 	// 生成文件名
-	key := fmt.Sprintf("tickets/%d/%d_%s.jpg",
-		userID,
+	key := fmt.Sprintf("%s%d_%s.jpg",
+		upload.KeyPrefix(userID),
 		time.Now().UnixMilli(),
 		randomString(8),
 	)
 
-	// 生成上传凭证
-	putPolicy := storage.PutPolicy{
-		Scope:      fmt.Sprintf("%s:%s", cfg.Bucket, key),
-		Expires:    3600, // 1小时有效期
-		ReturnBody: `{"key":"$(key)","hash":"$(etag)","fsize":$(fsize),"bucket":"$(bucket)"}`,
+	store := storage.Current()
+	form, err := store.PresignUpload(key, maxUploadBytes, uploadTokenExpires)
+	if err != nil {
+		log.Printf("[UploadHandler] 生成上传凭证失败: %v", err)
+		response.ServerError(c, "生成上传凭证失败")
+		return
 	}
 
-	mac := qbox.NewMac(cfg.AccessKey, cfg.SecretKey)
-	upToken := putPolicy.UploadToken(mac)
-
+	url := store.URL(key)
 	response.Success(c, UploadTokenResponse{
-		Token:     upToken,
-		Domain:    cfg.Domain,
-		Key:       key,
-		UploadUrl: cfg.GetUploadURL(),
+		Driver:       store.Name(),
+		Token:        form.Fields["token"],
+		Domain:       strings.TrimSuffix(store.URL(""), "/"),
+		Key:          key,
+		UploadUrl:    form.URL,
+		Fields:       form.Fields,
+		URL:          url,
+		ThumbnailUrl: storage.ThumbnailURL(url),
+		OCR:          ocr.Enabled(),
 	})
 }
 
-// Callback 七牛云上传回调
+// Recognize 对已上传的照片发起异步识别，返回任务供客户端轮询
+func (h *UploadHandler) Recognize(c *gin.Context) {
+	var req model.OCRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	// 只能识别自己上传的照片
+	if !strings.HasPrefix(req.Key, upload.KeyPrefix(userID)) {
+		response.Forbidden(c, "无权识别该照片")
+		return
+	}
+
+	job, err := ocr.Submit(userID, req.Key)
+	if err != nil {
+		switch {
+		case errors.Is(err, ocr.ErrDisabled):
+			response.Error(c, http.StatusServiceUnavailable, "识别服务未启用")
+		case errors.Is(err, ocr.ErrQueueFull):
+			response.Error(c, http.StatusServiceUnavailable, err.Error())
+		default:
+			log.Printf("[UploadHandler] 创建识别任务失败: %v", err)
+			response.ServerError(c, "创建识别任务失败")
+		}
+		return
+	}
+
+	response.Success(c, job)
+}
+
+// GetRecognizeJob 查询识别任务状态，status 为 done 时 result 中为票据草稿
+func (h *UploadHandler) GetRecognizeJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "无效的任务ID")
+		return
+	}
+
+	var job model.OCRJob
+	if err := database.DB.Where("id = ? AND user_id = ?", id, middleware.GetUserID(c)).First(&job).Error; err != nil {
+		response.NotFound(c, "任务不存在")
+		return
+	}
+
+	response.Success(c, job)
+}
+
+// Callback 七牛云上传回调（无需登录，由七牛服务器调用）
+// 校验回调签名后记录上传，响应内容会原样返回给上传的客户端
 func (h *UploadHandler) Callback(c *gin.Context) {
-	// TODO: 验证回调签名
-	// TODO: 处理上传成功后的逻辑（如更新票据图片字段）
+	qiniu, ok := storage.Qiniu()
+	if !ok {
+		response.NotFound(c, "未启用七牛云存储")
+		return
+	}
+	if valid, err := qiniu.VerifyCallback(c.Request); err != nil || !valid {
+		log.Printf("[UploadHandler] 上传回调签名无效: err=%v", err)
+		response.Unauthorized(c, "回调签名无效")
+		return
+	}
+
+	key := c.PostForm("key")
+	userID, ok := upload.Owner(key)
+	if !ok {
+		response.BadRequest(c, "无效的文件 key")
+		return
+	}
+	fsize, _ := strconv.ParseInt(c.PostForm("fsize"), 10, 64)
+	record := model.Upload{
+		UserID: userID,
+		Key:    key,
+		Hash:   c.PostForm("hash"),
+		Fsize:  fsize,
+		Mime:   c.PostForm("mime"),
+	}
+	if err := upload.Record(database.DB, &record); err != nil {
+		log.Printf("[UploadHandler] 记录上传失败: key=%s, err=%v", key, err)
+		response.ServerError(c, "记录上传失败")
+		return
+	}
 
-	response.SuccessMessage(c, "ok")
+	c.JSON(http.StatusOK, gin.H{
+		"key":    key,
+		"hash":   record.Hash,
+		"fsize":  record.Fsize,
+		"bucket": c.PostForm("bucket"),
+	})
 }
 
 // 生成随机字符串
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/response"
+	"piaoji-server/internal/storage"
+	"piaoji-server/internal/upload"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocalUpload 本地存储的直传接口，凭上传凭证写入文件并记录上传（无需登录）
+// 返回内容与七牛云上传一致：{"key","hash","fsize","bucket"}
+func (h *UploadHandler) LocalUpload(c *gin.Context) {
+	local, ok := storage.Local()
+	if !ok {
+		response.NotFound(c, "未启用本地存储")
+		return
+	}
+
+	key := c.PostForm("key")
+	maxBytes, err := local.VerifyUpload(key, c.PostForm("token"))
+	if err != nil {
+		response.Unauthorized(c, err.Error())
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		response.BadRequest(c, "请选择要上传的文件")
+		return
+	}
+	if file.Size > maxBytes {
+		response.BadRequest(c, storage.ErrTooLarge.Error())
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		response.BadRequest(c, "读取文件失败")
+		return
+	}
+	defer src.Close()
+
+	info, err := local.Save(key, src, maxBytes)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTooLarge), errors.Is(err, storage.ErrInvalidKey):
+			response.BadRequest(c, err.Error())
+		default:
+			log.Printf("[UploadHandler] 保存文件失败: key=%s, err=%v", key, err)
+			response.ServerError(c, "保存文件失败")
+		}
+		return
+	}
+
+	userID, _ := upload.Owner(key)
+	if err := upload.Record(database.DB, &model.Upload{
+		UserID: userID,
+		Key:    key,
+		Hash:   info.ETag,
+		Fsize:  info.Size,
+		Mime:   file.Header.Get("Content-Type"),
+	}); err != nil {
+		log.Printf("[UploadHandler] 记录上传失败: key=%s, err=%v", key, err)
+		response.ServerError(c, "记录上传失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":    info.Key,
+		"hash":   info.ETag,
+		"fsize":  info.Size,
+		"bucket": local.Name(),
+	})
+}
+
+// LocalFile 读取本地存储中的文件
+// 开启 private 时必须携带 PrivateURL 生成的 e 和 token 参数
+func (h *UploadHandler) LocalFile(c *gin.Context) {
+	local, ok := storage.Local()
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	token := c.Query("token")
+	if (local.Private() || token != "") && !local.VerifyGet(key, c.Query("e"), token) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	// Stat 会拒绝目录，避免 ServeFile 列出目录内容
+	if _, err := local.Stat(c.Request.Context(), key); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	file, _ := local.File(key)
+	c.File(file)
+}
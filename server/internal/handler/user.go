@@ -2,6 +2,7 @@ package handler
 
 import (
 	"piaoji-server/internal/database"
+	"piaoji-server/internal/identity"
 	"piaoji-server/internal/middleware"
 	"piaoji-server/internal/model"
 	"piaoji-server/internal/response"
@@ -25,7 +26,14 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	response.Success(c, user.ToResponse())
+	resp := user.ToResponse()
+	email, err := identity.Subject(database.DB, userID, model.IdentityEmail)
+	if err != nil {
+		response.ServerError(c, "查询失败")
+		return
+	}
+	resp.Email = email
+	response.Success(c, resp)
 }
 
 // UpdateProfileRequest 更新用户信息请求
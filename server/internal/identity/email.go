@@ -0,0 +1,171 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/mailer"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/secret"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxEmailLen 与 identities.subject、email_codes.email 列长度一致
+const maxEmailLen = 255
+
+var (
+	// ErrInvalidEmail 邮箱地址格式错误
+	ErrInvalidEmail = errors.New("邮箱地址无效")
+	// ErrTooFrequent 超过发送频率限制
+	ErrTooFrequent = errors.New("发送太频繁，请稍后再试")
+	// ErrCodeInvalid 验证码错误、已使用或已过期
+	ErrCodeInvalid = errors.New("验证码错误或已过期")
+	// ErrTooManyAttempts 验证码校验失败次数过多
+	ErrTooManyAttempts = errors.New("验证码错误次数过多，请重新获取")
+)
+
+// NormalizeEmail 校验邮箱地址并转为小写，只接受不带显示名的地址
+func NormalizeEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || len(s) > maxEmailLen {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(s), nil
+}
+
+// SendCode 生成 6 位验证码并发送到邮箱，email 须已经过 NormalizeEmail
+// 同一邮箱按间隔和每小时次数限制，同一 IP 按每小时次数限制
+func SendCode(ctx context.Context, db *gorm.DB, email, purpose string, userID int64, ip string) error {
+	cfg := &config.Cfg.EmailCode
+	if err := checkRate(db, email, ip, cfg); err != nil {
+		return err
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	ttl := cfg.GetTTL()
+	rec := model.EmailCode{
+		Email:     email,
+		Purpose:   purpose,
+		UserID:    userID,
+		CodeHash:  codeHash(email, purpose, code),
+		IP:        ip,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := db.Create(&rec).Error; err != nil {
+		return err
+	}
+
+	err = mailer.Current().Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "票迹验证码",
+		Body: fmt.Sprintf("你的验证码是 %s，%d 分钟内有效。\n\n如果不是你本人操作，请忽略这封邮件。",
+			code, int(ttl.Minutes())),
+	})
+	if err != nil {
+		// 发送失败的验证码不计入频率限制
+		db.Delete(&model.EmailCode{}, rec.ID)
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	return nil
+}
+
+// checkRate 检查发送频率限制
+func checkRate(db *gorm.DB, email, ip string, cfg *config.EmailCodeConfig) error {
+	now := time.Now()
+	var last model.EmailCode
+	err := db.Select("created_at").Where("email = ?", email).Order("id DESC").First(&last).Error
+	if err == nil && now.Sub(last.CreatedAt) < cfg.GetInterval() {
+		return ErrTooFrequent
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	hourAgo := now.Add(-time.Hour)
+	var count int64
+	if err := db.Model(&model.EmailCode{}).
+		Where("email = ? AND created_at > ?", email, hourAgo).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(cfg.GetHourlyLimit()) {
+		return ErrTooFrequent
+	}
+	if ip == "" {
+		return nil
+	}
+	if err := db.Model(&model.EmailCode{}).
+		Where("ip = ? AND created_at > ?", ip, hourAgo).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(cfg.GetIPHourlyLimit()) {
+		return ErrTooFrequent
+	}
+	return nil
+}
+
+// VerifyCode 校验邮箱收到的验证码，成功后验证码失效
+// 只有最新发出的验证码有效；userID 不为 0 时验证码须由该用户发起
+func VerifyCode(db *gorm.DB, email, purpose, code string, userID int64) (*model.EmailCode, error) {
+	var rec model.EmailCode
+	err := db.Where("email = ? AND purpose = ?", email, purpose).Order("id DESC").First(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if rec.UsedAt != nil || now.After(rec.ExpiresAt) || (userID != 0 && rec.UserID != userID) {
+		return nil, ErrCodeInvalid
+	}
+	maxAttempts := config.Cfg.EmailCode.GetMaxAttempts()
+	if rec.Attempts >= maxAttempts {
+		return nil, ErrTooManyAttempts
+	}
+	if subtle.ConstantTimeCompare([]byte(codeHash(email, purpose, code)), []byte(rec.CodeHash)) != 1 {
+		db.Model(&model.EmailCode{}).Where("id = ?", rec.ID).
+			UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		return nil, ErrCodeInvalid
+	}
+
+	// 并发提交同一个验证码时只有一个成功
+	result := db.Model(&model.EmailCode{}).
+		Where("id = ? AND used_at IS NULL AND attempts < ?", rec.ID, maxAttempts).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCodeInvalid
+	}
+	rec.UsedAt = &now
+	return &rec, nil
+}
+
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// codeHash 验证码只保存 HMAC，与邮箱和用途绑定
+func codeHash(email, purpose, code string) string {
+	return secret.Hash(purpose + ":" + email + ":" + code)
+}
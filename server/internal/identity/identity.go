@@ -0,0 +1,100 @@
+package identity
+
+import (
+	"errors"
+	"piaoji-server/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrTaken 该身份已绑定其他用户
+	ErrTaken = errors.New("已被其他账号绑定")
+	// ErrNotFound 没有对应的身份
+	ErrNotFound = errors.New("身份不存在")
+)
+
+// Link 为用户绑定身份，用户已有同类型身份时替换
+// 身份已属于其他用户时返回 ErrTaken
+func Link(db *gorm.DB, userID int64, provider, subject string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var existing model.Identity
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider = ? AND subject = ?", provider, subject).First(&existing).Error
+		if err == nil {
+			if existing.UserID != userID {
+				return ErrTaken
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND provider = ?", userID, provider).
+			Delete(&model.Identity{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.Identity{UserID: userID, Provider: provider, Subject: subject}).Error
+	})
+}
+
+// Find 查找身份，不存在时返回 ErrNotFound
+func Find(db *gorm.DB, provider, subject string) (*model.Identity, error) {
+	var id model.Identity
+	err := db.Where("provider = ? AND subject = ?", provider, subject).First(&id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// Subject 用户某种类型身份的标识，没有时返回空字符串
+func Subject(db *gorm.DB, userID int64, provider string) (string, error) {
+	var subjects []string
+	if err := db.Model(&model.Identity{}).Where("user_id = ? AND provider = ?", userID, provider).
+		Limit(1).Pluck("subject", &subjects).Error; err != nil {
+		return "", err
+	}
+	if len(subjects) == 0 {
+		return "", nil
+	}
+	return subjects[0], nil
+}
+
+// List 用户的全部身份，填充展示用的标识
+func List(db *gorm.DB, user *model.User) ([]model.Identity, error) {
+	var ids []model.Identity
+	if err := db.Where("user_id = ?", user.ID).Order("id ASC").Find(&ids).Error; err != nil {
+		return nil, err
+	}
+	for i := range ids {
+		switch ids[i].Provider {
+		case model.IdentityEmail:
+			ids[i].Display = ids[i].Subject
+		case model.IdentityPhone:
+			if user.Phone != nil {
+				ids[i].Display = *user.Phone
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Backfill 为已有用户补齐微信和手机号身份
+func Backfill(db *gorm.DB) error {
+	if err := db.Exec(`INSERT IGNORE INTO identities (user_id, provider, subject, created_at)
+		SELECT u.id, ?, u.openid, u.created_at FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM identities i WHERE i.user_id = u.id AND i.provider = ?)`,
+		model.IdentityWechat, model.IdentityWechat).Error; err != nil {
+		return err
+	}
+	return db.Exec(`INSERT IGNORE INTO identities (user_id, provider, subject, created_at)
+		SELECT u.id, ?, u.phone_hash, u.updated_at FROM users u
+		WHERE u.phone_hash IS NOT NULL AND u.phone_hash <> ''
+			AND NOT EXISTS (SELECT 1 FROM identities i WHERE i.user_id = u.id AND i.provider = ?)`,
+		model.IdentityPhone, model.IdentityPhone).Error
+}
@@ -0,0 +1,264 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// EXIF 标签
+const (
+	tagOrientation        = 0x0112
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+)
+
+// Metadata 从 EXIF 中读取的照片信息
+type Metadata struct {
+	Orientation int        // 1~8，0 表示未记录
+	TakenAt     *time.Time // 拍摄时间
+	Latitude    *float64   // 拍摄地点，南纬为负
+	Longitude   *float64   // 拍摄地点，西经为负
+}
+
+// ReadMetadata 解析 JPEG 中的 EXIF，没有 EXIF 时 ok 为 false
+// 只读取方向、拍摄时间和 GPS，格式异常的字段忽略
+func ReadMetadata(data []byte) (meta Metadata, ok bool) {
+	tiff := findExif(data)
+	if tiff == nil {
+		return meta, false
+	}
+	r, ok := newTiffReader(tiff)
+	if !ok {
+		return meta, false
+	}
+
+	ifd0 := r.readIFD(r.order.Uint32(tiff[4:8]))
+	if e, ok := ifd0[tagOrientation]; ok {
+		meta.Orientation = int(r.short(e))
+	}
+	if e, ok := ifd0[tagExifIFD]; ok {
+		exif := r.readIFD(r.long(e))
+		if e, ok := exif[tagDateTimeOriginal]; ok {
+			offset := ""
+			if o, ok := exif[tagOffsetTimeOriginal]; ok {
+				offset = r.ascii(o)
+			}
+			meta.TakenAt = parseExifTime(r.ascii(e), offset)
+		}
+	}
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		gps := r.readIFD(r.long(e))
+		meta.Latitude = r.coordinate(gps, tagGPSLatitude, tagGPSLatitudeRef, "S")
+		meta.Longitude = r.coordinate(gps, tagGPSLongitude, tagGPSLongitudeRef, "W")
+	}
+	return meta, true
+}
+
+// findExif 在 JPEG 的 APP1 段中查找 EXIF，返回 TIFF 数据
+func findExif(data []byte) []byte {
+	var tiff []byte
+	eachSegment(data, func(marker byte, segment []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			tiff = segment[6:]
+			return false
+		}
+		return true
+	})
+	return tiff
+}
+
+// hasMetadata JPEG 中是否有 APP1~APP15 或注释段（EXIF、XMP、ICC 等）
+func hasMetadata(data []byte) bool {
+	found := false
+	eachSegment(data, func(marker byte, segment []byte) bool {
+		found = (marker >= 0xE1 && marker <= 0xEF) || marker == 0xFE
+		return !found
+	})
+	return found
+}
+
+// pngMetadataChunks PNG 中可能含有拍摄信息、GPS 或文字说明的辅助块
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// hasPNGMetadata PNG 中是否有 EXIF、文本或时间块
+func hasPNGMetadata(data []byte) bool {
+	if len(data) < 8 || !bytes.Equal(data[:8], []byte("\x89PNG\r\n\x1a\n")) {
+		return false
+	}
+	for i := 8; i+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[i : i+4]))
+		typ := string(data[i+4 : i+8])
+		if pngMetadataChunks[typ] {
+			return true
+		}
+		if typ == "IEND" || size < 0 || i+12+size > len(data) {
+			return false
+		}
+		i += 12 + size
+	}
+	return false
+}
+
+// eachSegment 依次遍历 JPEG 图像数据之前的段，fn 返回 false 时停止
+func eachSegment(data []byte, fn func(marker byte, segment []byte) bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return
+		}
+		marker := data[i+1]
+		// 到达图像数据，后面不会再有元数据段
+		if marker == 0xDA || marker == 0xD9 {
+			return
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if size < 2 || i+2+size > len(data) {
+			return
+		}
+		if !fn(marker, data[i+4:i+2+size]) {
+			return
+		}
+		i += 2 + size
+	}
+}
+
+// ifdEntry IFD 中的一项
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte // 4 字节的值或偏移
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newTiffReader(data []byte) (*tiffReader, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, false
+	}
+	return &tiffReader{data: data, order: order}, true
+}
+
+func (r *tiffReader) readIFD(offset uint32) map[uint16]ifdEntry {
+	entries := map[uint16]ifdEntry{}
+	if int(offset)+2 > len(r.data) {
+		return entries
+	}
+	n := int(r.order.Uint16(r.data[offset:]))
+	for i := 0; i < n; i++ {
+		p := int(offset) + 2 + i*12
+		if p+12 > len(r.data) {
+			break
+		}
+		entries[r.order.Uint16(r.data[p:])] = ifdEntry{
+			typ:   r.order.Uint16(r.data[p+2:]),
+			count: r.order.Uint32(r.data[p+4:]),
+			value: r.data[p+8 : p+12],
+		}
+	}
+	return entries
+}
+
+func (r *tiffReader) short(e ifdEntry) uint16 {
+	return r.order.Uint16(e.value)
+}
+
+func (r *tiffReader) long(e ifdEntry) uint32 {
+	return r.order.Uint32(e.value)
+}
+
+// bytes 值的原始数据，超过 4 字节时按偏移读取
+func (r *tiffReader) bytes(e ifdEntry, size int) []byte {
+	if size <= 4 {
+		return e.value[:size]
+	}
+	offset := int(r.order.Uint32(e.value))
+	if offset < 0 || offset+size > len(r.data) {
+		return nil
+	}
+	return r.data[offset : offset+size]
+}
+
+func (r *tiffReader) ascii(e ifdEntry) string {
+	if e.count > 64 {
+		return ""
+	}
+	return strings.TrimRight(string(r.bytes(e, int(e.count))), "\x00 ")
+}
+
+// rationals 读取 RATIONAL（类型 5）数组
+func (r *tiffReader) rationals(e ifdEntry) []float64 {
+	if e.typ != 5 || e.count == 0 || e.count > 4 {
+		return nil
+	}
+	b := r.bytes(e, int(e.count)*8)
+	if b == nil {
+		return nil
+	}
+	values := make([]float64, e.count)
+	for i := range values {
+		num := r.order.Uint32(b[i*8:])
+		den := r.order.Uint32(b[i*8+4:])
+		if den == 0 {
+			return nil
+		}
+		values[i] = float64(num) / float64(den)
+	}
+	return values
+}
+
+// coordinate 把度、分、秒转换为十进制度数，ref 为 negative 时取负
+func (r *tiffReader) coordinate(gps map[uint16]ifdEntry, tag, refTag uint16, negative string) *float64 {
+	e, ok := gps[tag]
+	if !ok {
+		return nil
+	}
+	dms := r.rationals(e)
+	if len(dms) != 3 {
+		return nil
+	}
+	v := dms[0] + dms[1]/60 + dms[2]/3600
+	if ref, ok := gps[refTag]; ok && strings.EqualFold(r.ascii(ref), negative) {
+		v = -v
+	}
+	return &v
+}
+
+// parseExifTime 解析 "2006:01:02 15:04:05"，有时区偏移（如 +08:00）时使用，否则按本地时区
+func parseExifTime(value, offset string) *time.Time {
+	loc := time.Local
+	if offset != "" {
+		if t, err := time.Parse("-07:00", offset); err == nil {
+			loc = t.Location()
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", value, loc)
+	if err != nil || t.Year() < 1900 {
+		return nil
+	}
+	return &t
+}
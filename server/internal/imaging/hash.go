@@ -0,0 +1,140 @@
+package imaging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"math"
+	"math/bits"
+	"piaoji-server/internal/model"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Fingerprint 照片的内容哈希，用于发现重复上传
+type Fingerprint struct {
+	SHA256 string // 文件内容，完全相同的文件才相等
+	DHash  uint64 // 差异哈希，对缩放、压缩不敏感
+	PHash  uint64 // 感知哈希（DCT），对亮度、轻微裁剪不敏感
+}
+
+// Distance 两张照片的差异：文件相同为 0，否则取两种感知哈希汉明距离的较大值（0~64）
+func Distance(a, b Fingerprint) int {
+	if a.SHA256 != "" && a.SHA256 == b.SHA256 {
+		return 0
+	}
+	return max(bits.OnesCount64(a.DHash^b.DHash), bits.OnesCount64(a.PHash^b.PHash))
+}
+
+// Hash 计算照片的内容哈希，结果记录在上传中，已计算过时直接返回
+// 在图片处理覆盖原图前由处理流程计算，因此 SHA-256 始终对应用户上传的原始文件
+func Hash(ctx context.Context, db *gorm.DB, key string) (Fingerprint, error) {
+	var u model.Upload
+	if err := db.Select("id", "sha256", "dhash", "phash").Where("object_key = ? OR stripped_key = ?", key, key).
+		Limit(1).Find(&u).Error; err != nil {
+		return Fingerprint{}, err
+	}
+	if u.SHA256 != nil && *u.SHA256 != "" && u.DHash != nil && u.PHash != nil {
+		return Fingerprint{SHA256: *u.SHA256, DHash: *u.DHash, PHash: *u.PHash}, nil
+	}
+
+	data, img, _, _, err := load(ctx, key)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	fp := fingerprint(data, img)
+	if u.ID > 0 {
+		db.Model(&model.Upload{}).Where("id = ?", u.ID).Updates(map[string]interface{}{
+			"sha256": fp.SHA256,
+			"dhash":  fp.DHash,
+			"phash":  fp.PHash,
+		})
+	}
+	return fp, nil
+}
+
+// fingerprint 原始文件的 SHA-256 和方向校正后图像的感知哈希
+func fingerprint(data []byte, img *image.RGBA) Fingerprint {
+	sum := sha256.Sum256(data)
+	return Fingerprint{
+		SHA256: hex.EncodeToString(sum[:]),
+		DHash:  dHash(img),
+		PHash:  pHash(img),
+	}
+}
+
+// gray 缩放到 w×h 并转为灰度
+func gray(img *image.RGBA, w, h int) []float64 {
+	small := resample(img, img.Rect, w, h)
+	pixels := make([]float64, w*h)
+	for i := range pixels {
+		p := small.Pix[i*4 : i*4+3]
+		pixels[i] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+	}
+	return pixels
+}
+
+// dHash 缩放到 9×8 灰度，每行相邻像素比较亮度得到 64 位
+func dHash(img *image.RGBA) uint64 {
+	pixels := gray(img, 9, 8)
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if pixels[y*9+x] < pixels[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// pHash 缩放到 32×32 灰度做二维 DCT，取左上 8×8 低频系数与中位数比较得到 64 位
+func pHash(img *image.RGBA) uint64 {
+	const n = 32
+	pixels := gray(img, n, n)
+
+	var cos [n][n]float64
+	for u := 0; u < n; u++ {
+		for x := 0; x < n; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+	// 先按行再按列变换，只需要前 8 个频率
+	var rows [n][8]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < n; x++ {
+				s += pixels[y*n+x] * cos[u][x]
+			}
+			rows[y][u] = s
+		}
+	}
+	coeffs := make([]float64, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for y := 0; y < n; y++ {
+				s += rows[y][u] * cos[v][y]
+			}
+			coeffs[v*8+u] = s
+		}
+	}
+
+	// 直流分量只反映整体亮度，不参与中位数
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var h uint64
+	for _, c := range coeffs {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+	return h
+}
@@ -0,0 +1,115 @@
+package imaging
+
+import (
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/storage"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EXIF 预填字段的置信度：记录的是拍照的时间地点，不一定与票面一致
+const exifConfidence = 0.5
+
+// Link 把已处理完成的上传结果同步到引用这些照片的票据
+// 创建/修改票据后调用，处理在票据保存前已完成时由这里补上，返回同步的上传数
+func Link(db *gorm.DB, userID int64, urls []string) (int, error) {
+	keys := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if key, ok := storage.KeyFromURL(url); ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	var uploads []model.Upload
+	if err := db.Where("user_id = ? AND object_key IN ? AND image_status = ?", userID, keys, model.ImageStatusDone).
+		Find(&uploads).Error; err != nil {
+		return 0, err
+	}
+	for i := range uploads {
+		if err := apply(db, &uploads[i]); err != nil {
+			return 0, err
+		}
+	}
+	return len(uploads), nil
+}
+
+// apply 用处理结果更新票据照片的缩略图、版本和尺寸，照片为封面时同步更新票据缩略图
+// 去除了元数据的照片同时把地址改为新 key
+func apply(db *gorm.DB, u *model.Upload) error {
+	url := storage.URL(u.Key)
+	newURL := url
+	if u.StrippedKey != "" {
+		newURL = storage.URL(u.StrippedKey)
+	}
+	thumb := u.Variants.Thumbnail()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"url":      newURL,
+			"variants": u.Variants,
+			"width":    u.Width,
+			"height":   u.Height,
+			"bytes":    u.Fsize,
+		}
+		if thumb != "" {
+			updates["thumbnail"] = thumb
+		}
+		if u.SHA256 != nil && u.DHash != nil && u.PHash != nil {
+			updates["sha256"], updates["dhash"], updates["phash"] = u.SHA256, u.DHash, u.PHash
+		}
+		if err := tx.Model(&model.TicketPhoto{}).Where("user_id = ? AND url = ?", u.UserID, url).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		cover := map[string]interface{}{"photo": newURL}
+		if thumb != "" {
+			cover["thumbnail"] = thumb
+		}
+		return tx.Model(&model.Ticket{}).Where("user_id = ? AND photo = ?", u.UserID, url).
+			UpdateColumns(cover).Error
+	})
+}
+
+// Resolve 照片当前的对象 key：去除元数据后原图已删除，返回新 key
+func Resolve(db *gorm.DB, key string) string {
+	var stripped string
+	if err := db.Model(&model.Upload{}).Where("object_key = ? AND stripped_key <> ''", key).
+		Limit(1).Pluck("stripped_key", &stripped).Error; err != nil || stripped == "" {
+		return key
+	}
+	return stripped
+}
+
+// FillDraft 用照片 EXIF 中的拍摄时间和 GPS 补全识别草稿中缺失的日期和坐标
+// 照片已被处理（EXIF 已去除）时使用处理前记录在上传中的信息
+func FillDraft(db *gorm.DB, draft *model.OCRDraft, data []byte, key string) {
+	meta, _ := ReadMetadata(data)
+	if meta.TakenAt == nil && meta.Latitude == nil {
+		var u model.Upload
+		if err := db.Select("taken_at", "latitude", "longitude").
+			Where("object_key = ?", key).First(&u).Error; err == nil {
+			meta.TakenAt, meta.Latitude, meta.Longitude = u.TakenAt, u.Latitude, u.Longitude
+		}
+	}
+
+	t := &draft.Ticket
+	if t.Date == nil && meta.TakenAt != nil {
+		date := meta.TakenAt.Format(time.RFC3339)
+		t.Date = &date
+		draft.Confidence["date"] = exifConfidence
+	}
+	if meta.Latitude != nil && meta.Longitude != nil {
+		coordinate := &model.Coordinate{Latitude: *meta.Latitude, Longitude: *meta.Longitude}
+		if t.Location == nil {
+			t.Location = &model.Location{Type: "single"}
+		}
+		if t.Location.Coordinate == nil {
+			t.Location.Coordinate = coordinate
+			draft.Confidence["location.coordinate"] = exifConfidence
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册 GIF 解码
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"os/exec"
+	"path"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize      = 100      // 排队中的任务上限
+	maxImageBytes  = 20 << 20 // 参与处理的照片最大 20MB
+	maxImagePixels = 50e6     // 解码前按尺寸拒绝超大图片，避免占用过多内存
+	maxErrorLen    = 255      // 与 uploads.image_error 列长度一致
+	processTimeout = 2 * time.Minute
+	maxAttempts    = 3           // 暂时性错误最多处理次数（含第一次）
+	retryDelay     = time.Minute // 第 n 次失败后等待 n 倍的时间再重试
+)
+
+var (
+	// ErrDisabled 图片处理未启用
+	ErrDisabled = errors.New("图片处理未启用")
+	// ErrInvalidImage 文件不是可处理的图片，重试也不会成功
+	ErrInvalidImage = errors.New("无法处理的图片")
+)
+
+// pipeline 进程内异步图片处理队列，处理状态持久化在 uploads 表中
+type pipeline struct {
+	cfg    *config.ImageConfig
+	webp   bool
+	jobs   chan int64
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var p *pipeline
+
+// Start 启动图片处理 worker，未启用时返回 ErrDisabled
+// 上次退出时未处理完的上传会重新排队
+func Start(cfg *config.ImageConfig) error {
+	if !cfg.Enabled {
+		return ErrDisabled
+	}
+
+	webp := cfg.WebP
+	if webp {
+		if _, err := exec.LookPath(cfg.GetCWebP()); err != nil {
+			log.Printf("[Image] 找不到 cwebp，不生成 WebP 版本: %v", err)
+			webp = false
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p = &pipeline{
+		cfg:    cfg,
+		webp:   webp,
+		jobs:   make(chan int64, queueSize),
+		cancel: cancel,
+	}
+	for i := 0; i < cfg.GetWorkers(); i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-p.jobs:
+					p.run(ctx, id)
+				}
+			}
+		}()
+	}
+
+	// 旧版本处理失败后不再重试，原图仍带有元数据，重新处理一次
+	database.DB.Model(&model.Upload{}).Where("image_status = ? AND image_attempts = ?", model.ImageStatusFailed, 0).
+		Update("image_status", model.ImageStatusPending)
+
+	var pending []int64
+	database.DB.Model(&model.Upload{}).Where("image_status = ?", model.ImageStatusPending).
+		Order("id ASC").Pluck("id", &pending)
+	if len(pending) > 0 {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for _, id := range pending {
+				select {
+				case <-ctx.Done():
+					return
+				case p.jobs <- id:
+				}
+			}
+		}()
+	}
+
+	log.Printf("[Image] 图片处理已启动: workers=%d, webp=%v, 待处理 %d 张", cfg.GetWorkers(), webp, len(pending))
+	return nil
+}
+
+// Stop 停止 worker，等待进行中的任务结束
+func Stop() {
+	if p == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Enabled 图片处理是否可用
+func Enabled() bool {
+	return p != nil
+}
+
+// ExtractMetadata 是否在去除 EXIF 前记录拍摄时间和 GPS
+func ExtractMetadata() bool {
+	return p != nil && p.cfg.ExtractMetadata
+}
+
+// Submit 将上传放入处理队列，队列已满时保持 pending，下次启动时处理
+func Submit(uploadID int64) {
+	if p == nil {
+		return
+	}
+	select {
+	case p.jobs <- uploadID:
+	default:
+		log.Printf("[Image] 处理队列已满，稍后处理: upload=%d", uploadID)
+	}
+}
+
+// run 处理单个上传并把结果同步到引用它的票据照片
+func (p *pipeline) run(ctx context.Context, id int64) {
+	var u model.Upload
+	if err := database.DB.First(&u, id).Error; err != nil {
+		log.Printf("[Image] 上传记录不存在: id=%d, err=%v", id, err)
+		return
+	}
+	if u.ImageStatus != model.ImageStatusPending {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, processTimeout)
+	defer cancel()
+
+	if err := p.process(ctx, &u); err != nil {
+		if ctx.Err() != nil && errors.Is(ctx.Err(), context.Canceled) {
+			// 服务退出，保持 pending 下次启动重试
+			return
+		}
+		p.fail(&u, err)
+		return
+	}
+
+	if err := database.DB.Model(&model.Upload{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"image_status": model.ImageStatusDone,
+		"image_error":  "",
+		"stripped_key": u.StrippedKey,
+		"fsize":        u.Fsize,
+		"width":        u.Width,
+		"height":       u.Height,
+		"variants":     u.Variants,
+		"taken_at":     u.TakenAt,
+		"latitude":     u.Latitude,
+		"longitude":    u.Longitude,
+		"sha256":       u.SHA256,
+		"dhash":        u.DHash,
+		"phash":        u.PHash,
+	}).Error; err != nil {
+		log.Printf("[Image] 保存处理结果失败: key=%s, err=%v", u.Key, err)
+		return
+	}
+	if err := apply(database.DB, &u); err != nil {
+		log.Printf("[Image] 更新票据照片失败: key=%s, err=%v", u.Key, err)
+		return
+	}
+	// 票据照片已改为引用去除元数据后的照片，删除带元数据的原图
+	if u.StrippedKey != "" {
+		if err := storage.Current().Delete(ctx, []string{u.Key}); err != nil {
+			log.Printf("[Image] 删除原图失败: key=%s, err=%v", u.Key, err)
+		}
+	}
+}
+
+// fail 记录处理失败
+// 原图不存在时记为 failed；暂时性错误保持 pending，稍后重试，共 maxAttempts 次；
+// 无法解码或重试用尽时原图的元数据无法去除，记为 rejected 并删除原图，不再以带 EXIF/GPS 的原图提供访问
+func (p *pipeline) fail(u *model.Upload, err error) {
+	attempts := u.ImageAttempts + 1
+	msg := []rune(err.Error())
+	if len(msg) > maxErrorLen {
+		msg = msg[:maxErrorLen]
+	}
+
+	status := model.ImageStatusPending
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		status = model.ImageStatusFailed
+	case errors.Is(err, ErrInvalidImage), attempts >= maxAttempts:
+		status = model.ImageStatusRejected
+	}
+	log.Printf("[Image] 处理失败: key=%s, attempts=%d, status=%s, err=%v", u.Key, attempts, status, err)
+
+	if err := database.DB.Model(&model.Upload{}).Where("id = ?", u.ID).Updates(map[string]interface{}{
+		"image_status":   status,
+		"image_error":    string(msg),
+		"image_attempts": attempts,
+	}).Error; err != nil {
+		log.Printf("[Image] 保存处理状态失败: key=%s, err=%v", u.Key, err)
+		return
+	}
+
+	switch status {
+	case model.ImageStatusPending:
+		id := u.ID
+		time.AfterFunc(time.Duration(attempts)*retryDelay, func() { Submit(id) })
+	case model.ImageStatusRejected:
+		// 处理超时后 ctx 已失效，删除使用新的 context
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := storage.Current().Delete(ctx, []string{u.Key}); err != nil {
+			log.Printf("[Image] 删除无法处理的照片失败: key=%s, err=%v", u.Key, err)
+		}
+	}
+}
+
+// process 下载原图 → 按 EXIF 方向校正 → 去除元数据写入新 key → 生成各尺寸版本
+// 只处理 JPEG、PNG 和 GIF，其他格式（如 HEIC）无法解码，返回 ErrInvalidImage
+func (p *pipeline) process(ctx context.Context, u *model.Upload) error {
+	data, img, meta, format, err := load(ctx, u.Key)
+	if err != nil {
+		return err
+	}
+	u.Width, u.Height = img.Rect.Dx(), img.Rect.Dy()
+	if p.cfg.ExtractMetadata {
+		u.TakenAt, u.Latitude, u.Longitude = meta.TakenAt, meta.Latitude, meta.Longitude
+	}
+	// 去除元数据前记录内容哈希
+	if u.SHA256 == nil || *u.SHA256 == "" {
+		fp := fingerprint(data, img)
+		u.SHA256, u.DHash, u.PHash = &fp.SHA256, &fp.DHash, &fp.PHash
+	}
+
+	// 重新编码即去除全部 EXIF/XMP/文本块（含 GPS），方向已校正到像素中
+	// 写入新 key 而不是覆盖原图，避免 CDN 和客户端缓存中仍是带元数据的版本
+	base := strings.TrimSuffix(u.Key, path.Ext(u.Key))
+	u.StrippedKey = ""
+	stripped, contentType, ext, err := strip(data, img, format)
+	if err != nil {
+		return err
+	}
+	if stripped != nil {
+		key := base + "_s" + ext
+		if err := storage.Current().Put(ctx, key, bytes.NewReader(stripped), int64(len(stripped)), contentType); err != nil {
+			return err
+		}
+		u.StrippedKey = key
+		u.Fsize = int64(len(stripped))
+	}
+
+	u.Variants = nil
+	thumb := p.cfg.GetThumbnailSize()
+	if err := p.addVariants(ctx, u, Square(img, thumb), fmt.Sprintf("%s_%dc", base, thumb), thumb, true); err != nil {
+		return err
+	}
+	for _, size := range p.cfg.GetSizes() {
+		if size <= 0 || (u.Width <= size && u.Height <= size) {
+			continue
+		}
+		if err := p.addVariants(ctx, u, Fit(img, size), fmt.Sprintf("%s_%d", base, size), size, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addVariants 写入一个尺寸的 JPEG 和 WebP 版本
+func (p *pipeline) addVariants(ctx context.Context, u *model.Upload, img *image.RGBA, base string, size int, crop bool) error {
+	quality := p.cfg.GetQuality()
+
+	data, err := encodeJPEG(img, quality)
+	if err != nil {
+		return err
+	}
+	if err := p.put(ctx, u, base+".jpg", data, "image/jpeg", img, size, crop, "jpeg"); err != nil {
+		return err
+	}
+
+	if !p.webp {
+		return nil
+	}
+	data, err = encodeWebP(ctx, p.cfg.GetCWebP(), img, quality)
+	if err != nil {
+		return err
+	}
+	return p.put(ctx, u, base+".webp", data, "image/webp", img, size, crop, "webp")
+}
+
+func (p *pipeline) put(ctx context.Context, u *model.Upload, key string, data []byte, contentType string,
+	img *image.RGBA, size int, crop bool, format string) error {
+	if err := storage.Current().Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return err
+	}
+	u.Variants = append(u.Variants, model.PhotoVariant{
+		Size:   size,
+		Crop:   crop,
+		Format: format,
+		Width:  img.Rect.Dx(),
+		Height: img.Rect.Dy(),
+		URL:    storage.URL(key),
+	})
+	return nil
+}
+
+// load 下载并解码照片，按 EXIF 方向校正
+func load(ctx context.Context, key string) (data []byte, img *image.RGBA, meta Metadata, format string, err error) {
+	body, err := storage.Current().Open(ctx, key)
+	if err != nil {
+		return nil, nil, meta, "", fmt.Errorf("下载照片失败: %w", err)
+	}
+	data, err = io.ReadAll(io.LimitReader(body, maxImageBytes+1))
+	body.Close()
+	if err != nil {
+		return nil, nil, meta, "", fmt.Errorf("下载照片失败: %w", err)
+	}
+	if len(data) > maxImageBytes {
+		return nil, nil, meta, "", fmt.Errorf("%w: 照片过大", ErrInvalidImage)
+	}
+
+	imgCfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, meta, "", fmt.Errorf("%w: 不支持的图片格式: %v", ErrInvalidImage, err)
+	}
+	if float64(imgCfg.Width)*float64(imgCfg.Height) > maxImagePixels {
+		return nil, nil, meta, "", fmt.Errorf("%w: 照片像素过多", ErrInvalidImage)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, meta, "", fmt.Errorf("%w: 解码照片失败: %v", ErrInvalidImage, err)
+	}
+
+	meta, _ = ReadMetadata(data)
+	return data, Orient(src, meta.Orientation), meta, format, nil
+}
+
+// strip 照片含有元数据时重新编码，返回去除元数据后的文件；没有元数据时返回 nil
+// GIF 的注释和应用扩展无法可靠识别，一律转为 PNG
+func strip(data []byte, img *image.RGBA, format string) (out []byte, contentType, ext string, err error) {
+	switch {
+	case format == "jpeg" && hasMetadata(data):
+		out, err = encodeJPEG(img, 92)
+		return out, "image/jpeg", ".jpg", err
+	case format == "png" && hasPNGMetadata(data), format == "gif":
+		out, err = encodePNG(img)
+		return out, "image/png", ".png", err
+	}
+	return nil, "", "", nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("编码 PNG 失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("编码 JPEG 失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// toRGBA 转为从 (0,0) 开始的 RGBA 图像
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// Orient 按 EXIF 方向（1~8）旋转/翻转图像，使其正向显示
+func Orient(img image.Image, orientation int) *image.RGBA {
+	src := toRGBA(img)
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := sw, sh
+	if orientation >= 5 {
+		dw, dh = sh, sw
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻转
+				sx, sy = sw-1-x, y
+			case 3: // 旋转 180°
+				sx, sy = sw-1-x, sh-1-y
+			case 4: // 垂直翻转
+				sx, sy = x, sh-1-y
+			case 5: // 沿主对角线翻转
+				sx, sy = y, x
+			case 6: // 顺时针旋转 90°
+				sx, sy = y, sh-1-x
+			case 7: // 沿副对角线翻转
+				sx, sy = sw-1-y, sh-1-x
+			case 8: // 逆时针旋转 90°
+				sx, sy = sw-1-y, x
+			}
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// Fit 等比缩小到长边不超过 size，图像本身更小时原样返回
+func Fit(img *image.RGBA, size int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		return resample(img, img.Rect, size, max(1, int(math.Round(float64(h)*float64(size)/float64(w)))))
+	}
+	return resample(img, img.Rect, max(1, int(math.Round(float64(w)*float64(size)/float64(h)))), size)
+}
+
+// Square 居中裁剪为正方形并缩放到 size×size
+func Square(img *image.RGBA, size int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	side := min(w, h)
+	x0, y0 := (w-side)/2, (h-side)/2
+	return resample(img, image.Rect(x0, y0, x0+side, y0+side), size, size)
+}
+
+// resample 区域平均缩放：目标像素取其覆盖的源像素平均值，缩小时不会产生锯齿
+func resample(src *image.RGBA, r image.Rectangle, dw, dh int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	sx := float64(r.Dx()) / float64(dw)
+	sy := float64(r.Dy()) / float64(dh)
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := span(r.Min.Y, r.Max.Y, y, sy)
+		for x := 0; x < dw; x++ {
+			x0, x1 := span(r.Min.X, r.Max.X, x, sx)
+
+			var sum [4]uint64
+			for yy := y0; yy < y1; yy++ {
+				i := src.PixOffset(x0, yy)
+				for xx := x0; xx < x1; xx++ {
+					sum[0] += uint64(src.Pix[i])
+					sum[1] += uint64(src.Pix[i+1])
+					sum[2] += uint64(src.Pix[i+2])
+					sum[3] += uint64(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			d := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[d+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// span 目标第 i 个像素对应的源像素范围 [start, end)，至少包含一个像素
+func span(lo, hi, i int, scale float64) (int, int) {
+	start := lo + int(float64(i)*scale)
+	end := lo + int(math.Ceil(float64(i+1)*scale))
+	if end > hi {
+		end = hi
+	}
+	if start >= end {
+		start = end - 1
+	}
+	return start, end
+}
@@ -0,0 +1,51 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// encodeWebP 调用 cwebp 命令行编码 WebP（标准库没有 WebP 编码器）
+// 以无损 PNG 作为中间格式，通过临时文件传递
+func encodeWebP(ctx context.Context, cwebp string, img image.Image, quality int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "piaoji-webp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.png")
+	out := filepath.Join(dir, "out.webp")
+
+	f, err := os.Create(in)
+	if err != nil {
+		return nil, err
+	}
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(f, img); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, cwebp, "-quiet", "-q", strconv.Itoa(quality), in, "-o", out)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("cwebp 执行失败: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(out)
+}
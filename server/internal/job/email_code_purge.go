@@ -0,0 +1,26 @@
+package job
+
+import (
+	"context"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"time"
+)
+
+// emailCodeRetention 过期验证码的保留时长，发送频率限制只需要最近一小时的记录
+const emailCodeRetention = 24 * time.Hour
+
+// PurgeEmailCodes 删除过期超过保留时长的邮箱验证码
+func PurgeEmailCodes(ctx context.Context) error {
+	result := database.DB.WithContext(ctx).
+		Where("expires_at < ?", time.Now().Add(-emailCodeRetention)).
+		Delete(&model.EmailCode{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[EmailCodePurge] 删除过期验证码 %d 条", result.RowsAffected)
+	}
+	return nil
+}
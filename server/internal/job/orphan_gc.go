@@ -0,0 +1,217 @@
+package job
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/storage"
+	"piaoji-server/internal/upload"
+	"time"
+)
+
+// 每页列举的对象数和每批处理的用户数
+const (
+	orphanListLimit = 1000
+	orphanUserBatch = 100
+)
+
+// orphanMetrics 孤儿照片清理的累计指标，通过 expvar 的 orphan_gc 暴露
+var orphanMetrics = expvar.NewMap("orphan_gc")
+
+// orphanStats 单次清理的统计
+type orphanStats struct {
+	scanned       int
+	orphaned      int
+	orphanedBytes int64
+	deleted       int
+	reclaimed     int64
+	staleUploads  int
+	skippedUsers  int
+}
+
+func (s *orphanStats) publish() {
+	orphanMetrics.Add("runs", 1)
+	orphanMetrics.Add("scanned_objects", int64(s.scanned))
+	orphanMetrics.Add("orphaned_objects", int64(s.orphaned))
+	orphanMetrics.Add("orphaned_bytes", s.orphanedBytes)
+	orphanMetrics.Add("deleted_objects", int64(s.deleted))
+	orphanMetrics.Add("reclaimed_bytes", s.reclaimed)
+	orphanMetrics.Add("stale_uploads", int64(s.staleUploads))
+	orphanMetrics.Add("skipped_users", int64(s.skippedUsers))
+
+	last := new(expvar.Int)
+	last.Set(time.Now().Unix())
+	orphanMetrics.Set("last_run_unix", last)
+}
+
+// CollectOrphans 清理存储中没有被任何票据引用的照片
+// 按用户列举 tickets/<userID>/ 下的对象，与该用户的票据照片（含回收站）比对；
+// 未被引用且上传时间（有上传记录时以记录为准，否则取对象时间）早于宽限期的对象视为孤儿
+func CollectOrphans(ctx context.Context) error {
+	cfg := config.Cfg.OrphanGC
+	cutoff := time.Now().Add(-cfg.GetGracePeriod())
+
+	var stats orphanStats
+	defer stats.publish()
+
+	var lastID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var userIDs []int64
+		if err := database.DB.Model(&model.User{}).
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(orphanUserBatch).
+			Pluck("id", &userIDs).Error; err != nil {
+			return fmt.Errorf("查询用户失败: %w", err)
+		}
+		if len(userIDs) == 0 {
+			break
+		}
+		lastID = userIDs[len(userIDs)-1]
+
+		// 单个用户失败不影响其他用户，下次执行重试
+		for _, userID := range userIDs {
+			if err := collectUserOrphans(ctx, userID, cutoff, cfg.DryRun, &stats); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("[OrphanGC] 清理用户 %d 的孤儿照片失败: %v", userID, err)
+			}
+		}
+	}
+
+	if stats.orphaned > 0 || stats.staleUploads > 0 || stats.skippedUsers > 0 {
+		log.Printf("[OrphanGC] 清理完成: 扫描 %d 个对象，孤儿 %d 个（%d 字节），已删除 %d 个，回收 %d 字节，过期上传记录 %d 条，跳过用户 %d 个，dry-run=%v",
+			stats.scanned, stats.orphaned, stats.orphanedBytes, stats.deleted, stats.reclaimed, stats.staleUploads, stats.skippedUsers, cfg.DryRun)
+	}
+	return nil
+}
+
+// collectUserOrphans 清理单个用户的孤儿照片
+func collectUserOrphans(ctx context.Context, userID int64, cutoff time.Time, dryRun bool, stats *orphanStats) error {
+	// 先列举再查询引用，列举之后新建的票据引用也能被看到
+	var objects []storage.ObjectInfo
+	marker := ""
+	for {
+		page, next, err := storage.Current().List(ctx, upload.KeyPrefix(userID), marker, orphanListLimit)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, page...)
+		if next == "" {
+			break
+		}
+		marker = next
+	}
+	stats.scanned += len(objects)
+
+	var photos []model.TicketPhoto
+	if err := database.DB.Select("url", "variants").Where("user_id = ?", userID).
+		Find(&photos).Error; err != nil {
+		return err
+	}
+	// 有照片地址无法解析为当前存储的 key 时（如切换过存储驱动或域名），
+	// 无法确认哪些对象仍被引用，跳过该用户，不删除任何内容
+	referenced := make(map[string]bool, len(photos))
+	for _, p := range photos {
+		for _, url := range photo.URLsOf(p) {
+			key, ok := storage.KeyFromURL(url)
+			if !ok {
+				log.Printf("[OrphanGC] 警告: 用户 %d 的照片地址不在当前存储中，跳过该用户: %s", userID, url)
+				stats.skippedUsers++
+				return nil
+			}
+			referenced[key] = true
+		}
+	}
+
+	var uploads []model.Upload
+	if err := database.DB.Select("id", "object_key", "stripped_key", "created_at").
+		Where("user_id = ?", userID).Find(&uploads).Error; err != nil {
+		return err
+	}
+	uploadedAt := make(map[string]time.Time, len(uploads))
+	for _, u := range uploads {
+		uploadedAt[u.Key] = u.CreatedAt
+		if u.StrippedKey != "" {
+			uploadedAt[u.StrippedKey] = u.CreatedAt
+		}
+	}
+
+	listed := make(map[string]bool, len(objects))
+	orphaned := make(map[string]bool)
+	var orphans []string
+	var orphanBytes int64
+	for _, obj := range objects {
+		listed[obj.Key] = true
+		if referenced[obj.Key] {
+			continue
+		}
+		at, ok := uploadedAt[obj.Key]
+		if !ok {
+			at = obj.ModTime
+		}
+		if at.After(cutoff) {
+			continue
+		}
+
+		stats.orphaned++
+		stats.orphanedBytes += obj.Size
+		if dryRun {
+			log.Printf("[OrphanGC] dry-run: 将删除对象 %s（%d 字节，上传于 %s）", obj.Key, obj.Size, at.Format(time.RFC3339))
+			continue
+		}
+		orphans = append(orphans, obj.Key)
+		orphaned[obj.Key] = true
+		orphanBytes += obj.Size
+	}
+
+	// 对象已不存在且未被引用的上传记录；去除元数据后原图已删除，以新 key 为准
+	gone := func(key string) bool {
+		return !referenced[key] && (!listed[key] || orphaned[key])
+	}
+	var stale, removed []int64
+	for _, u := range uploads {
+		if !gone(u.Key) || (u.StrippedKey != "" && !gone(u.StrippedKey)) || !u.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if orphaned[u.Key] || orphaned[u.StrippedKey] {
+			removed = append(removed, u.ID)
+		} else {
+			stale = append(stale, u.ID)
+		}
+	}
+	stats.staleUploads += len(stale)
+	if dryRun {
+		return nil
+	}
+
+	if len(orphans) > 0 {
+		// 部分删除失败时不统计本用户，下次执行重试
+		if err := storage.DeleteObjects(orphans); err != nil {
+			return err
+		}
+		stats.deleted += len(orphans)
+		stats.reclaimed += orphanBytes
+	}
+	if len(removed) > 0 {
+		if err := database.DB.Where("id IN ?", removed).Delete(&model.Upload{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		if err := database.DB.Where("id IN ?", stale).Delete(&model.Upload{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/dedup"
+	"piaoji-server/internal/model"
+)
+
+// 每批补算哈希的照片数
+const photoHashBatch = 100
+
+// HashPhotos 为还没有内容哈希的照片补算哈希（功能上线前的照片、创建时计算失败的照片）
+// 对象不存在或不是图片的照片记为空哈希，不再重试；其他失败（如存储暂时不可用）下次执行重试
+func HashPhotos(ctx context.Context) error {
+	var lastID int64
+	hashed, failed := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var photos []model.TicketPhoto
+		if err := database.DB.Select("id", "url", "sha256").
+			Where("sha256 IS NULL AND id > ?", lastID).
+			Order("id ASC").
+			Limit(photoHashBatch).
+			Find(&photos).Error; err != nil {
+			return fmt.Errorf("查询照片失败: %w", err)
+		}
+		if len(photos) == 0 {
+			break
+		}
+		lastID = photos[len(photos)-1].ID
+
+		invalid := dedup.Hash(ctx, database.DB, photos)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, p := range photos {
+			if p.SHA256 != nil {
+				hashed++
+			} else {
+				failed++
+			}
+		}
+		if err := dedup.MarkInvalid(database.DB, invalid); err != nil {
+			return err
+		}
+	}
+
+	if hashed > 0 || failed > 0 {
+		log.Printf("[PhotoHash] 补算照片哈希完成: 成功 %d 张，失败 %d 张", hashed, failed)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Func 定时任务函数
+type Func func(ctx context.Context) error
+
+type entry struct {
+	name     string
+	interval time.Duration
+	fn       Func
+}
+
+// Scheduler 进程内定时任务调度器
+// 每个任务在独立的 goroutine 中串行执行，启动时立即执行一次，之后按间隔重复
+type Scheduler struct {
+	entries []entry
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every 注册按固定间隔执行的任务，需在 Start 之前调用
+func (s *Scheduler) Every(name string, interval time.Duration, fn Func) {
+	s.entries = append(s.entries, entry{name: name, interval: interval, fn: fn})
+}
+
+// Start 启动所有任务
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go func(e entry) {
+			defer s.wg.Done()
+			log.Printf("[Job] 任务 %s 已启动，间隔 %s", e.name, e.interval)
+
+			ticker := time.NewTicker(e.interval)
+			defer ticker.Stop()
+			for {
+				run(ctx, e)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(e)
+	}
+}
+
+// Stop 停止所有任务并等待正在执行的任务结束
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// run 执行一次任务，捕获 panic 避免影响其他任务
+func run(ctx context.Context, e entry) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Job] 任务 %s panic: %v", e.name, r)
+		}
+	}()
+
+	start := time.Now()
+	if err := e.fn(ctx); err != nil {
+		log.Printf("[Job] 任务 %s 执行失败: %v", e.name, err)
+		return
+	}
+	log.Printf("[Job] 任务 %s 执行完成，耗时 %s", e.name, time.Since(start))
+}
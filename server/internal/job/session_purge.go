@@ -0,0 +1,27 @@
+package job
+
+import (
+	"context"
+	"log"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"time"
+)
+
+// sessionRetention 过期或退出的会话保留时长，便于排查登录问题
+const sessionRetention = 7 * 24 * time.Hour
+
+// PurgeSessions 删除已过期或已退出超过保留时长的会话
+func PurgeSessions(ctx context.Context) error {
+	cutoff := time.Now().Add(-sessionRetention)
+	result := database.DB.WithContext(ctx).
+		Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).
+		Delete(&model.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[SessionPurge] 删除过期会话 %d 条", result.RowsAffected)
+	}
+	return nil
+}
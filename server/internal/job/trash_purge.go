@@ -0,0 +1,168 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/photo"
+	"piaoji-server/internal/storage"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// userCounter 单个用户需要扣减的统计数
+type userCounter struct {
+	tickets int
+	photos  int
+}
+
+// PurgeTrash 永久删除超过保留期的回收站票据
+// 分批处理：每批在一个事务内删除票据并扣减用户统计，提交后再删除存储中的照片
+func PurgeTrash(ctx context.Context) error {
+	cfg := config.Cfg.Trash
+	cutoff := time.Now().Add(-cfg.GetRetention())
+
+	var lastID int64
+	purged, objects := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var tickets []model.Ticket
+		if err := database.DB.Select("id", "user_id", "name", "photo", "deleted_at").
+			Where("is_deleted = ? AND deleted_at < ? AND id > ?", true, cutoff, lastID).
+			Order("id ASC").
+			Limit(cfg.GetBatchSize()).
+			Find(&tickets).Error; err != nil {
+			return fmt.Errorf("查询过期票据失败: %w", err)
+		}
+		if len(tickets) == 0 {
+			break
+		}
+		lastID = tickets[len(tickets)-1].ID
+
+		if cfg.DryRun {
+			for _, t := range tickets {
+				log.Printf("[TrashPurge] dry-run: 将删除票据 ID=%d UserID=%d Name=%s DeletedAt=%s",
+					t.ID, t.UserID, t.Name, t.DeletedAt.Format(time.RFC3339))
+			}
+			purged += len(tickets)
+			continue
+		}
+
+		deleted, photos, err := purgeBatch(tickets, cutoff)
+		if err != nil {
+			return err
+		}
+		purged += deleted
+		keys, err := photoKeys(photos)
+		if err != nil {
+			log.Printf("[TrashPurge] 查询照片引用失败: %v", err)
+			continue
+		}
+
+		// 数据库已提交，存储删除失败只记录日志，由孤儿文件清理兜底
+		if err := storage.DeleteObjects(keys); err != nil {
+			log.Printf("[TrashPurge] 删除照片失败: %v", err)
+		} else {
+			objects += len(keys)
+		}
+	}
+
+	if purged > 0 {
+		log.Printf("[TrashPurge] 清理完成: 票据 %d 张，照片 %d 个，dry-run=%v", purged, objects, cfg.DryRun)
+	}
+	return nil
+}
+
+// purgeBatch 在事务中删除一批票据并扣减用户统计，返回实际删除数和被删除的照片记录
+func purgeBatch(candidates []model.Ticket, cutoff time.Time) (int, []model.TicketPhoto, error) {
+	ids := make([]int64, len(candidates))
+	for i, t := range candidates {
+		ids[i] = t.ID
+	}
+
+	var photos []model.TicketPhoto
+	var deleted int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 加锁重新确认，避免与恢复操作竞争
+		var tickets []model.Ticket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "user_id").
+			Where("id IN ? AND is_deleted = ? AND deleted_at < ?", ids, true, cutoff).
+			Find(&tickets).Error; err != nil {
+			return err
+		}
+		if len(tickets) == 0 {
+			return nil
+		}
+
+		lockedIDs := make([]int64, len(tickets))
+		for i, t := range tickets {
+			lockedIDs[i] = t.ID
+		}
+
+		// 每张照片都从配额中扣减，照片记录由外键级联删除
+		if err := tx.Select("id", "user_id", "url", "variants").Where("ticket_id IN ?", lockedIDs).
+			Find(&photos).Error; err != nil {
+			return err
+		}
+
+		counters := make(map[int64]*userCounter)
+		counterOf := func(userID int64) *userCounter {
+			if counters[userID] == nil {
+				counters[userID] = &userCounter{}
+			}
+			return counters[userID]
+		}
+		for _, t := range tickets {
+			counterOf(t.UserID).tickets++
+		}
+		for _, p := range photos {
+			counterOf(p.UserID).photos++
+		}
+
+		if err := tx.Where("id IN ?", lockedIDs).Delete(&model.Ticket{}).Error; err != nil {
+			return err
+		}
+
+		for userID, counter := range counters {
+			if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+				"ticket_count": gorm.Expr("GREATEST(ticket_count - ?, 0)", counter.tickets),
+				"photo_count":  gorm.Expr("GREATEST(photo_count - ?, 0)", counter.photos),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		deleted = len(tickets)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("删除过期票据失败: %w", err)
+	}
+	return deleted, photos, nil
+}
+
+// photoKeys 按用户汇总可以从存储中删除的照片对象 key，须在删除照片记录后调用
+func photoKeys(photos []model.TicketPhoto) ([]string, error) {
+	byUser := make(map[int64][]model.TicketPhoto)
+	for _, p := range photos {
+		byUser[p.UserID] = append(byUser[p.UserID], p)
+	}
+	var keys []string
+	for userID, list := range byUser {
+		userKeys, err := photo.Keys(database.DB, userID, list)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, userKeys...)
+	}
+	return keys, nil
+}
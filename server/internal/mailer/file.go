@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"piaoji-server/internal/config"
+	"strings"
+	"time"
+)
+
+// fileMailer 把每封邮件写成一个 .eml 文件，用于本地开发和联调
+type fileMailer struct {
+	dir  string
+	from *mail.Address
+}
+
+func newFile(cfg *config.FileMailConfig, from *mail.Address) (*fileMailer, error) {
+	dir := cfg.GetDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建邮件目录失败: %w", err)
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Name() string {
+	return "file"
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	// 文件名：时间-收件人.eml，收件人中的路径字符替换掉
+	to := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), to)
+	return os.WriteFile(filepath.Join(m.dir, name), compose(m.from, msg), 0o644)
+}
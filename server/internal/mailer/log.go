@@ -0,0 +1,21 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"net/mail"
+)
+
+// logMailer 只把邮件内容写入日志，用于本地开发
+type logMailer struct {
+	from *mail.Address
+}
+
+func (m *logMailer) Name() string {
+	return "log"
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("[Mail] 发送邮件: to=%s, subject=%s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
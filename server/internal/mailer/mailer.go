@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/mail"
+	"piaoji-server/internal/config"
+	"time"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送
+type Mailer interface {
+	// Name 驱动名称
+	Name() string
+	// Send 发送邮件
+	Send(ctx context.Context, msg Message) error
+}
+
+var current Mailer
+
+// Init 按配置创建邮件驱动
+func Init(cfg *config.MailConfig) error {
+	from, err := mail.ParseAddress(cfg.GetFrom())
+	if err != nil {
+		return fmt.Errorf("发件人地址无效: %w", err)
+	}
+	switch cfg.GetDriver() {
+	case "log":
+		current = &logMailer{from: from}
+	case "file":
+		current, err = newFile(&cfg.File, from)
+	case "smtp":
+		current, err = newSMTP(&cfg.SMTP, from)
+	default:
+		err = fmt.Errorf("未知的邮件驱动: %s", cfg.Driver)
+	}
+	return err
+}
+
+// Current 当前使用的邮件驱动
+func Current() Mailer {
+	return current
+}
+
+// compose 生成 RFC 5322 格式的邮件内容，标题和正文按 UTF-8 编码
+func compose(from *mail.Address, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,103 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"piaoji-server/internal/config"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout 连接和发送一封邮件的总超时
+const smtpTimeout = 30 * time.Second
+
+// smtpMailer 通过 SMTP 服务器发信
+type smtpMailer struct {
+	cfg  *config.SMTPMailConfig
+	addr string
+	from *mail.Address
+}
+
+func newSMTP(cfg *config.SMTPMailConfig, from *mail.Address) (*smtpMailer, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("未配置 SMTP 服务器地址")
+	}
+	return &smtpMailer{
+		cfg:  cfg,
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.GetPort())),
+		from: from,
+	}, nil
+}
+
+func (m *smtpMailer) Name() string {
+	return "smtp"
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("收件人地址无效: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	defer c.Close()
+
+	if !m.cfg.TLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+				return fmt.Errorf("STARTTLS 失败: %w", err)
+			}
+		}
+	}
+	if m.cfg.Username != "" {
+		// PlainAuth 只允许在 TLS 连接或 localhost 上发送密码
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+	if err := c.Mail(m.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(compose(m.from, msg)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (m *smtpMailer) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	if m.cfg.TLS {
+		td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: m.cfg.Host}}
+		return td.DialContext(ctx, "tcp", m.addr)
+	}
+	return d.DialContext(ctx, "tcp", m.addr)
+}
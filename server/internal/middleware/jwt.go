@@ -8,6 +8,7 @@ import (
 	"piaoji-server/internal/database"
 	"piaoji-server/internal/model"
 	"piaoji-server/internal/response"
+	"piaoji-server/internal/session"
 	"strings"
 	"time"
 
@@ -17,21 +18,20 @@ import (
 
 // Claims JWT 声明
 type Claims struct {
-	UserID int64  `json:"userId"`
-	Openid string `json:"openid"`
+	UserID    int64  `json:"userId"`
+	Openid    string `json:"openid"`
+	SessionID int64  `json:"sid"` // 所属会话，会话退出后 token 立即失效
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成 JWT token
-func GenerateToken(userID int64, openid string) (string, error) {
-	expire, err := time.ParseDuration(config.Cfg.JWT.Expire)
-	if err != nil {
-		expire = 7 * 24 * time.Hour // 默认 7 天
-	}
+// GenerateToken 为会话生成短期的 access token
+func GenerateToken(userID int64, openid string, sessionID int64) (string, error) {
+	expire := config.Cfg.JWT.GetAccessExpire()
 
 	claims := Claims{
-		UserID: userID,
-		Openid: openid,
+		UserID:    userID,
+		Openid:    openid,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expire)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -72,6 +72,7 @@ func JWTAuth() gin.HandlerFunc {
 				// 将测试用户信息存入上下文
 				c.Set("userID", testUser.ID)
 				c.Set("openid", testUser.Openid)
+				c.Set("sessionID", int64(0))
 				fmt.Printf("[JWTAuth] Debug模式: 使用测试用户 ID=%d\n", testUser.ID)
 				c.Next()
 				return
@@ -109,9 +110,21 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
+		// 会话已退出（在其他设备上被踢下线、退出登录）或不存在时拒绝
+		if err := session.Check(database.DB, claims.SessionID, claims.UserID); err != nil {
+			if errors.Is(err, session.ErrInvalid) {
+				response.Unauthorized(c, err.Error())
+			} else {
+				response.ServerError(c, "校验登录状态失败")
+			}
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存入上下文
 		c.Set("userID", claims.UserID)
 		c.Set("openid", claims.Openid)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
 	}
 }
@@ -133,3 +146,12 @@ func GetOpenid(c *gin.Context) string {
 	}
 	return openid.(string)
 }
+
+// GetSessionID 从上下文获取当前会话 ID，debug 模式的测试用户为 0
+func GetSessionID(c *gin.Context) int64 {
+	sessionID, exists := c.Get("sessionID")
+	if !exists {
+		return 0
+	}
+	return sessionID.(int64)
+}
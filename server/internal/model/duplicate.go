@@ -0,0 +1,27 @@
+package model
+
+// 判断为疑似重复的依据
+const (
+	DuplicateReasonPhoto  = "photo"  // 照片相同或近似
+	DuplicateReasonFields = "fields" // 类型、日期、车次/航班号都相同
+)
+
+// DuplicateTicket 与新建票据照片近似的已有票据，随创建结果返回作为提醒
+type DuplicateTicket struct {
+	TicketID int64  `json:"ticketId"`
+	Name     string `json:"name"`
+	Distance int    `json:"distance"` // 最相近的两张照片的差异，0 表示文件相同
+}
+
+// DuplicatePair 疑似重复的一对票据，A 为较早创建的一张
+type DuplicatePair struct {
+	A        Ticket   `json:"a"`
+	B        Ticket   `json:"b"`
+	Reasons  []string `json:"reasons"`
+	Distance *int     `json:"distance,omitempty"` // 照片近似时最相近的两张照片的差异
+}
+
+// DuplicateListResponse 疑似重复票据列表
+type DuplicateListResponse struct {
+	Pairs []DuplicatePair `json:"pairs"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+// 邮箱验证码用途
+const (
+	EmailCodeBind  = "bind"  // 绑定邮箱
+	EmailCodeLogin = "login" // 邮箱验证码登录
+)
+
+// EmailCode 发出的邮箱验证码，只保存 HMAC
+// 同一邮箱和用途只有最新的一条有效
+type EmailCode struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement"`
+	Email     string     `gorm:"size:255;index:idx_email_codes_email;not null"`
+	Purpose   string     `gorm:"size:16;index:idx_email_codes_email;not null"`
+	UserID    int64      `gorm:"column:user_id;not null"` // 绑定时为发起绑定的用户，登录时为邮箱所属用户
+	CodeHash  string     `gorm:"column:code_hash;size:64;not null"`
+	IP        string     `gorm:"size:64;index"`
+	Attempts  int        `gorm:"default:0"` // 校验失败次数
+	ExpiresAt time.Time  `gorm:"column:expires_at;index"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+}
+
+func (EmailCode) TableName() string {
+	return "email_codes"
+}
@@ -0,0 +1,68 @@
+package model
+
+// ExportVersion 导出格式版本，导入时据此兼容旧格式
+const ExportVersion = 1
+
+// CSVTagSeparator CSV 中多个标签的分隔符
+const CSVTagSeparator = "|"
+
+// CSVColumns CSV 导出/导入的列，location 展开为多列
+var CSVColumns = []string{
+	"ticketClientId", "name", "type", "tripNumber", "seat", "hall", "version", "showtime",
+	"tags", "price", "photo", "date",
+	"locationType", "city", "address", "latitude", "longitude",
+	"departureCity", "departureStation", "arrivalCity", "arrivalStation",
+	"note", "privacy", "createdAt",
+}
+
+// ExportTag 导出的自定义标签定义
+type ExportTag struct {
+	Name   string  `json:"name"`
+	Color  string  `json:"color"`
+	Icon   *string `json:"icon,omitempty"`
+	Parent string  `json:"parent,omitempty"` // 父标签名称
+	Group  string  `json:"group,omitempty"`
+}
+
+// ExportTicket 导出的票据，字段与创建票据请求一致，可直接用于导入
+type ExportTicket struct {
+	CreateTicketRequest
+	PhotoFile string `json:"photoFile,omitempty"` // zip 导出中照片的相对路径
+	CreatedAt string `json:"createdAt"`
+}
+
+// ExportFile JSON 导出文件结构，同时作为导入格式
+type ExportFile struct {
+	Version    int            `json:"version"`
+	ExportedAt string         `json:"exportedAt"`
+	Tags       []ExportTag    `json:"tags"`
+	Tickets    []ExportTicket `json:"tickets"`
+}
+
+// ImportStatus 导入行处理结果
+type ImportStatus string
+
+const (
+	ImportCreate ImportStatus = "create" // 新建（dryRun 时表示将会新建）
+	ImportSkip   ImportStatus = "skip"   // 已存在，跳过
+	ImportError  ImportStatus = "error"  // 校验失败
+)
+
+// ImportRowResult 单行导入结果
+type ImportRowResult struct {
+	Row            int          `json:"row"` // JSON 为票据序号，CSV 为数据行号（从 1 开始，不含表头）
+	TicketClientID string       `json:"ticketClientId"`
+	Name           string       `json:"name"`
+	Status         ImportStatus `json:"status"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// ImportResponse 导入响应
+type ImportResponse struct {
+	DryRun      bool              `json:"dryRun"`
+	Created     int               `json:"created"`
+	Skipped     int               `json:"skipped"`
+	Failed      int               `json:"failed"`
+	TagsCreated []string          `json:"tagsCreated"`
+	Rows        []ImportRowResult `json:"rows"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+// 登录身份类型
+const (
+	IdentityWechat = "wechat" // subject 为小程序 openid
+	IdentityPhone  = "phone"  // subject 为手机号的 HMAC（与 users.phone_hash 相同）
+	IdentityEmail  = "email"  // subject 为小写的邮箱地址
+)
+
+// Identity 用户的登录身份，一个用户每种类型最多一个
+type Identity struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID    int64     `gorm:"column:user_id;uniqueIndex:idx_identities_user_provider;not null" json:"-"`
+	Provider  string    `gorm:"size:16;uniqueIndex:idx_identities_user_provider;uniqueIndex:idx_identities_provider_subject;not null" json:"provider"`
+	Subject   string    `gorm:"size:255;uniqueIndex:idx_identities_provider_subject;not null" json:"-"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+	Display   string    `gorm:"-" json:"display"` // 展示用的身份标识：邮箱地址、脱敏手机号，微信为空
+}
+
+func (Identity) TableName() string {
+	return "identities"
+}
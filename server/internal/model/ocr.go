@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+)
+
+// OCRStatus 识别任务状态
+type OCRStatus string
+
+const (
+	OCRStatusPending OCRStatus = "pending"
+	OCRStatusRunning OCRStatus = "running"
+	OCRStatusDone    OCRStatus = "done"
+	OCRStatusFailed  OCRStatus = "failed"
+)
+
+// OCRJob 票据照片识别任务
+type OCRJob struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64     `gorm:"column:user_id;index;not null" json:"-"`
+	PhotoKey  string    `gorm:"column:photo_key;size:255;not null" json:"photoKey"`
+	Provider  string    `gorm:"size:32" json:"provider"`
+	Status    OCRStatus `gorm:"size:16;index;not null" json:"status"`
+	Result    JSON      `gorm:"type:json" json:"result,omitempty"` // OCRDraft
+	Error     string    `gorm:"size:255" json:"error,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updatedAt"`
+}
+
+func (OCRJob) TableName() string {
+	return "ocr_jobs"
+}
+
+// OCRDraft 识别结果：票据草稿及各字段置信度（0~1）
+type OCRDraft struct {
+	Ticket     CreateTicketRequest `json:"ticket"`
+	Confidence map[string]float64  `json:"confidence"`
+	Text       string              `json:"text"` // 识别出的原始文本
+}
+
+// OCRRequest 发起识别请求
+type OCRRequest struct {
+	Key string `json:"key" binding:"required"` // 已上传照片的对象 key
+}
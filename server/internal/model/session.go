@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// Session 登录会话，每次登录（每台设备）一条
+// refresh token 只保存 SHA-256，每次刷新都会更换
+type Session struct {
+	ID              int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID          int64      `gorm:"column:user_id;index;not null" json:"-"`
+	RefreshHash     string     `gorm:"column:refresh_hash;size:64;uniqueIndex;not null" json:"-"`
+	PrevRefreshHash string     `gorm:"column:prev_refresh_hash;size:64;index" json:"-"` // 上一个 refresh token，再次出现说明可能被盗用
+	RotatedAt       *time.Time `gorm:"column:rotated_at" json:"-"`
+	DeviceName      string     `gorm:"column:device_name;size:64" json:"deviceName"`
+	UserAgent       string     `gorm:"column:user_agent;size:255" json:"userAgent"`
+	IP              string     `gorm:"size:64" json:"ip"`
+	LastSeenAt      time.Time  `gorm:"column:last_seen_at" json:"lastSeenAt"`
+	ExpiresAt       time.Time  `gorm:"column:expires_at;index" json:"expiresAt"` // refresh token 过期时间，每次刷新顺延
+	RevokedAt       *time.Time `gorm:"column:revoked_at" json:"-"`
+	CreatedAt       time.Time  `gorm:"column:created_at" json:"createdAt"`
+	Current         bool       `gorm:"-" json:"current"` // 是否为发起请求的会话
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
@@ -15,9 +15,11 @@ const (
 // Tag 标签模型
 type Tag struct {
 	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name       string    `gorm:"size:32;not null" json:"name"`
+	Name       string    `gorm:"size:32;not null" json:"name"` // 同一用户的自定义标签名不区分大小写唯一，索引见 tagging.EnsureUniqueNames
 	Type       TagType   `gorm:"size:10;default:custom" json:"type"`
 	UserID     *int64    `gorm:"column:user_id;index" json:"userId,omitempty"`
+	ParentID   *int64    `gorm:"column:parent_id;index" json:"parentId,omitempty"` // 父标签，只能是自己的自定义标签
+	Group      string    `gorm:"column:tag_group;size:32" json:"group,omitempty"`  // 用户自定义的分组
 	Color      string    `gorm:"size:16;default:#07c160" json:"color"`
 	Icon       *string   `gorm:"size:32" json:"icon,omitempty"`
 	Sort       int       `gorm:"default:0" json:"sort"`
@@ -25,17 +27,24 @@ type Tag struct {
 	IsActive   bool      `gorm:"column:is_active;default:true" json:"isActive"`
 	CreatedAt  time.Time `gorm:"column:created_at" json:"createdAt"`
 	UpdatedAt  time.Time `gorm:"column:updated_at" json:"updatedAt"`
+
+	Children []Tag `gorm:"-" json:"children,omitempty"` // 标签树中的子标签
 }
 
+// MaxTagDepth 标签树的最大层数
+const MaxTagDepth = 5
+
 func (Tag) TableName() string {
 	return "tags"
 }
 
 // CreateTagRequest 创建标签请求
 type CreateTagRequest struct {
-	Name  string  `json:"name" binding:"required,max=32"`
-	Color *string `json:"color"`
-	Icon  *string `json:"icon"`
+	Name     string  `json:"name" binding:"required,max=32"`
+	Color    *string `json:"color"`
+	Icon     *string `json:"icon"`
+	ParentID *int64  `json:"parentId"`
+	Group    *string `json:"group" binding:"omitempty,max=32"`
 }
 
 // UpdateTagRequest 更新标签请求
@@ -44,6 +53,63 @@ type UpdateTagRequest struct {
 	Color    *string `json:"color"`
 	Icon     *string `json:"icon"`
 	IsActive *bool   `json:"isActive"`
+	ParentID *int64  `json:"parentId"` // 传 0 表示移到顶层
+	Group    *string `json:"group" binding:"omitempty,max=32"`
+	Merge    bool    `json:"merge"` // 新名称与已有标签重名时，合并到该标签而不是报错
+}
+
+// TagUpdateResponse 更新标签响应
+// 合并时返回合并后的目标标签；TicketsAffected 为带有该标签、随之变化的票据数
+type TagUpdateResponse struct {
+	Tag
+	TicketsAffected int64 `json:"ticketsAffected"`
+}
+
+// MergeTagRequest 合并标签请求，sourceIds 中的自定义标签合并到路径中的目标标签
+type MergeTagRequest struct {
+	SourceIDs []int64 `json:"sourceIds" binding:"required,min=1,max=50"`
+}
+
+// MergeTagResponse 合并标签响应
+type MergeTagResponse struct {
+	Tag             Tag   `json:"tag"`
+	Merged          int   `json:"merged"`          // 被合并（删除）的标签数
+	TicketsAffected int64 `json:"ticketsAffected"` // 改写的票据数
+}
+
+// TagTreeRequest 标签列表请求
+type TagTreeRequest struct {
+	Flat bool `form:"flat"` // 返回扁平数组（兼容旧客户端）
+}
+
+// TagListRequest 自定义标签分页请求
+type TagListRequest struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
+	Sort   string `form:"sort"`  // usage_count（默认）/ name / created_at
+	Order  string `form:"order"` // desc（默认）/ asc
+}
+
+// TagListResponse 自定义标签分页响应
+type TagListResponse struct {
+	List    []Tag  `json:"list"`
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"hasMore"`
+	Total   int64  `json:"total"`
+}
+
+// TagSuggestRequest 标签推荐请求
+type TagSuggestRequest struct {
+	Prefix     string     `form:"prefix"`     // 已输入的前缀，为空时按推荐度返回
+	TicketType TicketType `form:"ticketType"` // 正在录入的票据类型
+	City       string     `form:"city"`       // 正在录入的城市
+	Limit      int        `form:"limit"`
+}
+
+// TagSuggestion 推荐的标签及推荐度
+type TagSuggestion struct {
+	Tag
+	Score float64 `json:"score"`
 }
 
 // 全局预设标签
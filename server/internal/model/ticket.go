@@ -6,6 +6,9 @@ import (
 	"time"
 )
 
+// MaxTagsPerTicket 每张票据最多的标签数
+const MaxTagsPerTicket = 5
+
 // TicketType 票据类型
 type TicketType string
 
@@ -19,6 +22,16 @@ const (
 	TicketTypeOther      TicketType = "other"
 )
 
+// IsValid 是否为支持的票据类型
+func (t TicketType) IsValid() bool {
+	switch t {
+	case TicketTypeMovie, TicketTypeShow, TicketTypeExhibition, TicketTypeTrain,
+		TicketTypeFlight, TicketTypeScenic, TicketTypeOther:
+		return true
+	}
+	return false
+}
+
 // PrivacyLevel 隐私级别
 type PrivacyLevel string
 
@@ -28,6 +41,11 @@ const (
 	PrivacyMasked  PrivacyLevel = "masked"
 )
 
+// IsValid 是否为支持的隐私级别
+func (p PrivacyLevel) IsValid() bool {
+	return p == PrivacyPublic || p == PrivacyPrivate || p == PrivacyMasked
+}
+
 // JSON 类型，用于存储 JSON 字段
 type JSON json.RawMessage
 
@@ -72,35 +90,51 @@ func (j *JSON) UnmarshalJSON(data []byte) error {
 
 // Ticket 票据模型
 type Ticket struct {
-	ID             int64        `gorm:"primaryKey;autoIncrement" json:"id"`
-	TicketClientID string       `gorm:"column:ticket_client_id;uniqueIndex;size:64;not null" json:"ticketClientId"`
-	UserID         int64        `gorm:"column:user_id;index;not null" json:"userId"`
-	Name           string       `gorm:"size:128;not null" json:"name"`
-	Type           TicketType   `gorm:"size:20;not null" json:"type"`
-	TripNumber     *string      `gorm:"column:trip_number;size:32" json:"tripNumber,omitempty"` // 航班号/车次号
-	Seat           *string      `gorm:"size:64" json:"seat,omitempty"`                          // 座位信息（电影票/演出票）
-	Hall           *string      `gorm:"size:64" json:"hall,omitempty"`                          // 影厅信息（电影票）
-	Version        *string      `gorm:"size:32" json:"version,omitempty"`                       // 电影版本（IMAX/3D/原版等）
-	Showtime       *string      `gorm:"size:32" json:"showtime,omitempty"`                      // 场次时间（电影票）
-	Tags           JSON         `gorm:"type:json" json:"tags"`
-	Price          *float64     `gorm:"type:decimal(10,2)" json:"price,omitempty"`
-	Photo          *string      `gorm:"size:512" json:"photo,omitempty"`
-	Thumbnail      *string      `gorm:"size:512" json:"thumbnail,omitempty"`
-	Date           *time.Time   `json:"date,omitempty"`
-	SortTime       time.Time    `gorm:"column:sort_time;index" json:"sortTime"`
-	Location       JSON         `gorm:"type:json" json:"location,omitempty"`
-	Note           *string      `gorm:"type:text" json:"note,omitempty"`
-	Privacy        PrivacyLevel `gorm:"size:10;default:public" json:"privacy"`
-	IsDeleted      bool         `gorm:"column:is_deleted;default:false" json:"isDeleted"`
-	DeletedAt      *time.Time   `gorm:"column:deleted_at" json:"deletedAt,omitempty"`
-	CreatedAt      time.Time    `gorm:"column:created_at" json:"createdAt"`
-	UpdatedAt      time.Time    `gorm:"column:updated_at" json:"updatedAt"`
+	ID             int64             `gorm:"primaryKey;autoIncrement" json:"id"`
+	TicketClientID string            `gorm:"column:ticket_client_id;uniqueIndex;size:64;not null" json:"ticketClientId"`
+	UserID         int64             `gorm:"column:user_id;index;not null" json:"userId"`
+	Name           string            `gorm:"size:128;not null" json:"name"`
+	Type           TicketType        `gorm:"size:20;not null" json:"type"`
+	TripNumber     *string           `gorm:"column:trip_number;size:32" json:"tripNumber,omitempty"` // 航班号/车次号
+	Seat           *string           `gorm:"size:64" json:"seat,omitempty"`                          // 座位信息（电影票/演出票）
+	Hall           *string           `gorm:"size:64" json:"hall,omitempty"`                          // 影厅信息（电影票）
+	Version        *string           `gorm:"size:32" json:"version,omitempty"`                       // 电影版本（IMAX/3D/原版等）
+	Showtime       *string           `gorm:"size:32" json:"showtime,omitempty"`                      // 场次时间（电影票）
+	Tags           []string          `gorm:"-" json:"tags"`                                          // 标签名称，来自 ticket_tags 关联（仅包含启用的标签）
+	Price          *float64          `gorm:"type:decimal(10,2)" json:"price,omitempty"`
+	Photo          *string           `gorm:"size:512" json:"photo,omitempty"`     // 封面，即第一张照片
+	Thumbnail      *string           `gorm:"size:512" json:"thumbnail,omitempty"` // 封面缩略图
+	Photos         []TicketPhoto     `gorm:"-" json:"photos"`                     // 全部照片，来自 ticket_photos
+	Date           *time.Time        `json:"date,omitempty"`
+	SortTime       time.Time         `gorm:"column:sort_time;index" json:"sortTime"`
+	Location       JSON              `gorm:"type:json" json:"location,omitempty"`
+	Note           *string           `gorm:"type:text" json:"note,omitempty"`
+	Privacy        PrivacyLevel      `gorm:"size:10;default:public" json:"privacy"`
+	IsDeleted      bool              `gorm:"column:is_deleted;default:false" json:"isDeleted"`
+	DeletedAt      *time.Time        `gorm:"column:deleted_at" json:"deletedAt,omitempty"`
+	DaysRemaining  *int              `gorm:"-" json:"daysRemaining,omitempty"` // 回收站中距离自动永久删除的剩余天数
+	Duplicates     []DuplicateTicket `gorm:"-" json:"duplicates,omitempty"`    // 创建时发现的照片近似的已有票据
+	CreatedAt      time.Time         `gorm:"column:created_at" json:"createdAt"`
+	UpdatedAt      time.Time         `gorm:"column:updated_at" json:"updatedAt"`
 }
 
 func (Ticket) TableName() string {
 	return "tickets"
 }
 
+// FillDaysRemaining 根据保留时长计算回收站剩余天数（不足一天按一天计）
+func (t *Ticket) FillDaysRemaining(retention time.Duration, now time.Time) {
+	if !t.IsDeleted || t.DeletedAt == nil {
+		return
+	}
+	left := t.DeletedAt.Add(retention).Sub(now)
+	days := 0
+	if left > 0 {
+		days = int((left + 24*time.Hour - 1) / (24 * time.Hour))
+	}
+	t.DaysRemaining = &days
+}
+
 // Location 地点结构
 type Location struct {
 	Type       string      `json:"type"` // single 或 route
@@ -119,53 +153,76 @@ type Coordinate struct {
 type RoutePoint struct {
 	City       string      `json:"city"`
 	Station    string      `json:"station,omitempty"`
+	Code       string      `json:"code,omitempty"` // 车站电报码/机场三字码
+	Time       string      `json:"time,omitempty"` // 出发/到达时间 HH:MM
 	Coordinate *Coordinate `json:"coordinate,omitempty"`
 }
 
 // CreateTicketRequest 创建票据请求
 type CreateTicketRequest struct {
-	TicketClientID string       `json:"ticketClientId" binding:"required"`
-	Name           string       `json:"name" binding:"required,max=128"`
-	Type           TicketType   `json:"type" binding:"required"`
-	TripNumber     *string      `json:"tripNumber"` // 航班号/车次号
-	Seat           *string      `json:"seat"`       // 座位信息
-	Hall           *string      `json:"hall"`       // 影厅信息
-	Version        *string      `json:"version"`    // 电影版本
-	Showtime       *string      `json:"showtime"`   // 场次时间
-	Tags           []string     `json:"tags"`
-	Price          *float64     `json:"price"`
-	Photo          *string      `json:"photo"`
-	Date           *string      `json:"date"`
-	Location       *Location    `json:"location"`
-	Note           *string      `json:"note"`
-	Privacy        PrivacyLevel `json:"privacy"`
+	TicketClientID string             `json:"ticketClientId" binding:"required"`
+	Name           string             `json:"name" binding:"required,max=128"`
+	Type           TicketType         `json:"type" binding:"required"`
+	TripNumber     *string            `json:"tripNumber"` // 航班号/车次号
+	Seat           *string            `json:"seat"`       // 座位信息
+	Hall           *string            `json:"hall"`       // 影厅信息
+	Version        *string            `json:"version"`    // 电影版本
+	Showtime       *string            `json:"showtime"`   // 场次时间
+	Tags           []string           `json:"tags"`
+	Price          *float64           `json:"price"`
+	Photo          *string            `json:"photo"`  // 兼容旧客户端，未传 photos 时作为唯一的照片
+	Photos         []TicketPhotoInput `json:"photos"` // 全部照片，第一张为封面
+	Date           *string            `json:"date"`
+	Location       *Location          `json:"location"`
+	Note           *string            `json:"note"`
+	Privacy        PrivacyLevel       `json:"privacy"`
 }
 
 // UpdateTicketRequest 更新票据请求
 type UpdateTicketRequest struct {
-	Name       *string      `json:"name"`
-	Type       *TicketType  `json:"type"`
-	TripNumber *string      `json:"tripNumber"` // 航班号/车次号
-	Seat       *string      `json:"seat"`       // 座位信息
-	Hall       *string      `json:"hall"`       // 影厅信息
-	Version    *string      `json:"version"`    // 电影版本
-	Showtime   *string      `json:"showtime"`   // 场次时间
-	Tags       []string     `json:"tags"`
-	Price      *float64     `json:"price"`
-	Photo      *string      `json:"photo"`
-	Date       *string      `json:"date"`
-	Location   *Location    `json:"location"`
-	Note       *string      `json:"note"`
-	Privacy    PrivacyLevel `json:"privacy"`
+	Name       *string            `json:"name"`
+	Type       *TicketType        `json:"type"`
+	TripNumber *string            `json:"tripNumber"` // 航班号/车次号
+	Seat       *string            `json:"seat"`       // 座位信息
+	Hall       *string            `json:"hall"`       // 影厅信息
+	Version    *string            `json:"version"`    // 电影版本
+	Showtime   *string            `json:"showtime"`   // 场次时间
+	Tags       []string           `json:"tags"`
+	Price      *float64           `json:"price"`
+	Photo      *string            `json:"photo"`  // 兼容旧客户端：替换封面，传空串移除封面
+	Photos     []TicketPhotoInput `json:"photos"` // 传入时替换全部照片，空数组表示移除所有照片
+	Date       *string            `json:"date"`
+	Location   *Location          `json:"location"`
+	Note       *string            `json:"note"`
+	Privacy    PrivacyLevel       `json:"privacy"`
 }
 
+// TagMatchMode 多标签组合方式
+type TagMatchMode string
+
+const (
+	TagMatchAll TagMatchMode = "and" // 同时包含所有标签
+	TagMatchAny TagMatchMode = "or"  // 包含任意一个标签
+)
+
 // TicketListRequest 票据列表请求
 type TicketListRequest struct {
-	Cursor    string     `form:"cursor"`
-	Limit     int        `form:"limit,default=20"`
-	Type      TicketType `form:"type"`
-	Tag       string     `form:"tag"`
-	IsDeleted bool       `form:"isDeleted"`
+	Cursor    string       `form:"cursor"`
+	Limit     int          `form:"limit,default=20"`
+	Sort      string       `form:"sort"`  // sort_time（默认）/ created_at / price / name，回收站额外支持 deleted_at
+	Order     string       `form:"order"` // desc（默认）/ asc
+	Type      TicketType   `form:"type"`
+	Tag       string       `form:"tag"`
+	Tags      []string     `form:"tags"`    // 多个标签，可重复传参或逗号分隔
+	TagMode   TagMatchMode `form:"tagMode"` // and（默认）/ or
+	From      string       `form:"from"`    // sort_time 起始，YYYY-MM-DD 或 RFC3339
+	To        string       `form:"to"`      // sort_time 截止，YYYY-MM-DD 时包含当天
+	City      string       `form:"city"`    // 匹配单地点城市及行程出发/到达城市
+	MinPrice  *float64     `form:"minPrice"`
+	MaxPrice  *float64     `form:"maxPrice"`
+	Privacy   PrivacyLevel `form:"privacy"`
+	HasPhoto  *bool        `form:"hasPhoto"`
+	IsDeleted bool         `form:"isDeleted"`
 }
 
 // TicketListResponse 票据列表响应
@@ -175,3 +232,68 @@ type TicketListResponse struct {
 	HasMore bool     `json:"hasMore"`
 	Total   int64    `json:"total"`
 }
+
+// BatchAction 批量操作类型
+type BatchAction string
+
+const (
+	BatchDelete          BatchAction = "delete"           // 移入回收站
+	BatchRestore         BatchAction = "restore"          // 从回收站恢复
+	BatchPermanentDelete BatchAction = "permanent_delete" // 永久删除（仅回收站中的票据）
+	BatchSetPrivacy      BatchAction = "set_privacy"      // 修改隐私级别
+	BatchAddTags         BatchAction = "add_tags"         // 添加标签
+	BatchRemoveTags      BatchAction = "remove_tags"      // 移除标签
+	BatchSetType         BatchAction = "set_type"         // 修改类型
+)
+
+// BatchTicketRequest 批量操作请求
+type BatchTicketRequest struct {
+	Action  BatchAction  `json:"action" binding:"required"`
+	IDs     []int64      `json:"ids" binding:"required,min=1,max=200"`
+	Privacy PrivacyLevel `json:"privacy"` // set_privacy 时必填
+	Tags    []string     `json:"tags"`    // add_tags / remove_tags 时必填
+	Type    TicketType   `json:"type"`    // set_type 时必填
+}
+
+// BatchTicketResult 单个票据的批量操作结果
+type BatchTicketResult struct {
+	ID      int64  `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchTicketResponse 批量操作响应
+type BatchTicketResponse struct {
+	Results   []BatchTicketResult `json:"results"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+}
+
+// TicketSearchRequest 票据搜索请求
+type TicketSearchRequest struct {
+	Q      string `form:"q" binding:"required,max=64"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit,default=20"`
+}
+
+// SearchHighlight 搜索命中片段
+type SearchHighlight struct {
+	Field    string `json:"field"`
+	Fragment string `json:"fragment"` // 命中部分以 <em></em> 包裹
+}
+
+// TicketSearchResult 单条搜索结果
+type TicketSearchResult struct {
+	Ticket
+	Score      int               `json:"score"`
+	Highlights []SearchHighlight `json:"highlights"`
+}
+
+// TicketSearchResponse 票据搜索响应（与 TicketListResponse 分页结构一致）
+type TicketSearchResponse struct {
+	List      []TicketSearchResult `json:"list"`
+	Cursor    string               `json:"cursor"`
+	HasMore   bool                 `json:"hasMore"`
+	Total     int64                `json:"total"`
+	Truncated bool                 `json:"truncated"` // 命中的票据超过排序上限，只在最近的部分中排序，结果不完整
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// MaxPhotosPerTicket 每张票据最多的照片数
+const MaxPhotosPerTicket = 9
+
+// TicketPhoto 票据照片
+// 排在第一张的照片同时写入 tickets.photo/thumbnail 作为封面；删除票据时由外键级联删除
+type TicketPhoto struct {
+	ID        int64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	TicketID  int64         `gorm:"column:ticket_id;index;not null" json:"-"`
+	UserID    int64         `gorm:"column:user_id;index;not null" json:"-"`
+	URL       string        `gorm:"column:url;size:512;not null" json:"url"`
+	Thumbnail string        `gorm:"size:512" json:"thumbnail"`
+	Caption   *string       `gorm:"size:255" json:"caption,omitempty"`
+	Sort      int           `gorm:"default:0" json:"sort"`
+	Width     int           `gorm:"default:0" json:"width,omitempty"`
+	Height    int           `gorm:"default:0" json:"height,omitempty"`
+	Bytes     int64         `gorm:"default:0" json:"bytes,omitempty"`
+	Variants  PhotoVariants `gorm:"type:json" json:"variants,omitempty"`  // 服务端生成的缩略图和 WebP 版本
+	SHA256    *string       `gorm:"column:sha256;size:64;index" json:"-"` // 内容哈希，空字符串表示无法计算
+	DHash     *uint64       `gorm:"column:dhash" json:"-"`
+	PHash     *uint64       `gorm:"column:phash" json:"-"`
+	IsDeleted bool          `gorm:"column:is_deleted;default:false" json:"-"` // 与所属票据同步移入/移出回收站
+	CreatedAt time.Time     `gorm:"column:created_at" json:"createdAt"`
+	UpdatedAt time.Time     `gorm:"column:updated_at" json:"updatedAt"`
+
+	Ticket *Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (TicketPhoto) TableName() string {
+	return "ticket_photos"
+}
+
+// TicketPhotoInput 创建/更新票据时提交的照片，按数组顺序排列，第一张为封面
+type TicketPhotoInput struct {
+	URL     string  `json:"url"`
+	Caption *string `json:"caption"`
+	Width   int     `json:"width"`
+	Height  int     `json:"height"`
+	Bytes   int64   `json:"bytes"`
+	File    string  `json:"file,omitempty"` // zip 导出中照片的相对路径
+}
+
+// PhotoVariant 服务端图片处理生成的照片版本
+type PhotoVariant struct {
+	Size   int    `json:"size"`           // 长边像素，裁剪缩略图为边长
+	Crop   bool   `json:"crop,omitempty"` // 是否居中裁剪为正方形
+	Format string `json:"format"`         // jpeg / webp
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// PhotoVariants 照片版本列表，以 JSON 存储
+type PhotoVariants []PhotoVariant
+
+func (v PhotoVariants) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func (v *PhotoVariants) Scan(value interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Thumbnail 裁剪缩略图中 JPEG 版本的地址，没有时返回空
+func (v PhotoVariants) Thumbnail() string {
+	for _, variant := range v {
+		if variant.Crop && variant.Format == "jpeg" {
+			return variant.URL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// TicketShareOpen 票据分享卡片在微信群中被打开的记录
+// 同一用户在同一个群打开同一张票据只记录一次
+type TicketShareOpen struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TicketID  int64     `gorm:"column:ticket_id;uniqueIndex:idx_ticket_share_open;not null" json:"ticketId"`
+	UserID    int64     `gorm:"column:user_id;uniqueIndex:idx_ticket_share_open;not null" json:"userId"` // 打开分享卡片的用户
+	OpenGID   string    `gorm:"column:open_gid;uniqueIndex:idx_ticket_share_open;size:64;not null" json:"openGId"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+
+	Ticket *Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (TicketShareOpen) TableName() string {
+	return "ticket_share_opens"
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+)
+
+// TicketTag 票据与标签的关联
+// 删除票据或标签时由外键级联删除关联
+type TicketTag struct {
+	TicketID  int64     `gorm:"column:ticket_id;primaryKey;autoIncrement:false"`
+	TagID     int64     `gorm:"column:tag_id;primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+
+	Ticket *Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	Tag    *Tag    `gorm:"foreignKey:TagID;constraint:OnDelete:CASCADE"`
+}
+
+func (TicketTag) TableName() string {
+	return "ticket_tags"
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// UploadKeyPrefix 用户上传照片的 key 前缀，上传的对象 key 为 tickets/<userID>/...
+func UploadKeyPrefix(userID int64) string {
+	return fmt.Sprintf("tickets/%d/", userID)
+}
+
+// ImageStatus 上传照片的服务端处理状态
+type ImageStatus string
+
+const (
+	ImageStatusNone    ImageStatus = ""        // 未启用图片处理时上传
+	ImageStatusPending ImageStatus = "pending" // 等待处理
+	ImageStatusDone    ImageStatus = "done"
+	ImageStatusFailed  ImageStatus = "failed" // 原图不存在
+	// ImageStatusRejected 格式无法处理（如 HEIC）或多次处理失败，无法去除元数据，原图已删除
+	ImageStatusRejected ImageStatus = "rejected"
+)
+
+// Upload 已确认完成的上传
+// 由七牛云上传回调、本地存储上传接口写入；不支持回调的存储在票据首次引用时查询对象后补记
+type Upload struct {
+	ID            int64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        int64         `gorm:"column:user_id;index;not null" json:"-"`
+	Key           string        `gorm:"column:object_key;size:255;uniqueIndex;not null" json:"key"`
+	StrippedKey   string        `gorm:"column:stripped_key;size:255;index" json:"-"` // 去除元数据后的照片，原图随后删除；原图没有元数据时为空
+	Hash          string        `gorm:"size:64" json:"hash"`
+	Fsize         int64         `gorm:"default:0" json:"fsize"`
+	Mime          string        `gorm:"size:64" json:"mime"`
+	ImageStatus   ImageStatus   `gorm:"column:image_status;size:16;index" json:"imageStatus,omitempty"`
+	ImageError    string        `gorm:"column:image_error;size:255" json:"-"`
+	ImageAttempts int           `gorm:"column:image_attempts;default:0" json:"-"` // 已处理失败的次数
+	Width         int           `gorm:"default:0" json:"width,omitempty"`         // 按 EXIF 方向校正后的尺寸
+	Height        int           `gorm:"default:0" json:"height,omitempty"`        // 按 EXIF 方向校正后的尺寸
+	Variants      PhotoVariants `gorm:"type:json" json:"variants,omitempty"`
+	TakenAt       *time.Time    `gorm:"column:taken_at" json:"takenAt,omitempty"` // EXIF 拍摄时间（开启 extract_metadata 时记录）
+	Latitude      *float64      `json:"latitude,omitempty"`                       // EXIF GPS（开启 extract_metadata 时记录）
+	Longitude     *float64      `json:"longitude,omitempty"`
+	SHA256        *string       `gorm:"column:sha256;size:64" json:"-"` // 原始文件哈希，用于发现重复照片
+	DHash         *uint64       `gorm:"column:dhash" json:"-"`
+	PHash         *uint64       `gorm:"column:phash" json:"-"`
+	CreatedAt     time.Time     `gorm:"column:created_at" json:"createdAt"`
+	UpdatedAt     time.Time     `gorm:"column:updated_at" json:"-"`
+}
+
+func (Upload) TableName() string {
+	return "uploads"
+}
@@ -6,16 +6,21 @@ import (
 
 // User 用户模型
 type User struct {
-	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	Openid      string    `gorm:"uniqueIndex;size:64;not null" json:"-"`
-	NickName    *string   `gorm:"column:nick_name;size:64" json:"nickName"`
-	AvatarUrl   *string   `gorm:"column:avatar_url;size:512" json:"avatarUrl"`
-	Phone       *string   `gorm:"uniqueIndex;size:20" json:"phone"`
-	TicketCount int       `gorm:"column:ticket_count;default:0" json:"ticketCount"`
-	PhotoCount  int       `gorm:"column:photo_count;default:0" json:"photoCount"`
-	PhotoQuota  int       `gorm:"column:photo_quota;default:100" json:"photoQuota"`
-	CreatedAt   time.Time `gorm:"column:created_at" json:"createdAt"`
-	UpdatedAt   time.Time `gorm:"column:updated_at" json:"updatedAt"`
+	ID               int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Openid           string    `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	Unionid          *string   `gorm:"column:unionid;index;size:64" json:"-"`       // 小程序绑定开放平台后才有
+	SessionKeyCipher *string   `gorm:"column:session_key_cipher;size:255" json:"-"` // 加密保存的最近一次登录的 session_key
+	NickName         *string   `gorm:"column:nick_name;size:64" json:"nickName"`
+	AvatarUrl        *string   `gorm:"column:avatar_url;size:512" json:"avatarUrl"`
+	Phone            *string   `gorm:"size:20" json:"phone"`                           // 脱敏后的手机号，仅用于展示
+	PhoneCipher      *string   `gorm:"column:phone_cipher;size:255" json:"-"`          // 加密保存的完整手机号
+	PhoneHash        *string   `gorm:"column:phone_hash;uniqueIndex;size:64" json:"-"` // 手机号的 HMAC，用于查重
+	TicketCount      int       `gorm:"column:ticket_count;default:0" json:"ticketCount"`
+	PhotoCount       int       `gorm:"column:photo_count;default:0" json:"photoCount"`
+	PhotoQuota       int       `gorm:"column:photo_quota;default:100" json:"photoQuota"`
+	CalendarToken    *string   `gorm:"column:calendar_token;uniqueIndex;size:64" json:"-"` // 日历订阅密钥，为空表示未开启
+	CreatedAt        time.Time `gorm:"column:created_at" json:"createdAt"`
+	UpdatedAt        time.Time `gorm:"column:updated_at" json:"updatedAt"`
 }
 
 func (User) TableName() string {
@@ -24,23 +29,26 @@ func (User) TableName() string {
 
 // UserResponse 用户响应 DTO
 type UserResponse struct {
-	ID          int64   `json:"id"`
-	NickName    string  `json:"nickName"`
-	AvatarUrl   string  `json:"avatarUrl"`
-	Phone       string  `json:"phone,omitempty"`
-	TicketCount int     `json:"ticketCount"`
-	PhotoCount  int     `json:"photoCount"`
-	PhotoQuota  int     `json:"photoQuota"`
-	CreatedAt   string  `json:"createdAt"`
+	ID              int64  `json:"id"`
+	NickName        string `json:"nickName"`
+	AvatarUrl       string `json:"avatarUrl"`
+	Phone           string `json:"phone,omitempty"`
+	Email           string `json:"email,omitempty"` // 已绑定的邮箱，由调用方按需填充
+	TicketCount     int    `json:"ticketCount"`
+	PhotoCount      int    `json:"photoCount"`
+	PhotoQuota      int    `json:"photoQuota"`
+	CalendarEnabled bool   `json:"calendarEnabled"`
+	CreatedAt       string `json:"createdAt"`
 }
 
 func (u *User) ToResponse() *UserResponse {
 	resp := &UserResponse{
-		ID:          u.ID,
-		TicketCount: u.TicketCount,
-		PhotoCount:  u.PhotoCount,
-		PhotoQuota:  u.PhotoQuota,
-		CreatedAt:   u.CreatedAt.Format(time.RFC3339),
+		ID:              u.ID,
+		TicketCount:     u.TicketCount,
+		PhotoCount:      u.PhotoCount,
+		PhotoQuota:      u.PhotoQuota,
+		CalendarEnabled: u.CalendarToken != nil,
+		CreatedAt:       u.CreatedAt.Format(time.RFC3339),
 	}
 	if u.NickName != nil {
 		resp.NickName = *u.NickName
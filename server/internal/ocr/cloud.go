@@ -0,0 +1,70 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"piaoji-server/internal/config"
+)
+
+// cloud 通用云端识别适配器
+// 以 POST 上传图片（image/jpeg），期望返回 {"lines":[{"text":"...","confidence":0.98}]}
+// 接入具体厂商时，可在其前面部署一层转换，或参照本实现注册新的 provider
+type cloud struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func init() {
+	Register("cloud", newCloud)
+}
+
+func newCloud(cfg *config.OCRConfig) (Recognizer, error) {
+	if cfg.Cloud.Endpoint == "" {
+		return nil, errors.New("未配置云端识别服务地址 ocr.cloud.endpoint")
+	}
+	return &cloud{
+		endpoint: cfg.Cloud.Endpoint,
+		apiKey:   cfg.Cloud.APIKey,
+		client:   &http.Client{},
+	}, nil
+}
+
+func (c *cloud) Name() string {
+	return "cloud"
+}
+
+func (c *cloud) Recognize(ctx context.Context, image []byte) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(image))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("云端识别失败: HTTP %d: %s", resp.StatusCode, body)
+	}
+
+	var out struct {
+		Lines []Line `json:"lines"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("解析云端识别结果失败: %w", err)
+	}
+	return &Result{Lines: out.Lines}, nil
+}
@@ -0,0 +1,78 @@
+package ocr
+
+import (
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/parser"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BuildDraft 将识别文本交给 parser 生成票据草稿，并估算各字段的置信度
+// 字段值能在某一行中找到时取该行置信度，否则（跨行拼出的字段，如日期）取全文平均值
+func BuildDraft(res *Result, now time.Time) model.OCRDraft {
+	text := res.Text()
+
+	var draft parser.Draft
+	if drafts := parser.Parse(text, now); len(drafts) > 0 {
+		draft = drafts[0]
+	} else {
+		draft = parser.Fallback(text, now)
+	}
+	t := draft.Ticket
+
+	avg := 0.0
+	for _, line := range res.Lines {
+		avg += line.Confidence
+	}
+	if len(res.Lines) > 0 {
+		avg /= float64(len(res.Lines))
+	}
+
+	conf := map[string]float64{}
+	field := func(name string, value *string) {
+		if value != nil && *value != "" {
+			conf[name] = lineConfidence(res.Lines, *value, avg)
+		}
+	}
+	name := t.Name
+	field("name", &name)
+	field("tripNumber", t.TripNumber)
+	field("seat", t.Seat)
+	field("hall", t.Hall)
+	field("version", t.Version)
+	field("showtime", t.Showtime)
+	if t.Date != nil {
+		conf["date"] = avg
+	}
+	if t.Price != nil {
+		price := strconv.FormatFloat(*t.Price, 'f', -1, 64)
+		field("price", &price)
+	}
+	if loc := t.Location; loc != nil {
+		field("location.address", &loc.Address)
+		if loc.Departure != nil {
+			field("location.departure", &loc.Departure.Station)
+		}
+		if loc.Arrival != nil {
+			field("location.arrival", &loc.Arrival.Station)
+		}
+	}
+
+	return model.OCRDraft{Ticket: t, Confidence: conf, Text: text}
+}
+
+// lineConfidence 包含 value 的行中最高的置信度，忽略空白差异
+func lineConfidence(lines []Line, value string, fallback float64) float64 {
+	needle := strings.Join(strings.Fields(value), "")
+	best, found := 0.0, false
+	for _, line := range lines {
+		if strings.Contains(strings.Join(strings.Fields(line.Text), ""), needle) && line.Confidence > best {
+			best, found = line.Confidence, true
+		}
+	}
+	if !found {
+		return fallback
+	}
+	return best
+}
@@ -0,0 +1,70 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"piaoji-server/internal/config"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrDisabled        = errors.New("OCR 识别未启用")
+	ErrUnknownProvider = errors.New("未知的 OCR 识别服务")
+)
+
+// Line 识别出的一行文本及其置信度（0~1）
+type Line struct {
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Result 识别结果
+type Result struct {
+	Lines []Line
+}
+
+// Text 按行拼接的全文
+func (r *Result) Text() string {
+	texts := make([]string, len(r.Lines))
+	for i, line := range r.Lines {
+		texts[i] = line.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Recognizer 文字识别服务
+type Recognizer interface {
+	// Name 识别服务名称，记录在任务中
+	Name() string
+	// Recognize 识别图片中的文字
+	Recognize(ctx context.Context, image []byte) (*Result, error)
+}
+
+// Factory 根据配置创建识别服务
+type Factory func(cfg *config.OCRConfig) (Recognizer, error)
+
+var factories = map[string]Factory{}
+
+// Register 注册识别服务，云端识别适配器通过此处接入
+func Register(name string, f Factory) {
+	factories[name] = f
+}
+
+// New 按配置中的 provider 创建识别服务
+func New(cfg *config.OCRConfig) (Recognizer, error) {
+	if !cfg.Enabled {
+		return nil, ErrDisabled
+	}
+	f, ok := factories[cfg.Provider]
+	if !ok {
+		names := make([]string, 0, len(factories))
+		for name := range factories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w: %q（可选：%s）", ErrUnknownProvider, cfg.Provider, strings.Join(names, ", "))
+	}
+	return f(cfg)
+}
@@ -0,0 +1,176 @@
+package ocr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/database"
+	"piaoji-server/internal/imaging"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/storage"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 100      // 排队中的任务上限
+	maxImageBytes = 10 << 20 // 参与识别的照片最大 10MB
+	maxErrorLen   = 255      // 与 ocr_jobs.error 列长度一致
+)
+
+// ErrQueueFull 排队任务过多
+var ErrQueueFull = errors.New("识别任务繁忙，请稍后再试")
+
+// queue 进程内异步识别队列，任务状态持久化在 ocr_jobs 表中供客户端轮询
+type queue struct {
+	recognizer Recognizer
+	timeout    time.Duration
+	jobs       chan int64
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+var q *queue
+
+// Start 按配置创建识别服务并启动 worker，未启用时返回 ErrDisabled
+func Start(cfg *config.OCRConfig) error {
+	recognizer, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	// 上次退出时未完成的任务无法继续，标记为失败以便客户端重新提交
+	database.DB.Model(&model.OCRJob{}).
+		Where("status IN ?", []model.OCRStatus{model.OCRStatusPending, model.OCRStatusRunning}).
+		Updates(map[string]interface{}{"status": model.OCRStatusFailed, "error": "服务重启，任务已中断"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q = &queue{
+		recognizer: recognizer,
+		timeout:    cfg.GetTimeout(),
+		jobs:       make(chan int64, queueSize),
+		cancel:     cancel,
+	}
+	for i := 0; i < cfg.GetWorkers(); i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-q.jobs:
+					q.run(ctx, id)
+				}
+			}
+		}()
+	}
+	log.Printf("[OCR] 识别服务已启动: provider=%s, workers=%d", recognizer.Name(), cfg.GetWorkers())
+	return nil
+}
+
+// Stop 停止 worker，等待进行中的任务结束
+func Stop() {
+	if q == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Enabled 识别服务是否可用
+func Enabled() bool {
+	return q != nil
+}
+
+// Submit 创建识别任务并放入队列
+func Submit(userID int64, key string) (*model.OCRJob, error) {
+	if q == nil {
+		return nil, ErrDisabled
+	}
+
+	job := model.OCRJob{
+		UserID:   userID,
+		PhotoKey: key,
+		Provider: q.recognizer.Name(),
+		Status:   model.OCRStatusPending,
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.jobs <- job.ID:
+		return &job, nil
+	default:
+		fail(job.ID, ErrQueueFull)
+		return nil, ErrQueueFull
+	}
+}
+
+// run 执行单个任务：下载照片 → 识别 → 生成草稿
+func (q *queue) run(ctx context.Context, id int64) {
+	var job model.OCRJob
+	if err := database.DB.First(&job, id).Error; err != nil {
+		log.Printf("[OCR] 任务不存在: id=%d, err=%v", id, err)
+		return
+	}
+	database.DB.Model(&job).Update("status", model.OCRStatusRunning)
+
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+
+	draft, err := q.recognize(ctx, job.PhotoKey)
+	if err != nil {
+		log.Printf("[OCR] 识别失败: id=%d, key=%s, err=%v", id, job.PhotoKey, err)
+		fail(id, err)
+		return
+	}
+
+	result, _ := json.Marshal(draft)
+	database.DB.Model(&model.OCRJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status": model.OCRStatusDone,
+		"result": model.JSON(result),
+	})
+}
+
+func (q *queue) recognize(ctx context.Context, key string) (*model.OCRDraft, error) {
+	body, err := storage.OpenURL(ctx, storage.URL(imaging.Resolve(database.DB, key)))
+	if err != nil {
+		return nil, fmt.Errorf("下载照片失败: %w", err)
+	}
+	defer body.Close()
+
+	image, err := io.ReadAll(io.LimitReader(body, maxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("下载照片失败: %w", err)
+	}
+	if len(image) > maxImageBytes {
+		return nil, errors.New("照片过大")
+	}
+
+	res, err := q.recognizer.Recognize(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	draft := BuildDraft(res, time.Now())
+	if imaging.ExtractMetadata() {
+		imaging.FillDraft(database.DB, &draft, image, key)
+	}
+	return &draft, nil
+}
+
+func fail(id int64, err error) {
+	msg := []rune(err.Error())
+	if len(msg) > maxErrorLen {
+		msg = msg[:maxErrorLen]
+	}
+	database.DB.Model(&model.OCRJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status": model.OCRStatusFailed,
+		"error":  string(msg),
+	})
+}
@@ -0,0 +1,34 @@
+package ocr
+
+import (
+	"context"
+	"piaoji-server/internal/config"
+	"strings"
+)
+
+// stub 返回配置中的固定文本，用于本地开发和联调，不依赖任何外部服务
+type stub struct {
+	lines []Line
+}
+
+func init() {
+	Register("stub", newStub)
+}
+
+func newStub(cfg *config.OCRConfig) (Recognizer, error) {
+	s := &stub{}
+	for _, text := range strings.Split(cfg.StubText, "\n") {
+		if text = strings.TrimSpace(text); text != "" {
+			s.lines = append(s.lines, Line{Text: text, Confidence: 1})
+		}
+	}
+	return s, nil
+}
+
+func (s *stub) Name() string {
+	return "stub"
+}
+
+func (s *stub) Recognize(ctx context.Context, image []byte) (*Result, error) {
+	return &Result{Lines: s.lines}, ctx.Err()
+}
@@ -0,0 +1,119 @@
+package ocr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"piaoji-server/internal/config"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tesseract 调用本地 tesseract 命令行识别
+// 输出 TSV 格式以获得逐词置信度，再按行合并
+type tesseract struct {
+	path      string
+	languages string
+}
+
+func init() {
+	Register("tesseract", newTesseract)
+}
+
+func newTesseract(cfg *config.OCRConfig) (Recognizer, error) {
+	t := &tesseract{path: cfg.Tesseract.Path, languages: cfg.Tesseract.Languages}
+	if t.path == "" {
+		t.path = "tesseract"
+	}
+	if t.languages == "" {
+		t.languages = "chi_sim+eng"
+	}
+	if _, err := exec.LookPath(t.path); err != nil {
+		return nil, fmt.Errorf("找不到 tesseract: %w", err)
+	}
+	return t, nil
+}
+
+func (t *tesseract) Name() string {
+	return "tesseract"
+}
+
+func (t *tesseract) Recognize(ctx context.Context, image []byte) (*Result, error) {
+	cmd := exec.CommandContext(ctx, t.path, "stdin", "stdout", "-l", t.languages, "tsv")
+	cmd.Stdin = bytes.NewReader(image)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("tesseract 执行失败: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseTSV(stdout.Bytes()), nil
+}
+
+// parseTSV 解析 tesseract 的 TSV 输出
+// 列：level page_num block_num par_num line_num word_num left top width height conf text
+// level 5 为单词，同一 (block, par, line) 的单词合并为一行，行置信度取单词平均值
+func parseTSV(data []byte) *Result {
+	type lineKey struct{ block, par, line string }
+	var (
+		result  Result
+		current lineKey
+		words   []string
+		confSum float64
+	)
+	flush := func() {
+		if len(words) > 0 {
+			result.Lines = append(result.Lines, Line{
+				Text:       joinWords(words),
+				Confidence: confSum / float64(len(words)) / 100,
+			})
+		}
+		words, confSum = nil, 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 12 || cols[0] != "5" {
+			continue
+		}
+		text := strings.TrimSpace(cols[11])
+		conf, err := strconv.ParseFloat(cols[10], 64)
+		if text == "" || err != nil || conf < 0 {
+			continue
+		}
+		key := lineKey{cols[2], cols[3], cols[4]}
+		if key != current {
+			flush()
+			current = key
+		}
+		words = append(words, text)
+		confSum += conf
+	}
+	flush()
+	return &result
+}
+
+// joinWords 拼接单词，中文之间不加空格
+func joinWords(words []string) string {
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(words[i-1])
+			next, _ := utf8.DecodeRuneInString(w)
+			if !unicode.Is(unicode.Han, prev) && !unicode.Is(unicode.Han, next) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
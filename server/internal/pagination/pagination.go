@@ -0,0 +1,232 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var (
+	ErrInvalidCursor  = errors.New("无效的游标")
+	ErrCursorMismatch = errors.New("游标与排序方式不匹配")
+	ErrInvalidSort    = errors.New("不支持的排序字段")
+	ErrInvalidOrder   = errors.New("排序方向只能是 asc 或 desc")
+)
+
+// Order 排序方向
+type Order string
+
+const (
+	Asc  Order = "asc"
+	Desc Order = "desc"
+)
+
+// Kind 排序字段的值类型，决定游标中值的编解码方式
+type Kind int
+
+const (
+	KindTime Kind = iota
+	KindNumber
+	KindString
+)
+
+// SortKey 可用于游标分页的排序字段
+type SortKey[T any] struct {
+	Column string              // SQL 排序表达式，需与 Value 返回值一致
+	Kind   Kind                // 值类型
+	Value  func(T) interface{} // 从记录中取出排序值
+}
+
+// Request 分页参数
+type Request struct {
+	Cursor string
+	Limit  int
+	Sort   string
+	Order  string
+}
+
+// cursor 游标内容，序列化为 JSON 后做 base64 编码，对客户端不透明
+type cursor struct {
+	Sort  string          `json:"s"`
+	Order Order           `json:"o"`
+	Value json.RawMessage `json:"v"`
+	ID    int64           `json:"id"`
+}
+
+// Paginator 基于 (排序值, id) 的 keyset 分页器
+type Paginator[T any] struct {
+	sort  string
+	key   SortKey[T]
+	order Order
+	limit int
+	id    func(T) int64
+
+	afterValue interface{}
+	afterID    int64
+	hasAfter   bool
+}
+
+// New 创建分页器
+// keys 为允许的排序字段，id 用于取出记录主键（作为排序值相同时的决胜字段）
+func New[T any](req Request, keys map[string]SortKey[T], defaultSort string, defaultOrder Order, id func(T) int64) (*Paginator[T], error) {
+	p := &Paginator[T]{
+		sort:  req.Sort,
+		order: Order(req.Order),
+		limit: req.Limit,
+		id:    id,
+	}
+	if p.sort == "" {
+		p.sort = defaultSort
+	}
+	if p.order == "" {
+		p.order = defaultOrder
+	}
+	if p.order != Asc && p.order != Desc {
+		return nil, ErrInvalidOrder
+	}
+	key, ok := keys[p.sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	p.key = key
+	if p.limit <= 0 || p.limit > MaxLimit {
+		p.limit = DefaultLimit
+	}
+
+	if req.Cursor != "" {
+		cur, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cur.Sort != p.sort || cur.Order != p.order {
+			return nil, ErrCursorMismatch
+		}
+		value, err := decodeValue(key.Kind, cur.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		p.afterValue = value
+		p.afterID = cur.ID
+		p.hasAfter = true
+	}
+
+	return p, nil
+}
+
+// Limit 返回每页条数
+func (p *Paginator[T]) Limit() int {
+	return p.limit
+}
+
+// Apply 追加游标条件、排序和条数限制（多取一条用于判断是否还有更多）
+func (p *Paginator[T]) Apply(db *gorm.DB) *gorm.DB {
+	op, dir := "<", "DESC"
+	if p.order == Asc {
+		op, dir = ">", "ASC"
+	}
+	if p.hasAfter {
+		db = db.Where(fmt.Sprintf("(%s, id) %s (?, ?)", p.key.Column, op), p.afterValue, p.afterID)
+	}
+	return db.Order(fmt.Sprintf("%s %s, id %s", p.key.Column, dir, dir)).Limit(p.limit + 1)
+}
+
+// Page 截取当前页并生成下一页游标
+func (p *Paginator[T]) Page(items []T) ([]T, string, bool) {
+	hasMore := len(items) > p.limit
+	if hasMore {
+		items = items[:p.limit]
+	}
+	if !hasMore || len(items) == 0 {
+		return items, "", hasMore
+	}
+
+	last := items[len(items)-1]
+	value, err := encodeValue(p.key.Kind, p.key.Value(last))
+	if err != nil {
+		return items, "", false
+	}
+	return items, encodeCursor(cursor{
+		Sort:  p.sort,
+		Order: p.order,
+		Value: value,
+		ID:    p.id(last),
+	}), true
+}
+
+// EncodeOffset 将偏移量编码为不透明游标，用于无法使用 keyset 的场景（如按相关度排序）
+func EncodeOffset(offset int) string {
+	value, _ := json.Marshal(offset)
+	return encodeCursor(cursor{Sort: "offset", Value: value})
+}
+
+// DecodeOffset 解析 EncodeOffset 生成的游标，空游标返回 0
+func DecodeOffset(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	cur, err := decodeCursor(s)
+	if err != nil || cur.Sort != "offset" {
+		return 0, ErrInvalidCursor
+	}
+	var offset int
+	if err := json.Unmarshal(cur.Value, &offset); err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+func encodeCursor(cur cursor) string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cur cursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cur, nil
+}
+
+func encodeValue(kind Kind, v interface{}) (json.RawMessage, error) {
+	if kind == KindTime {
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("排序值类型错误: %T", v)
+		}
+		return json.Marshal(t.Format(time.RFC3339Nano))
+	}
+	return json.Marshal(v)
+}
+
+func decodeValue(kind Kind, raw json.RawMessage) (interface{}, error) {
+	switch kind {
+	case KindTime:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case KindNumber:
+		var f float64
+		err := json.Unmarshal(raw, &f)
+		return f, err
+	default:
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	}
+}
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// 邮件中最多读取的 MIME 段数，防止恶意构造的嵌套邮件
+const maxMIMEParts = 32
+
+var (
+	reHTMLBreak = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|tr|li|h\d)>`)
+	reHTMLDrop  = regexp.MustCompile(`(?is)<(?:script|style|head)[^>]*>.*?</(?:script|style|head)>`)
+	reHTMLTag   = regexp.MustCompile(`(?s)<[^>]*>`)
+	reBlankLine = regexp.MustCompile(`[ \t]*\n[\s]*`)
+)
+
+// ErrNoText 邮件中没有可解析的正文
+var ErrNoText = errors.New("邮件中没有可识别的正文")
+
+// EmailText 从 .eml 原文中提取主题和正文（优先纯文本，其次 HTML 去标签）
+// 处理 quoted-printable/base64 传输编码和 GBK 等中文字符集
+func EmailText(r io.Reader) (string, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return "", err
+	}
+
+	dec := &mime.WordDecoder{CharsetReader: charsetReader}
+	subject, _ := dec.DecodeHeader(msg.Header.Get("Subject"))
+
+	plain, htmlBody := "", ""
+	parts := 0
+	var walk func(header map[string][]string, body io.Reader) error
+	walk = func(header map[string][]string, body io.Reader) error {
+		parts++
+		if parts > maxMIMEParts {
+			return nil
+		}
+		h := mail.Header(header)
+		mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+		if err != nil {
+			mediaType, params = "text/plain", map[string]string{}
+		}
+
+		if strings.HasPrefix(mediaType, "multipart/") {
+			mr := multipart.NewReader(body, params["boundary"])
+			for {
+				p, err := mr.NextRawPart()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := walk(p.Header, p); err != nil {
+					return err
+				}
+			}
+		}
+
+		if mediaType != "text/plain" && mediaType != "text/html" {
+			return nil
+		}
+		text, err := decodeBody(body, h.Get("Content-Transfer-Encoding"), params["charset"])
+		if err != nil {
+			return err
+		}
+		if mediaType == "text/plain" && plain == "" {
+			plain = text
+		} else if mediaType == "text/html" && htmlBody == "" {
+			htmlBody = text
+		}
+		return nil
+	}
+	if err := walk(msg.Header, msg.Body); err != nil {
+		return "", err
+	}
+
+	body := plain
+	if strings.TrimSpace(body) == "" {
+		body = StripHTML(htmlBody)
+	}
+	if strings.TrimSpace(body) == "" {
+		return "", ErrNoText
+	}
+	return strings.TrimSpace(subject + "\n" + body), nil
+}
+
+// decodeBody 解码传输编码并转为 UTF-8
+func decodeBody(body io.Reader, encoding, charset string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	if charset != "" {
+		r, err := charsetReader(charset, body)
+		if err != nil {
+			return "", err
+		}
+		body = r
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// charsetReader 将 GBK、GB18030、Big5 等字符集转为 UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return input, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// StripHTML 去除 HTML 标签，块级元素换行
+func StripHTML(s string) string {
+	s = reHTMLDrop.ReplaceAllString(s, "")
+	s = reHTMLBreak.ReplaceAllString(s, "\n")
+	s = reHTMLTag.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.TrimSpace(reBlankLine.ReplaceAllString(s, "\n"))
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"piaoji-server/internal/model"
+)
+
+// flightParser 解析航司/OTA 的出票短信和行程单邮件
+//
+// 短信：【东方航空】您已成功购买2024年3月5日MU5101航班，北京首都国际机场T2 08:00起飞，10:15抵达上海虹桥国际机场T2，座位12C，经济舱，票价¥1240。
+// 邮件：航班号:CA1501 出发:北京首都国际机场T3 2024-03-05 08:00 到达:上海虹桥国际机场T2 10:15
+type flightParser struct{}
+
+var (
+	reFlightNumber = regexp.MustCompile(`\b([A-Z]{2}|[A-Z]\d|\d[A-Z])\s?(\d{3,4})\b`)
+	reAirport      = regexp.MustCompile(`(\p{Han}{2,16}机场)\s*(T\d)?`)
+	reFlightDepart = regexp.MustCompile(`(\d{1,2}:\d{2})\s*(?:起飞|出发)(?:[^:]|$)`)
+	reFlightArrive = regexp.MustCompile(`(\d{1,2}:\d{2})\s*(?:抵达|到达|落地)(?:[^:]|$)`)
+	reFlightSeat   = regexp.MustCompile(`座位(?:号)?\s*:?\s*(\d{1,2}[A-K])`)
+	reFlightCabin  = regexp.MustCompile(`(头等舱|公务舱|商务舱|超级经济舱|经济舱)`)
+	reAirportVerb  = regexp.MustCompile(`^.*(?:抵达|到达|飞往|起飞|出发|前往|从|至|由|经|到)`)
+)
+
+func init() {
+	Register(flightParser{})
+}
+
+func (flightParser) Name() string {
+	return "airline"
+}
+
+func (flightParser) Match(text string) bool {
+	for _, kw := range []string{"航班", "起飞", "登机", "机场", "航空"} {
+		if strings.Contains(text, kw) {
+			return reFlightNumber.MatchString(text)
+		}
+	}
+	return false
+}
+
+// Parse 每个航班号生成一张草稿（往返或联程时有多张）
+func (p flightParser) Parse(text string, now time.Time) []Draft {
+	var drafts []Draft
+	for _, record := range splitRecords(text, reFlightNumber) {
+		m := reFlightNumber.FindStringSubmatch(record)
+		if m == nil {
+			continue
+		}
+
+		t := model.CreateTicketRequest{
+			Name:       "机票",
+			Type:       model.TicketTypeFlight,
+			TripNumber: strPtr(m[1] + m[2]),
+			Price:      findPrice(record),
+		}
+
+		// 第一个机场为出发，第二个为到达；时间优先取「08:00起飞」「10:15抵达」，否则取机场之后的第一个时间
+		airports := findAirports(record)
+		if len(airports) > 0 {
+			loc := &model.Location{Type: "route"}
+			depEnd := len(record)
+			if len(airports) > 1 {
+				depEnd = airports[1][0]
+			}
+			loc.Departure = airportPoint(record, airports[0])
+			loc.Departure.Time = flightTime(reFlightDepart, record, record[airports[0][1]:depEnd])
+			if len(airports) > 1 {
+				loc.Arrival = airportPoint(record, airports[1])
+				loc.Arrival.Time = flightTime(reFlightArrive, record, record[airports[1][1]:])
+			}
+			t.Location = loc
+		}
+
+		date, ok := findDate(record, now)
+		if !ok {
+			date, ok = findDate(text, now)
+		}
+		if ok {
+			hour, minute := 0, 0
+			if t.Location != nil {
+				hour, minute, _ = clock(t.Location.Departure.Time)
+			}
+			d := formatTime(date, hour, minute, now.Location())
+			t.Date = &d
+		}
+
+		var seat []string
+		if s := reFlightSeat.FindStringSubmatch(record); s != nil {
+			seat = append(seat, s[1])
+		}
+		if c := reFlightCabin.FindStringSubmatch(record); c != nil {
+			seat = append(seat, c[1])
+		}
+		t.Seat = strPtr(strings.Join(seat, " "))
+
+		drafts = append(drafts, Draft{
+			Provider: p.Name(),
+			Ticket:   t,
+			Missing:  missingFields(&t, "date", "departure", "arrival", "seat"),
+		})
+	}
+	return drafts
+}
+
+// findAirports 查找前两个机场，跳过「起飞前到机场」这类只有「机场」二字的提示语
+func findAirports(record string) [][]int {
+	var airports [][]int
+	for _, m := range reAirport.FindAllStringSubmatchIndex(record, -1) {
+		if reAirportVerb.ReplaceAllString(record[m[2]:m[3]], "") == "机场" {
+			continue
+		}
+		if airports = append(airports, m); len(airports) == 2 {
+			break
+		}
+	}
+	return airports
+}
+
+// airportPoint 机场名（含航站楼）转为行程点，m 为 reAirport 的匹配下标
+func airportPoint(record string, m []int) *model.RoutePoint {
+	name := reAirportVerb.ReplaceAllString(record[m[2]:m[3]], "")
+	if m[4] >= 0 {
+		name += record[m[4]:m[5]]
+	}
+	return &model.RoutePoint{City: cityOf(name), Station: name}
+}
+
+// flightTime 优先按关键字匹配时间，其次取 after 中的第一个时间
+func flightTime(re *regexp.Regexp, record, after string) string {
+	if m := re.FindStringSubmatch(record); m != nil {
+		return m[1]
+	}
+	return reClock.FindString(after)
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"piaoji-server/internal/model"
+)
+
+// movieParser 解析猫眼、淘票票的购票短信，两者格式相近，共用同一实现
+//
+// 猫眼：【猫眼】您已成功购买《流浪地球2》电影票2张，万达影城(CBD店) 2024-01-20 19:30 5号厅 IMAX 7排8座 7排9座，取票码:123456 7890。
+// 淘票票：【淘票票】取票码:12345678，《满江红》1月22日 14:00 CGV影城(颐堤港店)3号厅(激光) 8排5座，请提前到场。
+type movieParser struct {
+	name     string
+	keywords []string
+}
+
+var (
+	reMovieTitle   = regexp.MustCompile(`《([^》]+)》`)
+	reMovieCinema  = regexp.MustCompile(`([\p{Han}A-Za-z0-9]{2,20}(?:影城|影院|电影院|影剧院|影视城|影都)(?:\([^)]{1,20}\))?)`)
+	reMovieHall    = regexp.MustCompile(`((?:[A-Za-z]+\s?)?\d{1,2}号?厅|[\p{Han}A-Za-z]{2,8}厅)(?:\(([^)]{1,12})\))?`)
+	reMovieSeat    = regexp.MustCompile(`(\d{1,2})排(\d{1,2})[座号]`)
+	reMovieVersion = regexp.MustCompile(`(?i)(IMAX\s*3D|IMAX|杜比全景声|杜比视界|杜比|中国巨幕|CINITY|4DX|ScreenX|CGS|原版3D|原版2D|国语3D|国语2D|3D|2D)`)
+	reMovieCode    = regexp.MustCompile(`(?:取票码|取票号|验证码|兑换码)\s*:?\s*([0-9A-Za-z][0-9A-Za-z ]{3,31})`)
+	reMovieVerb    = regexp.MustCompile(`^.*(?:张|在|于|至)`)
+	reMovieVenue   = regexp.MustCompile(`^(?:影城|影院|电影院|影剧院|影视城|影都)$`)
+)
+
+func init() {
+	Register(movieParser{name: "maoyan", keywords: []string{"猫眼"}})
+	Register(movieParser{name: "taopiaopiao", keywords: []string{"淘票票"}})
+}
+
+func (p movieParser) Name() string {
+	return p.name
+}
+
+func (p movieParser) Match(text string) bool {
+	for _, kw := range p.keywords {
+		if strings.Contains(text, kw) {
+			return reMovieTitle.MatchString(text)
+		}
+	}
+	return false
+}
+
+// Parse 每部影片生成一张草稿，同一场次的多个座位合并到一张票据
+func (p movieParser) Parse(text string, now time.Time) []Draft {
+	var drafts []Draft
+	for _, record := range splitRecords(text, reMovieTitle) {
+		m := reMovieTitle.FindStringSubmatch(record)
+		if m == nil {
+			continue
+		}
+
+		t := model.CreateTicketRequest{
+			Name:  strings.TrimSpace(m[1]),
+			Type:  model.TicketTypeMovie,
+			Price: findPrice(record),
+		}
+		// 去掉片名，避免片名中的数字、「厅」字干扰后续匹配
+		rest := strings.Replace(record, m[0], " ", 1)
+
+		// 「请在影院自助机取票」中的「影院」不是影院名称
+		if c := reMovieCinema.FindStringSubmatch(rest); c != nil {
+			if cinema := reMovieVerb.ReplaceAllString(c[1], ""); !reMovieVenue.MatchString(cinema) {
+				t.Location = &model.Location{Type: "single", Address: cinema}
+				rest = strings.Replace(rest, c[1], " ", 1)
+			}
+		}
+
+		version := ""
+		if h := reMovieHall.FindStringSubmatch(rest); h != nil {
+			t.Hall = strPtr(h[1])
+			// 淘票票把版本写在影厅后的括号中，如「3号厅(激光)」
+			version = h[2]
+		}
+		if v := reMovieVersion.FindStringSubmatch(rest); v != nil {
+			version = v[1]
+		}
+		t.Version = strPtr(version)
+
+		var seats []string
+		for _, s := range reMovieSeat.FindAllStringSubmatch(rest, -1) {
+			seats = append(seats, fmt.Sprintf("%s排%s座", s[1], s[2]))
+		}
+		t.Seat = strPtr(strings.Join(seats, " "))
+
+		// 场次取日期之后的第一个时间
+		date, ok := findDate(rest, now)
+		showtime := ""
+		if loc := reFullDate.FindStringIndex(rest); loc != nil {
+			showtime = reClock.FindString(rest[loc[1]:])
+		} else if loc := reMonthDay.FindStringIndex(rest); loc != nil {
+			showtime = reClock.FindString(rest[loc[1]:])
+		}
+		if showtime == "" {
+			showtime = reClock.FindString(rest)
+		}
+		if hour, minute, valid := clock(showtime); valid {
+			s := fmt.Sprintf("%02d:%02d", hour, minute)
+			t.Showtime = &s
+			if ok {
+				d := formatTime(date, hour, minute, now.Location())
+				t.Date = &d
+			}
+		} else if ok {
+			d := formatTime(date, 0, 0, now.Location())
+			t.Date = &d
+		}
+
+		if c := reMovieCode.FindStringSubmatch(rest); c != nil {
+			t.Note = strPtr("取票码 " + strings.TrimSpace(c[1]))
+		}
+
+		drafts = append(drafts, Draft{
+			Provider: p.Name(),
+			Ticket:   t,
+			Missing:  missingFields(&t, "date", "showtime", "hall", "seat"),
+		})
+	}
+	return drafts
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"strings"
+	"time"
+
+	"piaoji-server/internal/model"
+)
+
+// Draft 解析出的票据草稿，由用户确认后再创建
+type Draft struct {
+	Provider string                    `json:"provider"`
+	Ticket   model.CreateTicketRequest `json:"ticket"`
+	Missing  []string                  `json:"missing,omitempty"` // 未能识别的关键字段，提示用户补充
+}
+
+// Parser 第三方确认信息解析器
+type Parser interface {
+	// Name 解析器名称，作为草稿的 provider
+	Name() string
+	// Match 文本是否可能来自该平台
+	Match(text string) bool
+	// Parse 解析文本，now 用于补全短信中省略的年份
+	Parse(text string, now time.Time) []Draft
+}
+
+var registry []Parser
+
+// Register 注册解析器，按注册顺序尝试
+func Register(p Parser) {
+	registry = append(registry, p)
+}
+
+// Providers 已注册的解析器名称
+func Providers() []string {
+	names := make([]string, len(registry))
+	for i, p := range registry {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Parse 用所有匹配的解析器解析文本，返回全部草稿
+func Parse(text string, now time.Time) []Draft {
+	text = normalize(text)
+	drafts := []Draft{}
+	for _, p := range registry {
+		if !p.Match(text) {
+			continue
+		}
+		drafts = append(drafts, p.Parse(text, now)...)
+	}
+	return drafts
+}
+
+// Fallback 没有解析器匹配时的通用草稿：首行作为名称，并尽量识别日期、时间和票价
+// 用于照片识别等来源不明的文本
+func Fallback(text string, now time.Time) Draft {
+	text = normalize(text)
+	t := model.CreateTicketRequest{Type: model.TicketTypeOther, Price: findPrice(text)}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if len([]rune(line)) > 32 {
+				line = string([]rune(line)[:32])
+			}
+			t.Name = line
+			break
+		}
+	}
+	if date, ok := findDate(text, now); ok {
+		hour, minute, _ := clock(text)
+		d := formatTime(date, hour, minute, now.Location())
+		t.Date = &d
+	}
+	return Draft{Provider: "generic", Ticket: t, Missing: missingFields(&t, "date")}
+}
+
+// normalize 统一全角标点和空白，便于正则匹配
+func normalize(text string) string {
+	return strings.NewReplacer(
+		"：", ":",
+		"（", "(",
+		"）", ")",
+		"－", "-",
+		"—", "-",
+		"–", "-",
+		"→", "-",
+		"　", " ",
+		" ", " ",
+		"\r\n", "\n",
+	).Replace(text)
+}
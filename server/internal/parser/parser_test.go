@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "用当前解析结果重写 testdata 中的 .json 文件")
+
+// testNow 固定的当前时间，用于补全短信中省略的年份
+var testNow = time.Date(2024, 1, 10, 12, 0, 0, 0, time.FixedZone("CST", 8*3600))
+
+func TestParseGolden(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback bool // 没有解析器匹配时使用 Fallback 的通用草稿
+		drafts   int  // 期望的草稿数
+		missing  bool // 是否有草稿缺少关键字段（低置信度，需要用户补充）
+	}{
+		{name: "railway_sms", drafts: 1, missing: true}, // 短信中没有到达站
+		{name: "railway_email", drafts: 2},
+		{name: "railway_low_confidence", drafts: 1, missing: true},
+		{name: "flight_sms", drafts: 1},
+		{name: "flight_email", drafts: 2, missing: true},
+		{name: "flight_low_confidence", drafts: 1, missing: true},
+		{name: "maoyan_sms", drafts: 1},
+		{name: "maoyan_low_confidence", drafts: 1, missing: true},
+		{name: "taopiaopiao_sms", drafts: 1},
+		{name: "unparseable", drafts: 0},
+		{name: "fallback_receipt", fallback: true, drafts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join("testdata", tt.name+".txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			drafts := Parse(string(input), testNow)
+			if tt.fallback {
+				if len(drafts) != 0 {
+					t.Fatalf("期望没有解析器匹配，得到 %d 张草稿", len(drafts))
+				}
+				drafts = []Draft{Fallback(string(input), testNow)}
+			}
+			if len(drafts) != tt.drafts {
+				t.Fatalf("草稿数 = %d, 期望 %d", len(drafts), tt.drafts)
+			}
+			hasMissing := false
+			for _, d := range drafts {
+				hasMissing = hasMissing || len(d.Missing) > 0
+			}
+			if hasMissing != tt.missing {
+				t.Errorf("缺失字段 = %v, 期望 %v", hasMissing, tt.missing)
+			}
+
+			got, err := json.MarshalIndent(drafts, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", tt.name+".json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("解析结果与 %s 不一致\n得到:\n%s\n期望:\n%s", golden, got, want)
+			}
+		})
+	}
+}
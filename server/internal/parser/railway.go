@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"piaoji-server/internal/model"
+)
+
+// railwayParser 解析 12306 购票短信和邮件
+//
+// 短信：【铁路客服】订单E123456789,张三您已购1月15日G1234次05车12A号二等座北京南站08:00开，检票口5A。
+// 邮件：2024年01月15日08:00开，北京南站-上海虹桥站，G1234次列车，05车12A号，二等座，成人票，票价553.0元
+type railwayParser struct{}
+
+var (
+	reTrainNumber = regexp.MustCompile(`\b([GDCZTKYSL]?\d{1,5})次`)
+	reTrainSeat   = regexp.MustCompile(`(\d{1,2})车(\d{1,3}[A-F]?)号`)
+	reTrainNoSeat = regexp.MustCompile(`(\d{1,2})车无座`)
+	reTrainRoute  = regexp.MustCompile(`(\p{Han}{2,10}站)\s*-\s*(\p{Han}{2,10}站)`)
+	reTrainDepart = regexp.MustCompile(`(\p{Han}{2,10}站)\s*(\d{1,2}:\d{2})\s*开`)
+	reTrainArrive = regexp.MustCompile(`(\d{1,2}:\d{2})\s*(?:到|抵达?)`)
+	reTrainGate   = regexp.MustCompile(`检票口\s*:?\s*([0-9A-Z]+)`)
+)
+
+// 12306 的席别
+var trainSeatClasses = []string{
+	"商务座", "特等座", "优选一等座", "一等座", "二等座", "高级软卧", "软卧", "动卧", "硬卧", "软座", "硬座", "无座",
+}
+
+func init() {
+	Register(railwayParser{})
+}
+
+func (railwayParser) Name() string {
+	return "12306"
+}
+
+func (railwayParser) Match(text string) bool {
+	return strings.Contains(text, "12306") || strings.Contains(text, "铁路客服") || reTrainNumber.MatchString(text)
+}
+
+// Parse 每个含车次的片段生成一张草稿（一个订单可能包含多名乘客或多程）
+func (p railwayParser) Parse(text string, now time.Time) []Draft {
+	var drafts []Draft
+	for _, record := range splitRecords(text, reTrainNumber) {
+		m := reTrainNumber.FindStringSubmatch(record)
+		if m == nil {
+			continue
+		}
+
+		t := model.CreateTicketRequest{
+			Name:       "火车票",
+			Type:       model.TicketTypeTrain,
+			TripNumber: strPtr(m[1]),
+			Price:      findPrice(record),
+		}
+
+		loc := &model.Location{Type: "route"}
+		if r := reTrainRoute.FindStringSubmatch(record); r != nil {
+			dep, arr := cleanStation(r[1]), cleanStation(r[2])
+			loc.Departure = &model.RoutePoint{City: cityOf(dep), Station: dep}
+			loc.Arrival = &model.RoutePoint{City: cityOf(arr), Station: arr}
+		}
+
+		// 出发时间：「XX站08:00开」或邮件开头的「日期08:00开」
+		departTime := ""
+		if d := reTrainDepart.FindStringSubmatch(record); d != nil {
+			dep := cleanStation(d[1])
+			if loc.Departure == nil {
+				loc.Departure = &model.RoutePoint{City: cityOf(dep), Station: dep}
+			}
+			departTime = d[2]
+		} else if i := strings.Index(record, "开"); i > 0 {
+			if c := reClock.FindAllString(record[:i], -1); len(c) > 0 {
+				departTime = c[len(c)-1]
+			}
+		}
+		if loc.Departure != nil {
+			loc.Departure.Time = departTime
+			if a := reTrainArrive.FindStringSubmatch(record); a != nil && loc.Arrival != nil {
+				loc.Arrival.Time = a[1]
+			}
+			t.Location = loc
+		}
+
+		// 乘车日期在车次之前，邮件开头的下单日期可能并入第一条记录，取车次前最后一个日期；
+		// 多名乘客共用订单开头的日期
+		date, ok := findLastDate(record[:reTrainNumber.FindStringIndex(record)[0]], now)
+		if !ok {
+			date, ok = findDate(record, now)
+		}
+		if !ok {
+			date, ok = findDate(text, now)
+		}
+		if ok {
+			hour, minute, _ := clock(departTime)
+			d := formatTime(date, hour, minute, now.Location())
+			t.Date = &d
+		}
+
+		t.Seat = trainSeat(record)
+		if g := reTrainGate.FindStringSubmatch(record); g != nil {
+			t.Note = strPtr("检票口 " + g[1])
+		}
+
+		drafts = append(drafts, Draft{
+			Provider: p.Name(),
+			Ticket:   t,
+			Missing:  missingFields(&t, "date", "departure", "arrival", "seat"),
+		})
+	}
+	return drafts
+}
+
+// trainSeat 组合车厢座位号和席别，如「05车12A号 二等座」
+func trainSeat(record string) *string {
+	var parts []string
+	if s := reTrainSeat.FindStringSubmatch(record); s != nil {
+		parts = append(parts, s[1]+"车"+s[2]+"号")
+	} else if s := reTrainNoSeat.FindStringSubmatch(record); s != nil {
+		parts = append(parts, s[1]+"车")
+	}
+	for _, class := range trainSeatClasses {
+		if strings.Contains(record, class) {
+			parts = append(parts, class)
+			break
+		}
+	}
+	return strPtr(strings.Join(parts, " "))
+}
+
+// cleanStation 去掉正则多匹配到的席别等前缀，如「二等座北京南站」
+func cleanStation(s string) string {
+	if i := strings.LastIndexAny(s, "座卧铺号票次的从"); i >= 0 {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		s = s[i+size:]
+	}
+	return s
+}
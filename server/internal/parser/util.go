@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"piaoji-server/internal/model"
+)
+
+var (
+	reFullDate = regexp.MustCompile(`(\d{4})\s*[年\-/.]\s*(\d{1,2})\s*[月\-/.]\s*(\d{1,2})\s*日?`)
+	reMonthDay = regexp.MustCompile(`(\d{1,2})月(\d{1,2})日`)
+	reClock    = regexp.MustCompile(`([01]?\d|2[0-3]):([0-5]\d)`)
+	reRecords  = regexp.MustCompile(`[。\n;；]+`)
+	rePrice    = regexp.MustCompile(`(?:票价|总价|实付|金额|价格)\s*:?\s*[¥￥]?\s*(\d+(?:\.\d{1,2})?)\s*元?`)
+)
+
+// 名称超过两个字的城市，其余城市取站点名称前两个字
+var longCityNames = []string{
+	"哈尔滨", "石家庄", "呼和浩特", "乌鲁木齐", "齐齐哈尔", "牡丹江", "佳木斯", "张家口", "秦皇岛",
+	"连云港", "景德镇", "张家界", "西双版纳", "香格里拉", "日喀则", "克拉玛依", "吐鲁番",
+	"鄂尔多斯", "马鞍山", "平顶山", "驻马店", "三门峡", "攀枝花", "六盘水", "防城港",
+	"石河子", "阿勒泰", "满洲里", "二连浩特", "葫芦岛", "大兴安岭", "神农架", "井冈山",
+}
+
+// dateParts 文本中的日期
+type dateParts struct {
+	year, month, day int
+}
+
+// findDate 查找第一个日期，短信中省略年份时取距离 now 最近的年份
+func findDate(text string, now time.Time) (dateParts, bool) {
+	if m := reFullDate.FindStringSubmatch(text); m != nil {
+		return dateParts{atoi(m[1]), atoi(m[2]), atoi(m[3])}, true
+	}
+	if m := reMonthDay.FindStringSubmatch(text); m != nil {
+		month, day := atoi(m[1]), atoi(m[2])
+		return dateParts{inferYear(month, day, now), month, day}, true
+	}
+	return dateParts{}, false
+}
+
+// findLastDate 查找最后一个日期，用于取紧挨着车次/航班号之前的日期
+func findLastDate(text string, now time.Time) (dateParts, bool) {
+	if all := reFullDate.FindAllStringSubmatch(text, -1); all != nil {
+		m := all[len(all)-1]
+		return dateParts{atoi(m[1]), atoi(m[2]), atoi(m[3])}, true
+	}
+	if all := reMonthDay.FindAllStringSubmatch(text, -1); all != nil {
+		m := all[len(all)-1]
+		month, day := atoi(m[1]), atoi(m[2])
+		return dateParts{inferYear(month, day, now), month, day}, true
+	}
+	return dateParts{}, false
+}
+
+// inferYear 在去年、今年、明年中选出离 now 最近的年份
+func inferYear(month, day int, now time.Time) int {
+	best, bestDiff := now.Year(), time.Duration(1<<62)
+	for _, y := range []int{now.Year() - 1, now.Year(), now.Year() + 1} {
+		diff := time.Date(y, time.Month(month), day, 0, 0, 0, 0, now.Location()).Sub(now)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < bestDiff {
+			best, bestDiff = y, diff
+		}
+	}
+	return best
+}
+
+// clock 解析 HH:MM
+func clock(s string) (int, int, bool) {
+	m := reClock.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	return atoi(m[1]), atoi(m[2]), true
+}
+
+// formatTime 组合日期和时间，输出 RFC3339
+func formatTime(d dateParts, hour, minute int, loc *time.Location) string {
+	return time.Date(d.year, time.Month(d.month), d.day, hour, minute, 0, 0, loc).Format(time.RFC3339)
+}
+
+// splitRecords 按句拆分文本，每条记录包含一个 key（车次/航班号）
+// key 之前不含 key 的片段（如单独一行的日期）并入后一条，之后的片段并入前一条
+func splitRecords(text string, key *regexp.Regexp) []string {
+	var records []string
+	pending := ""
+	for _, part := range reRecords.Split(text, -1) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		switch {
+		case key.MatchString(part):
+			records = append(records, joinRecord(pending, part))
+			pending = ""
+		case len(records) > 0:
+			records[len(records)-1] = joinRecord(records[len(records)-1], part)
+		default:
+			pending = joinRecord(pending, part)
+		}
+	}
+	return records
+}
+
+func joinRecord(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "，" + b
+}
+
+// findPrice 查找票价
+func findPrice(text string) *float64 {
+	m := rePrice.FindStringSubmatch(text)
+	if m == nil {
+		return nil
+	}
+	price, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil
+	}
+	return &price
+}
+
+// cityOf 由车站/机场名推断城市
+func cityOf(place string) string {
+	place = strings.TrimSpace(place)
+	for _, city := range longCityNames {
+		if strings.HasPrefix(place, city) {
+			return city
+		}
+	}
+	if utf8.RuneCountInString(place) <= 2 {
+		return strings.TrimSuffix(place, "站")
+	}
+	return string([]rune(place)[:2])
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func strPtr(s string) *string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// missingFields 列出草稿中缺失的关键字段
+func missingFields(t *model.CreateTicketRequest, fields ...string) []string {
+	var missing []string
+	for _, f := range fields {
+		switch f {
+		case "tripNumber":
+			if t.TripNumber == nil {
+				missing = append(missing, f)
+			}
+		case "date":
+			if t.Date == nil {
+				missing = append(missing, f)
+			}
+		case "seat":
+			if t.Seat == nil {
+				missing = append(missing, f)
+			}
+		case "hall":
+			if t.Hall == nil {
+				missing = append(missing, f)
+			}
+		case "showtime":
+			if t.Showtime == nil {
+				missing = append(missing, f)
+			}
+		case "departure":
+			if t.Location == nil || t.Location.Departure == nil {
+				missing = append(missing, f)
+			}
+		case "arrival":
+			if t.Location == nil || t.Location.Arrival == nil {
+				missing = append(missing, f)
+			}
+		}
+	}
+	return missing
+}
@@ -0,0 +1,79 @@
+package phone
+
+import (
+	"fmt"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/secret"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Mask 脱敏手机号，保留前 3 位和后 4 位，如 138****0000
+func Mask(phone string) string {
+	r := []rune(phone)
+	if len(r) < 8 {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:3]) + strings.Repeat("*", len(r)-7) + string(r[len(r)-4:])
+}
+
+// Fields 保存手机号需要写入 users 的字段：脱敏展示值、密文和用于查重的哈希
+func Fields(phone string) (map[string]interface{}, error) {
+	cipher, err := secret.Encrypt(phone)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"phone":        Mask(phone),
+		"phone_cipher": cipher,
+		"phone_hash":   secret.Hash(phone),
+	}, nil
+}
+
+// Owner 已绑定该手机号的用户 ID，没有时为 0
+func Owner(db *gorm.DB, phone string) (int64, error) {
+	var ids []int64
+	if err := db.Model(&model.User{}).Where("phone_hash = ?", secret.Hash(phone)).
+		Limit(1).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return ids[0], nil
+}
+
+// Backfill 把明文保存的手机号改为加密保存
+// users.phone 改为只保存脱敏值，原来的唯一索引由 phone_hash 代替
+func Backfill(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&model.User{}, "idx_users_phone") {
+		if err := db.Migrator().DropIndex(&model.User{}, "idx_users_phone"); err != nil {
+			return fmt.Errorf("删除手机号索引失败: %w", err)
+		}
+	}
+
+	var users []model.User
+	if err := db.Select("id", "phone").
+		Where("phone IS NOT NULL AND phone <> '' AND phone_cipher IS NULL").
+		Find(&users).Error; err != nil {
+		return err
+	}
+	for _, u := range users {
+		// 旧版本绑定接口写入的是脱敏后的占位值，无法还原，直接清除
+		if strings.Contains(*u.Phone, "*") {
+			if err := db.Model(&model.User{}).Where("id = ?", u.ID).Update("phone", nil).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		fields, err := Fields(*u.Phone)
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&model.User{}).Where("id = ?", u.ID).Updates(fields).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
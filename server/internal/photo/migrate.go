@@ -0,0 +1,26 @@
+package photo
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Backfill 为只有封面（tickets.photo）而没有照片记录的旧票据补齐 ticket_photos
+// 语句是幂等的，每次启动都可以执行；旧票据没有缩略图时使用原图地址
+func Backfill(db *gorm.DB) error {
+	res := db.Exec(
+		"INSERT INTO ticket_photos (ticket_id, user_id, url, thumbnail, sort, is_deleted, created_at, updated_at) " +
+			"SELECT t.id, t.user_id, t.photo, COALESCE(t.thumbnail, t.photo), 0, t.is_deleted, t.created_at, t.updated_at " +
+			"FROM tickets t WHERE t.photo IS NOT NULL AND t.photo != '' " +
+			"AND NOT EXISTS (SELECT 1 FROM ticket_photos tp WHERE tp.ticket_id = t.id)",
+	)
+	if res.Error != nil {
+		return fmt.Errorf("迁移票据照片失败: %w", res.Error)
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("[Photo] 已为 %d 张旧票据补齐照片记录", res.RowsAffected)
+	}
+	return nil
+}
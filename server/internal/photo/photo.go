@@ -0,0 +1,345 @@
+package photo
+
+import (
+	"errors"
+	"fmt"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/storage"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// 按 ID 批量查询时每批的数量
+const queryBatchSize = 1000
+
+const (
+	maxURLLen     = 512 // 与 ticket_photos.url 列长度一致
+	maxCaptionLen = 255 // 与 ticket_photos.caption 列长度一致
+)
+
+// ThumbnailURL 照片的缩略图地址，由当前存储驱动生成
+func ThumbnailURL(url string) string {
+	return storage.ThumbnailURL(url)
+}
+
+// Inputs 合并请求中的 photos 与兼容旧客户端的 photo 字段
+// 未传 photos 时，photo 作为唯一的照片
+func Inputs(photo *string, photos []model.TicketPhotoInput) []model.TicketPhotoInput {
+	if len(photos) == 0 && photo != nil && *photo != "" {
+		return []model.TicketPhotoInput{{URL: *photo}}
+	}
+	return Normalize(photos)
+}
+
+// Normalize 去掉首尾空白、空地址和重复地址，保持原顺序
+func Normalize(photos []model.TicketPhotoInput) []model.TicketPhotoInput {
+	seen := make(map[string]bool, len(photos))
+	result := make([]model.TicketPhotoInput, 0, len(photos))
+	for _, p := range photos {
+		p.URL = strings.TrimSpace(p.URL)
+		if p.URL == "" || seen[p.URL] {
+			continue
+		}
+		seen[p.URL] = true
+		result = append(result, p)
+	}
+	return result
+}
+
+// URLs 照片地址列表
+func URLs(photos []model.TicketPhotoInput) []string {
+	urls := make([]string, len(photos))
+	for i, p := range photos {
+		urls[i] = p.URL
+	}
+	return urls
+}
+
+// Validate 校验单张票据的照片数量和字段长度
+func Validate(photos []model.TicketPhotoInput) error {
+	if len(photos) > model.MaxPhotosPerTicket {
+		return fmt.Errorf("每张票据最多 %d 张照片", model.MaxPhotosPerTicket)
+	}
+	for _, p := range photos {
+		if len(p.URL) > maxURLLen {
+			return errors.New("照片地址过长")
+		}
+		if p.Caption != nil && utf8.RuneCountInString(*p.Caption) > maxCaptionLen {
+			return fmt.Errorf("照片说明不能超过 %d 个字符", maxCaptionLen)
+		}
+		if p.Width < 0 || p.Height < 0 || p.Bytes < 0 {
+			return errors.New("照片尺寸无效")
+		}
+	}
+	return nil
+}
+
+// Build 按输入顺序构造照片记录（未设置 TicketID）
+func Build(userID int64, inputs []model.TicketPhotoInput) []model.TicketPhoto {
+	photos := make([]model.TicketPhoto, len(inputs))
+	for i, in := range inputs {
+		photos[i] = model.TicketPhoto{
+			UserID:    userID,
+			URL:       in.URL,
+			Thumbnail: ThumbnailURL(in.URL),
+			Caption:   in.Caption,
+			Sort:      i,
+			Width:     in.Width,
+			Height:    in.Height,
+			Bytes:     in.Bytes,
+		}
+	}
+	return photos
+}
+
+// SetCover 用第一张照片设置票据封面
+func SetCover(ticket *model.Ticket) {
+	ticket.Photo, ticket.Thumbnail = nil, nil
+	if len(ticket.Photos) > 0 {
+		url, thumb := ticket.Photos[0].URL, ticket.Photos[0].Thumbnail
+		ticket.Photo, ticket.Thumbnail = &url, &thumb
+	}
+}
+
+// Attach 为新建的票据写入照片记录（使用各票据 Photos 中的照片）
+func Attach(tx *gorm.DB, tickets []model.Ticket) error {
+	var photos []model.TicketPhoto
+	for i := range tickets {
+		for j := range tickets[i].Photos {
+			tickets[i].Photos[j].TicketID = tickets[i].ID
+		}
+		photos = append(photos, tickets[i].Photos...)
+	}
+	if len(photos) == 0 {
+		return nil
+	}
+	if err := tx.CreateInBatches(&photos, queryBatchSize).Error; err != nil {
+		return err
+	}
+
+	// 回填生成的 ID
+	n := 0
+	for i := range tickets {
+		for j := range tickets[i].Photos {
+			tickets[i].Photos[j] = photos[n]
+			n++
+		}
+	}
+	return nil
+}
+
+// Set 将票据的照片替换为 inputs，同步更新封面
+// 地址不变的照片保留原记录只更新顺序和说明，返回新增数和被移除的照片
+func Set(tx *gorm.DB, ticket *model.Ticket, inputs []model.TicketPhotoInput) (int, []model.TicketPhoto, error) {
+	var existing []model.TicketPhoto
+	if err := tx.Where("ticket_id = ?", ticket.ID).Find(&existing).Error; err != nil {
+		return 0, nil, err
+	}
+	byURL := make(map[string]model.TicketPhoto, len(existing))
+	for _, p := range existing {
+		byURL[p.URL] = p
+	}
+
+	photos := Build(ticket.UserID, inputs)
+	added := 0
+	for i := range photos {
+		photos[i].TicketID = ticket.ID
+		photos[i].IsDeleted = ticket.IsDeleted
+		if old, ok := byURL[photos[i].URL]; ok {
+			delete(byURL, old.URL)
+			photos[i].ID = old.ID
+			photos[i].CreatedAt = old.CreatedAt
+			// 保留服务端处理生成的缩略图和版本
+			photos[i].Thumbnail = old.Thumbnail
+			photos[i].Variants = old.Variants
+			if err := tx.Model(&model.TicketPhoto{}).Where("id = ?", old.ID).Updates(map[string]interface{}{
+				"caption": photos[i].Caption,
+				"sort":    photos[i].Sort,
+				"width":   photos[i].Width,
+				"height":  photos[i].Height,
+				"bytes":   photos[i].Bytes,
+			}).Error; err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		if err := tx.Create(&photos[i]).Error; err != nil {
+			return 0, nil, err
+		}
+		added++
+	}
+
+	removed := make([]model.TicketPhoto, 0, len(byURL))
+	for _, p := range existing {
+		if _, ok := byURL[p.URL]; ok {
+			removed = append(removed, p)
+		}
+	}
+	if len(removed) > 0 {
+		ids := make([]int64, len(removed))
+		for i, p := range removed {
+			ids[i] = p.ID
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&model.TicketPhoto{}).Error; err != nil {
+			return 0, nil, err
+		}
+	}
+
+	ticket.Photos = photos
+	SetCover(ticket)
+	if err := tx.Model(&model.Ticket{}).Where("id = ?", ticket.ID).Updates(map[string]interface{}{
+		"photo":     ticket.Photo,
+		"thumbnail": ticket.Thumbnail,
+	}).Error; err != nil {
+		return 0, nil, err
+	}
+	return added, removed, nil
+}
+
+// ReplaceCover 兼容旧客户端只提交 photo 的更新：替换第一张照片，url 为空时移除第一张
+func ReplaceCover(existing []model.TicketPhoto, url string) []model.TicketPhotoInput {
+	inputs := make([]model.TicketPhotoInput, 0, len(existing)+1)
+	if url != "" {
+		inputs = append(inputs, model.TicketPhotoInput{URL: url})
+	}
+	for i, p := range existing {
+		if i == 0 {
+			continue
+		}
+		inputs = append(inputs, model.TicketPhotoInput{
+			URL: p.URL, Caption: p.Caption, Width: p.Width, Height: p.Height, Bytes: p.Bytes,
+		})
+	}
+	return Normalize(inputs)
+}
+
+// SetDeleted 票据移入/移出回收站时同步照片状态
+func SetDeleted(tx *gorm.DB, ticketIDs []int64, deleted bool) error {
+	if len(ticketIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&model.TicketPhoto{}).Where("ticket_id IN ?", ticketIDs).
+		UpdateColumn("is_deleted", deleted).Error
+}
+
+// Load 查询票据的全部照片，按票据 ID 分组并按顺序排列
+func Load(db *gorm.DB, ticketIDs []int64) (map[int64][]model.TicketPhoto, error) {
+	result := make(map[int64][]model.TicketPhoto, len(ticketIDs))
+	for start := 0; start < len(ticketIDs); start += queryBatchSize {
+		end := min(start+queryBatchSize, len(ticketIDs))
+		var photos []model.TicketPhoto
+		if err := db.Where("ticket_id IN ?", ticketIDs[start:end]).
+			Order("ticket_id, sort, id").
+			Find(&photos).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range photos {
+			result[p.TicketID] = append(result[p.TicketID], p)
+		}
+	}
+	return result, nil
+}
+
+// Fill 为票据填充照片列表
+func Fill(db *gorm.DB, tickets []model.Ticket) error {
+	if len(tickets) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(tickets))
+	for i, t := range tickets {
+		ids[i] = t.ID
+	}
+	photos, err := Load(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range tickets {
+		tickets[i].Photos = photos[tickets[i].ID]
+		if tickets[i].Photos == nil {
+			tickets[i].Photos = []model.TicketPhoto{}
+		}
+	}
+	return nil
+}
+
+// FillOne 为单张票据填充照片列表
+func FillOne(db *gorm.DB, ticket *model.Ticket) error {
+	tickets := []model.Ticket{*ticket}
+	if err := Fill(db, tickets); err != nil {
+		return err
+	}
+	ticket.Photos = tickets[0].Photos
+	return nil
+}
+
+// ObjectKeys 照片及其各尺寸版本在存储中的对象 key，不在当前存储地址下的照片忽略
+func ObjectKeys(photos []model.TicketPhoto) []string {
+	keys := make([]string, 0, len(photos))
+	for _, p := range photos {
+		for _, url := range URLsOf(p) {
+			if key, ok := storage.KeyFromURL(url); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// Keys 删除照片记录后可以从存储中删除的对象 key，须在删除记录的事务提交后调用：
+// 只保留 userID 上传目录下的对象，原图仍被其他照片记录（包括回收站中的）引用时跳过该照片
+func Keys(db *gorm.DB, userID int64, photos []model.TicketPhoto) ([]string, error) {
+	if len(photos) == 0 {
+		return nil, nil
+	}
+	urls := make([]string, 0, len(photos))
+	for _, p := range photos {
+		urls = append(urls, p.URL)
+	}
+	referenced := make(map[string]bool)
+	for start := 0; start < len(urls); start += queryBatchSize {
+		end := start + queryBatchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		var rows []string
+		if err := db.Model(&model.TicketPhoto{}).Where("url IN ?", urls[start:end]).
+			Distinct().Pluck("url", &rows).Error; err != nil {
+			return nil, err
+		}
+		for _, url := range rows {
+			referenced[url] = true
+		}
+	}
+
+	prefix := model.UploadKeyPrefix(userID)
+	keys := make([]string, 0, len(photos))
+	for _, key := range ObjectKeys(unreferenced(photos, referenced)) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// unreferenced 原图地址不在 referenced 中的照片
+func unreferenced(photos []model.TicketPhoto, referenced map[string]bool) []model.TicketPhoto {
+	out := make([]model.TicketPhoto, 0, len(photos))
+	for _, p := range photos {
+		if !referenced[p.URL] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// URLsOf 照片原图和各尺寸版本的地址
+func URLsOf(p model.TicketPhoto) []string {
+	urls := make([]string, 0, len(p.Variants)+1)
+	urls = append(urls, p.URL)
+	for _, v := range p.Variants {
+		urls = append(urls, v.URL)
+	}
+	return urls
+}
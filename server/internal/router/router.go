@@ -1,8 +1,10 @@
 package router
 
 import (
+	"expvar"
 	"piaoji-server/internal/handler"
 	"piaoji-server/internal/middleware"
+	"piaoji-server/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,6 +16,21 @@ func Setup(r *gin.Engine) {
 	ticketHandler := handler.NewTicketHandler()
 	tagHandler := handler.NewTagHandler()
 	uploadHandler := handler.NewUploadHandler()
+	exportHandler := handler.NewExportHandler()
+	importHandler := handler.NewImportHandler()
+	calendarHandler := handler.NewCalendarHandler()
+
+	// 本地存储：文件访问和直传接口（凭签名访问，无需登录）
+	if _, ok := storage.Local(); ok {
+		r.GET(storage.LocalFilePath+"/*key", uploadHandler.LocalFile)
+		r.HEAD(storage.LocalFilePath+"/*key", uploadHandler.LocalFile)
+		r.POST(storage.LocalUploadPath, uploadHandler.LocalUpload)
+	}
+
+	// 运行指标（孤儿照片清理等），仅在 debug 模式下开放
+	if gin.Mode() == gin.DebugMode {
+		r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	}
 
 	// API 路由组
 	api := r.Group("/api")
@@ -22,8 +39,17 @@ func Setup(r *gin.Engine) {
 		auth := api.Group("/auth")
 		{
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/email/code", authHandler.SendLoginEmailCode)
+			auth.POST("/email/login", authHandler.EmailLogin)
 		}
 
+		// 七牛云上传回调（通过回调签名校验）
+		api.POST("/upload/callback", uploadHandler.Callback)
+
+		// 日历订阅（通过 URL 中的密钥识别用户）
+		api.GET("/calendar/:file", calendarHandler.Feed)
+
 		// 需要登录的路由
 		authorized := api.Group("")
 		authorized.Use(middleware.JWTAuth())
@@ -31,12 +57,22 @@ func Setup(r *gin.Engine) {
 			// 认证相关
 			authorized.GET("/auth/verify", authHandler.Verify)
 			authorized.POST("/auth/bind-phone", authHandler.BindPhone)
+			authorized.POST("/auth/decrypt", authHandler.Decrypt)
+			authorized.POST("/auth/email/bind-code", authHandler.SendBindEmailCode)
+			authorized.POST("/auth/email/bind", authHandler.BindEmail)
+			authorized.GET("/auth/identities", authHandler.Identities)
+			authorized.POST("/auth/logout", authHandler.Logout)
+			authorized.GET("/auth/sessions", authHandler.Sessions)
+			authorized.DELETE("/auth/sessions", authHandler.RevokeOtherSessions)
+			authorized.DELETE("/auth/sessions/:id", authHandler.RevokeSession)
 
 			// 用户相关
 			user := authorized.Group("/user")
 			{
 				user.GET("/profile", userHandler.GetProfile)
 				user.PUT("/profile", userHandler.UpdateProfile)
+				user.POST("/calendar-token", calendarHandler.ResetToken)
+				user.DELETE("/calendar-token", calendarHandler.RevokeToken)
 			}
 
 			// 票据相关
@@ -44,6 +80,10 @@ func Setup(r *gin.Engine) {
 			{
 				tickets.GET("", ticketHandler.List)
 				tickets.POST("", ticketHandler.Create)
+				tickets.GET("/search", ticketHandler.Search)
+				tickets.GET("/duplicates", ticketHandler.Duplicates)
+				tickets.POST("/batch", ticketHandler.Batch)
+				tickets.POST("/parse", ticketHandler.Parse)
 				tickets.GET("/:id", ticketHandler.Get)
 				tickets.PUT("/:id", ticketHandler.Update)
 				tickets.DELETE("/:id", ticketHandler.Delete)
@@ -57,8 +97,10 @@ func Setup(r *gin.Engine) {
 				tags.GET("", tagHandler.List)
 				tags.GET("/global", tagHandler.GetGlobal)
 				tags.GET("/custom", tagHandler.GetCustom)
+				tags.GET("/suggest", tagHandler.Suggest)
 				tags.POST("", tagHandler.Create)
 				tags.PUT("/:id", tagHandler.Update)
+				tags.POST("/:id/merge", tagHandler.Merge)
 				tags.DELETE("/:id", tagHandler.Delete)
 			}
 
@@ -66,8 +108,13 @@ func Setup(r *gin.Engine) {
 			upload := authorized.Group("/upload")
 			{
 				upload.POST("/token", uploadHandler.GetToken)
-				upload.POST("/callback", uploadHandler.Callback)
+				upload.POST("/ocr", uploadHandler.Recognize)
+				upload.GET("/ocr/:id", uploadHandler.GetRecognizeJob)
 			}
+
+			// 数据导出/导入
+			authorized.GET("/export", exportHandler.Export)
+			authorized.POST("/import", importHandler.Import)
 		}
 	}
 }
@@ -0,0 +1,85 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"piaoji-server/internal/config"
+	"strings"
+)
+
+// version 密文前缀，更换算法或密钥时用于区分
+const version = "v1:"
+
+// ErrInvalid 密文格式错误或无法用当前密钥解密
+var ErrInvalid = errors.New("无法解密数据")
+
+// keys 由数据密钥派生出的加密密钥和哈希密钥，二者互不相同
+func keys() (enc, mac []byte) {
+	master := config.Cfg.Security.GetDataKey()
+	e := hmac.New(sha256.New, master)
+	e.Write([]byte("encrypt"))
+	m := hmac.New(sha256.New, master)
+	m.Write([]byte("hash"))
+	return e.Sum(nil), m.Sum(nil)
+}
+
+// Encrypt 使用 AES-256-GCM 加密敏感字段，每次加密使用随机 nonce
+func Encrypt(plain string) (string, error) {
+	enc, _ := keys()
+	gcm, err := newGCM(enc)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return version + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 Encrypt 的结果
+func Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, version) {
+		return "", ErrInvalid
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(value[len(version):])
+	if err != nil {
+		return "", ErrInvalid
+	}
+	enc, _ := keys()
+	gcm, err := newGCM(enc)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrInvalid
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	return string(plain), nil
+}
+
+// Hash 敏感字段的 HMAC-SHA256，相同的值得到相同结果，用于加密后的等值查询和唯一索引
+func Hash(value string) string {
+	_, key := keys()
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(value))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,214 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"piaoji-server/internal/config"
+	"piaoji-server/internal/model"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	refreshTokenBytes = 32
+	// reuseGrace 刷新后旧 refresh token 的容忍时间：并发刷新时后到的请求只会失败，不会被当作盗用
+	reuseGrace = 30 * time.Second
+	// lastSeenInterval 最后活跃时间的更新间隔，避免每个请求都写库
+	lastSeenInterval = 5 * time.Minute
+)
+
+// 与 sessions 表列长度一致
+const (
+	maxDeviceNameLen = 64
+	maxUserAgentLen  = 255
+)
+
+var (
+	// ErrInvalid refresh token 无效、已过期，或会话已退出
+	ErrInvalid = errors.New("登录已失效，请重新登录")
+	// ErrNotFound 会话不存在或已退出
+	ErrNotFound = errors.New("会话不存在")
+)
+
+// Device 登录设备信息
+type Device struct {
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+// Create 登录时创建会话，返回会话和 refresh token（明文只在这里出现）
+func Create(db *gorm.DB, userID int64, device Device) (*model.Session, string, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	s := model.Session{
+		UserID:      userID,
+		RefreshHash: hash(token),
+		DeviceName:  truncate(device.Name, maxDeviceNameLen),
+		UserAgent:   truncate(device.UserAgent, maxUserAgentLen),
+		IP:          device.IP,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(config.Cfg.JWT.GetRefreshExpire()),
+	}
+	if err := db.Create(&s).Error; err != nil {
+		return nil, "", err
+	}
+	return &s, token, nil
+}
+
+// Rotate 用 refresh token 换取新的 refresh token，有效期顺延
+// 已被换掉的 refresh token 超过容忍时间后再次出现，视为被盗用，直接退出该会话
+// ip 为空时保留原来的 IP
+func Rotate(db *gorm.DB, token string, ip string) (*model.Session, string, error) {
+	if token == "" {
+		return nil, "", ErrInvalid
+	}
+	h := hash(token)
+	next, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var s model.Session
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_hash = ?", h).First(&s).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if s.RevokedAt != nil || now.After(s.ExpiresAt) {
+			return ErrInvalid
+		}
+		s.PrevRefreshHash, s.RefreshHash = s.RefreshHash, hash(next)
+		s.RotatedAt, s.LastSeenAt = &now, now
+		s.ExpiresAt = now.Add(config.Cfg.JWT.GetRefreshExpire())
+		if ip != "" {
+			s.IP = ip
+		}
+		return tx.Model(&model.Session{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+			"refresh_hash":      s.RefreshHash,
+			"prev_refresh_hash": s.PrevRefreshHash,
+			"rotated_at":        s.RotatedAt,
+			"last_seen_at":      s.LastSeenAt,
+			"expires_at":        s.ExpiresAt,
+			"ip":                s.IP,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", reused(db, h)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &s, next, nil
+}
+
+// reused 处理不是当前 refresh token 的请求，总是返回错误
+// 已被换掉的 refresh token 超过容忍时间后再次出现时退出对应会话
+func reused(db *gorm.DB, h string) error {
+	var s model.Session
+	err := db.Where("prev_refresh_hash = ? AND revoked_at IS NULL", h).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if s.RotatedAt != nil && time.Since(*s.RotatedAt) < reuseGrace {
+		return ErrInvalid
+	}
+	log.Printf("[Session] 旧 refresh token 被重复使用，退出会话: id=%d, user=%d", s.ID, s.UserID)
+	if err := db.Model(&model.Session{}).Where("id = ?", s.ID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return ErrInvalid
+}
+
+// Check 校验会话仍然有效，并按间隔更新最后活跃时间
+func Check(db *gorm.DB, sessionID, userID int64) error {
+	if sessionID == 0 {
+		return ErrInvalid
+	}
+	var s model.Session
+	err := db.Select("id", "user_id", "last_seen_at", "expires_at", "revoked_at").
+		Where("id = ?", sessionID).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalid
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if s.UserID != userID || s.RevokedAt != nil || now.After(s.ExpiresAt) {
+		return ErrInvalid
+	}
+	if now.Sub(s.LastSeenAt) > lastSeenInterval {
+		db.Model(&model.Session{}).Where("id = ?", s.ID).UpdateColumn("last_seen_at", now)
+	}
+	return nil
+}
+
+// List 用户当前有效的会话，按最后活跃时间倒序
+func List(db *gorm.DB, userID int64) ([]model.Session, error) {
+	var sessions []model.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke 退出用户的一个会话
+func Revoke(db *gorm.DB, userID, sessionID int64) error {
+	result := db.Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeOthers 退出用户除 keepID 以外的所有会话，返回退出的数量
+func RevokeOthers(db *gorm.DB, userID, keepID int64) (int64, error) {
+	result := db.Model(&model.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func newToken() (string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate 截断到 n 个字符以内
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"piaoji-server/internal/config"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 本地存储的访问路径和上传接口路径，由 router 注册
+const (
+	LocalFilePath   = "/uploads"
+	LocalUploadPath = "/api/upload/local"
+)
+
+var (
+	ErrInvalidKey   = errors.New("无效的文件路径")
+	ErrInvalidToken = errors.New("上传凭证无效或已过期")
+	ErrTooLarge     = errors.New("文件过大")
+)
+
+// LocalStorage 本地磁盘存储
+// 文件保存在 dir 下，由服务自身提供上传接口和访问地址，适合开发环境和私有部署
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+	private bool
+}
+
+func newLocal(cfg *config.LocalStorageConfig, secret string) (*LocalStorage, error) {
+	if secret == "" {
+		return nil, errors.New("本地存储缺少签名密钥")
+	}
+	dir, err := filepath.Abs(cfg.GetDir())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		secret:  []byte(secret),
+		private: cfg.Private,
+	}, nil
+}
+
+// Local 当前驱动为本地存储时返回该驱动
+func Local() (*LocalStorage, bool) {
+	s, ok := current.(*LocalStorage)
+	return s, ok
+}
+
+func (s *LocalStorage) Name() string {
+	return "local"
+}
+
+// PresignUpload 上传凭证格式为 "过期时间:大小上限:签名"
+func (s *LocalStorage) PresignUpload(key string, maxBytes int64, expires time.Duration) (*UploadForm, error) {
+	if _, err := s.path(key); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(expires).Unix()
+	sig := s.sign("upload", key, strconv.FormatInt(deadline, 10), strconv.FormatInt(maxBytes, 10))
+	return &UploadForm{
+		URL: s.baseURL + LocalUploadPath,
+		Fields: map[string]string{
+			"token": fmt.Sprintf("%d:%d:%s", deadline, maxBytes, sig),
+			"key":   key,
+		},
+	}, nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + LocalFilePath + "/" + key
+}
+
+// PrivateURL 访问地址附带过期时间 e 和签名 token
+func (s *LocalStorage) PrivateURL(key string, expires time.Duration) (string, error) {
+	deadline := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	return fmt.Sprintf("%s?e=%s&token=%s", s.URL(key), deadline, s.sign("get", key, deadline)), nil
+}
+
+// ThumbnailURL 本地存储不做图片处理，返回原图地址
+func (s *LocalStorage) ThumbnailURL(key string, width, height int) string {
+	return s.URL(key)
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.Save(key, r, size)
+	return err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, keys []string) error {
+	var failed []string
+	for _, key := range keys {
+		p, err := s.path(key)
+		if err != nil {
+			failed = append(failed, key)
+			continue
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			failed = append(failed, key)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 个对象删除失败: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// List 遍历目录后按 key 排序分页，适合开发环境和小规模部署
+func (s *LocalStorage) List(ctx context.Context, prefix, marker string, limit int) ([]ObjectInfo, string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			// 跳过与 prefix 无关的目录
+			if key != "." && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(key, prefix) && key > marker && !strings.HasPrefix(d.Name(), ".") {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("列举对象失败: %w", err)
+	}
+	sort.Strings(keys)
+
+	next := ""
+	if len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	objects := make([]ObjectInfo, 0, len(keys))
+	for _, key := range keys {
+		info, err := s.Stat(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		objects = append(objects, *info)
+	}
+	return objects, next, nil
+}
+
+// Private 是否只允许通过签名链接访问
+func (s *LocalStorage) Private() bool {
+	return s.private
+}
+
+// File 对象在磁盘上的路径
+func (s *LocalStorage) File(key string) (string, error) {
+	return s.path(key)
+}
+
+// VerifyUpload 校验上传凭证，返回允许的文件大小上限
+func (s *LocalStorage) VerifyUpload(key, token string) (int64, error) {
+	parts := strings.SplitN(token, ":", 3)
+	if len(parts) != 3 {
+		return 0, ErrInvalidToken
+	}
+	deadline, err1 := strconv.ParseInt(parts[0], 10, 64)
+	maxBytes, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || time.Now().Unix() > deadline {
+		return 0, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign("upload", key, parts[0], parts[1]))) {
+		return 0, ErrInvalidToken
+	}
+	return maxBytes, nil
+}
+
+// VerifyGet 校验私有链接的签名
+func (s *LocalStorage) VerifyGet(key, deadline, token string) bool {
+	e, err := strconv.ParseInt(deadline, 10, 64)
+	if err != nil || time.Now().Unix() > e {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(s.sign("get", key, deadline)))
+}
+
+// Save 写入对象，超过 maxBytes 时不保留文件
+// 先写临时文件再重命名，避免读到写了一半的文件
+func (s *LocalStorage) Save(key string, r io.Reader, maxBytes int64) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n > maxBytes {
+		return nil, ErrTooLarge
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, err
+	}
+
+	info, err := s.Stat(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	info.ETag = hex.EncodeToString(hash.Sum(nil))
+	return info, nil
+}
+
+// path 把 key 转为磁盘路径，拒绝绝对路径和 .. 等越出存储目录的 key
+func (s *LocalStorage) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == ".." || strings.HasPrefix(seg, ".") {
+			return "", ErrInvalidKey
+		}
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStorage) sign(parts ...string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
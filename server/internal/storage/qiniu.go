@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"piaoji-server/internal/config"
+	"strings"
+	"time"
+
+	"github.com/qiniu/go-sdk/v7/auth/qbox"
+	"github.com/qiniu/go-sdk/v7/client"
+	qiniu "github.com/qiniu/go-sdk/v7/storage"
+)
+
+// 七牛批量操作单次最多 1000 条
+const qiniuBatchLimit = 1000
+
+// 七牛错误码：对象不存在
+const qiniuNoSuchFile = 612
+
+// QiniuStorage 七牛云存储
+// 配置了 callback_url 时，上传完成后七牛会回调服务端记录上传
+type QiniuStorage struct {
+	cfg      *config.QiniuConfig
+	mac      *qbox.Mac
+	manager  *qiniu.BucketManager
+	uploader *qiniu.FormUploader
+}
+
+// 上传回调内容，上传用户由 key 中的用户 ID 确定
+const qiniuCallbackBody = "key=$(key)&hash=$(etag)&fsize=$(fsize)&mime=$(mimeType)&bucket=$(bucket)"
+
+func newQiniu(cfg *config.QiniuConfig) *QiniuStorage {
+	mac := qbox.NewMac(cfg.AccessKey, cfg.SecretKey)
+
+	qcfg := &qiniu.Config{UseHTTPS: true}
+	if region, ok := qiniu.GetRegionByID(qiniu.RegionID(cfg.Region)); ok {
+		qcfg.Region = &region
+	}
+	return &QiniuStorage{
+		cfg:      cfg,
+		mac:      mac,
+		manager:  qiniu.NewBucketManager(mac, qcfg),
+		uploader: qiniu.NewFormUploader(qcfg),
+	}
+}
+
+// Qiniu 当前驱动为七牛云时返回该驱动
+func Qiniu() (*QiniuStorage, bool) {
+	s, ok := current.(*QiniuStorage)
+	return s, ok
+}
+
+// VerifyCallback 校验上传回调请求的 Authorization 签名（QBox / Qiniu），请求体可继续读取
+func (s *QiniuStorage) VerifyCallback(req *http.Request) (bool, error) {
+	return s.mac.VerifyCallback(req)
+}
+
+// HasCallback 是否配置了上传回调，配置后每次上传完成都会回调记录
+func (s *QiniuStorage) HasCallback() bool {
+	return s.cfg.CallbackURL != ""
+}
+
+func (s *QiniuStorage) Name() string {
+	return "qiniu"
+}
+
+func (s *QiniuStorage) PresignUpload(key string, maxBytes int64, expires time.Duration) (*UploadForm, error) {
+	putPolicy := qiniu.PutPolicy{
+		Scope:      fmt.Sprintf("%s:%s", s.cfg.Bucket, key),
+		Expires:    uint64(expires.Seconds()),
+		FsizeLimit: maxBytes,
+		ReturnBody: `{"key":"$(key)","hash":"$(etag)","fsize":$(fsize),"bucket":"$(bucket)"}`,
+	}
+	// 设置回调后，客户端收到的是回调接口的响应而不是 ReturnBody
+	if s.cfg.CallbackURL != "" {
+		putPolicy.CallbackURL = s.cfg.CallbackURL
+		putPolicy.CallbackBody = qiniuCallbackBody
+		putPolicy.CallbackBodyType = "application/x-www-form-urlencoded"
+	}
+	return &UploadForm{
+		URL: s.cfg.GetUploadURL(),
+		Fields: map[string]string{
+			"token": putPolicy.UploadToken(s.mac),
+			"key":   key,
+		},
+	}, nil
+}
+
+func (s *QiniuStorage) URL(key string) string {
+	domain := strings.TrimRight(s.cfg.Domain, "/")
+	if domain == "" {
+		return ""
+	}
+	return domain + "/" + key
+}
+
+func (s *QiniuStorage) PrivateURL(key string, expires time.Duration) (string, error) {
+	deadline := time.Now().Add(expires).Unix()
+	return qiniu.MakePrivateURLv2(s.mac, strings.TrimRight(s.cfg.Domain, "/"), key, deadline), nil
+}
+
+func (s *QiniuStorage) ThumbnailURL(key string, width, height int) string {
+	return fmt.Sprintf("%s?imageView2/1/w/%d/h/%d/q/80", s.URL(key), width, height)
+}
+
+func (s *QiniuStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return httpGet(ctx, s.URL(key))
+}
+
+func (s *QiniuStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.manager.Stat(s.cfg.Bucket, key)
+	if err != nil {
+		var qerr *client.ErrorInfo
+		if errors.As(err, &qerr) && qerr.Code == qiniuNoSuchFile {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        info.Fsize,
+		ContentType: info.MimeType,
+		ETag:        info.Hash,
+		// putTime 单位为 100 纳秒
+		ModTime: time.Unix(0, info.PutTime*100),
+	}, nil
+}
+
+func (s *QiniuStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	// scope 指定 key 时允许覆盖同名对象
+	putPolicy := qiniu.PutPolicy{Scope: fmt.Sprintf("%s:%s", s.cfg.Bucket, key)}
+	var ret qiniu.PutRet
+	if err := s.uploader.Put(ctx, &ret, putPolicy.UploadToken(s.mac), key, r, size,
+		&qiniu.PutExtra{MimeType: contentType}); err != nil {
+		return fmt.Errorf("上传对象失败: %w", err)
+	}
+	return nil
+}
+
+func (s *QiniuStorage) Delete(ctx context.Context, keys []string) error {
+	var failed []string
+	for start := 0; start < len(keys); start += qiniuBatchLimit {
+		end := min(start+qiniuBatchLimit, len(keys))
+
+		ops := make([]string, 0, end-start)
+		for _, key := range keys[start:end] {
+			ops = append(ops, qiniu.URIDelete(s.cfg.Bucket, key))
+		}
+
+		rets, err := s.manager.Batch(ops)
+		if err != nil && len(rets) == 0 {
+			return fmt.Errorf("批量删除对象失败: %w", err)
+		}
+		for i, ret := range rets {
+			if ret.Code != 200 && ret.Code != qiniuNoSuchFile {
+				failed = append(failed, keys[start+i])
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 个对象删除失败: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (s *QiniuStorage) List(ctx context.Context, prefix, marker string, limit int) ([]ObjectInfo, string, error) {
+	ret, hasNext, err := s.manager.ListFilesWithContext(ctx, s.cfg.Bucket,
+		qiniu.ListInputOptionsPrefix(prefix),
+		qiniu.ListInputOptionsMarker(marker),
+		qiniu.ListInputOptionsLimit(min(limit, qiniuBatchLimit)))
+	if err != nil {
+		return nil, "", fmt.Errorf("列举对象失败: %w", err)
+	}
+
+	objects := make([]ObjectInfo, len(ret.Items))
+	for i, item := range ret.Items {
+		objects[i] = ObjectInfo{
+			Key:         item.Key,
+			Size:        item.Fsize,
+			ContentType: item.MimeType,
+			ETag:        item.Hash,
+			ModTime:     time.Unix(0, item.PutTime*100),
+		}
+	}
+	if !hasNext {
+		return objects, "", nil
+	}
+	return objects, ret.Marker, nil
+}
@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"piaoji-server/internal/config"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 对象操作的签名有效期
+const s3RequestExpires = 15 * time.Minute
+
+// s3Storage S3 兼容存储（AWS S3、MinIO 等），请求使用 Signature V4 签名
+type s3Storage struct {
+	cfg      *config.S3StorageConfig
+	endpoint *url.URL
+	region   string
+	client   *http.Client
+}
+
+func newS3(cfg *config.S3StorageConfig) (*s3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3 存储缺少 endpoint 或 bucket 配置")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("无效的 S3 endpoint: %s", cfg.Endpoint)
+	}
+	return &s3Storage{
+		cfg:      cfg,
+		endpoint: endpoint,
+		region:   cfg.GetRegion(),
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (s *s3Storage) Name() string {
+	return "s3"
+}
+
+// PresignUpload 生成浏览器 POST 上传表单（POST Policy），file 字段必须放在表单最后
+func (s *s3Storage) PresignUpload(key string, maxBytes int64, expires time.Duration) (*UploadForm, error) {
+	now := time.Now().UTC()
+	date := now.Format("20060102T150405Z")
+	credential := s.credential(now)
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": now.Add(expires).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": []interface{}{
+			map[string]string{"bucket": s.cfg.Bucket},
+			map[string]string{"key": key},
+			map[string]string{"success_action_status": "200"},
+			map[string]string{"x-amz-algorithm": "AWS4-HMAC-SHA256"},
+			map[string]string{"x-amz-credential": credential},
+			map[string]string{"x-amz-date": date},
+			[]interface{}{"content-length-range", 1, maxBytes},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(policy)
+
+	return &UploadForm{
+		URL: s.bucketURL(""),
+		Fields: map[string]string{
+			"key":                   key,
+			"success_action_status": "200",
+			"policy":                encoded,
+			"x-amz-algorithm":       "AWS4-HMAC-SHA256",
+			"x-amz-credential":      credential,
+			"x-amz-date":            date,
+			"x-amz-signature":       hex.EncodeToString(hmacSHA256(s.signingKey(now), encoded)),
+		},
+	}, nil
+}
+
+func (s *s3Storage) URL(key string) string {
+	if s.cfg.PublicURL != "" {
+		return strings.TrimRight(s.cfg.PublicURL, "/") + "/" + key
+	}
+	return s.bucketURL(key)
+}
+
+func (s *s3Storage) PrivateURL(key string, expires time.Duration) (string, error) {
+	return s.presign(http.MethodGet, key, expires), nil
+}
+
+// ThumbnailURL S3 不做图片处理，返回原图地址
+func (s *s3Storage) ThumbnailURL(key string, width, height int) string {
+	return s.URL(key)
+}
+
+func (s *s3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return httpGet(ctx, s.presign(http.MethodGet, key, s3RequestExpires))
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("查询对象失败: HTTP %d", resp.StatusCode)
+	}
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &ObjectInfo{
+		Key:         key,
+		Size:        size,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		ModTime:     modTime,
+	}, nil
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.presign(http.MethodPut, key, s3RequestExpires), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("上传对象失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("上传对象失败: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Delete 逐个删除对象，S3 删除不存在的对象同样返回成功
+func (s *s3Storage) Delete(ctx context.Context, keys []string) error {
+	var failed []string
+	for _, key := range keys {
+		resp, err := s.do(ctx, http.MethodDelete, key)
+		if err != nil {
+			failed = append(failed, key)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK &&
+			resp.StatusCode != http.StatusNotFound {
+			failed = append(failed, key)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 个对象删除失败: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// List 使用 ListObjectsV2 列举对象
+func (s *s3Storage) List(ctx context.Context, prefix, marker string, limit int) ([]ObjectInfo, string, error) {
+	params := map[string]string{
+		"list-type": "2",
+		"prefix":    prefix,
+		"max-keys":  strconv.Itoa(limit),
+	}
+	if marker != "" {
+		params["start-after"] = marker
+	}
+	signed := s.presignAt(http.MethodGet, "", s3RequestExpires, time.Now().UTC(), params)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, signed, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("列举对象失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("列举对象失败: HTTP %d", resp.StatusCode)
+	}
+
+	var result struct {
+		IsTruncated bool `xml:"IsTruncated"`
+		Contents    []struct {
+			Key          string    `xml:"Key"`
+			LastModified time.Time `xml:"LastModified"`
+			ETag         string    `xml:"ETag"`
+			Size         int64     `xml:"Size"`
+		} `xml:"Contents"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", fmt.Errorf("解析对象列表失败: %w", err)
+	}
+
+	objects := make([]ObjectInfo, len(result.Contents))
+	for i, item := range result.Contents {
+		objects[i] = ObjectInfo{
+			Key:     item.Key,
+			Size:    item.Size,
+			ETag:    strings.Trim(item.ETag, `"`),
+			ModTime: item.LastModified,
+		}
+	}
+	if !result.IsTruncated || len(objects) == 0 {
+		return objects, "", nil
+	}
+	return objects, objects[len(objects)-1].Key, nil
+}
+
+// do 以预签名地址发起对象请求
+func (s *s3Storage) do(ctx context.Context, method, key string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.presign(method, key, s3RequestExpires), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(req)
+}
+
+// bucketURL 存储桶中对象的地址，key 为空时为存储桶地址
+func (s *s3Storage) bucketURL(key string) string {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket
+		if key != "" {
+			u.Path += "/" + key
+		}
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	return u.String()
+}
+
+// presign 生成查询参数签名的对象地址
+func (s *s3Storage) presign(method, key string, expires time.Duration) string {
+	return s.presignAt(method, key, expires, time.Now().UTC(), nil)
+}
+
+// presignAt 按指定时间签名，params 为请求本身的查询参数（如列举对象的 prefix）
+func (s *s3Storage) presignAt(method, key string, expires time.Duration, now time.Time, params map[string]string) string {
+	u, _ := url.Parse(s.bucketURL(key))
+	date := now.Format("20060102T150405Z")
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    s.credential(now),
+		"X-Amz-Date":          date,
+		"X-Amz-Expires":       strconv.Itoa(int(expires.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	for name, value := range params {
+		query[name] = value
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = uriEncode(name, true) + "=" + uriEncode(query[name], true)
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	path := uriEncode(u.Path, false)
+	canonicalRequest := presignCanonicalRequest(method, path, canonicalQuery, u.Host)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		date,
+		s.scope(now),
+		hex.EncodeToString(sha256Sum(canonicalRequest)),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(s.signingKey(now), stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", u.Scheme, u.Host, path, canonicalQuery, signature)
+}
+
+// presignCanonicalRequest 查询参数签名的规范请求，只签名 host 头，请求体不参与签名
+func presignCanonicalRequest(method, path, canonicalQuery, host string) string {
+	return strings.Join([]string{
+		method,
+		path,
+		canonicalQuery,
+		"host:" + host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+}
+
+func (s *s3Storage) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *s3Storage) credential(t time.Time) string {
+	return s.cfg.AccessKey + "/" + s.scope(t)
+}
+
+func (s *s3Storage) signingKey(t time.Time) []byte {
+	return deriveSigningKey(s.cfg.SecretKey, t.Format("20060102"), s.region, "s3")
+}
+
+// deriveSigningKey 按日期、区域和服务逐级派生 SigV4 签名密钥
+func deriveSigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Sum(data string) []byte {
+	sum := sha256.Sum256([]byte(data))
+	return sum[:]
+}
+
+// uriEncode 按 SigV4 规则编码：保留字母数字和 -_.~，encodeSlash 为 false 时保留 /
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
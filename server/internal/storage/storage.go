@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"piaoji-server/internal/config"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound 对象不存在
+	ErrNotFound = errors.New("对象不存在")
+	// ErrForeignURL 地址不在当前存储中
+	ErrForeignURL = errors.New("地址不在当前存储中")
+)
+
+// 缩略图尺寸
+const (
+	ThumbnailWidth  = 300
+	ThumbnailHeight = 300
+)
+
+// UploadForm 客户端直传所需的表单
+// 客户端以 multipart/form-data POST 到 URL，附带 Fields 中的全部字段，文件字段名为 file
+type UploadForm struct {
+	URL    string
+	Fields map[string]string
+}
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// Storage 对象存储
+type Storage interface {
+	// Name 驱动名称
+	Name() string
+	// PresignUpload 为 key 生成客户端直传表单，限制文件大小不超过 maxBytes
+	PresignUpload(key string, maxBytes int64, expires time.Duration) (*UploadForm, error)
+	// URL 对象的公开访问地址，key 为空时返回地址前缀
+	URL(key string) string
+	// PrivateURL 带签名的临时访问地址
+	PrivateURL(key string, expires time.Duration) (string, error)
+	// ThumbnailURL 缩略图地址，不支持图片处理的存储返回原图地址
+	ThumbnailURL(key string, width, height int) string
+	// Open 读取对象内容，调用方负责关闭
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat 查询对象信息，不存在时返回 ErrNotFound
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Put 服务端写入对象，key 已存在时覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Delete 批量删除对象，对象不存在视为删除成功
+	Delete(ctx context.Context, keys []string) error
+	// List 按 key 顺序列举 prefix 下的对象，从 marker 之后开始，最多 limit 个
+	// 返回的 next 为下一页的 marker，为空表示已列举完
+	List(ctx context.Context, prefix, marker string, limit int) (objects []ObjectInfo, next string, err error)
+}
+
+var current Storage
+
+// Init 按配置创建存储驱动
+func Init(cfg *config.Config) error {
+	var err error
+	switch cfg.Storage.GetDriver() {
+	case "qiniu":
+		current = newQiniu(&cfg.Qiniu)
+	case "local":
+		secret := cfg.Storage.Local.Secret
+		if secret == "" {
+			secret = cfg.JWT.Secret
+		}
+		current, err = newLocal(&cfg.Storage.Local, secret)
+	case "s3":
+		current, err = newS3(&cfg.Storage.S3)
+	default:
+		err = fmt.Errorf("未知的存储驱动: %s", cfg.Storage.Driver)
+	}
+	return err
+}
+
+// Current 当前使用的存储驱动
+func Current() Storage {
+	return current
+}
+
+// downloadClient 下载外部地址使用的 HTTP 客户端
+var downloadClient = &http.Client{Timeout: 60 * time.Second}
+
+// KeyFromURL 从图片 URL 中解析出对象 key
+// 仅识别当前存储地址前缀下的地址，去掉图片处理参数（如 ?imageView2/...）
+func KeyFromURL(url string) (string, bool) {
+	prefix := current.URL("")
+	if prefix == "" || !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(url, prefix)
+	if i := strings.IndexByte(key, '?'); i >= 0 {
+		key = key[:i]
+	}
+	return key, key != ""
+}
+
+// URL 拼出对象的访问地址
+func URL(key string) string {
+	return current.URL(key)
+}
+
+// ThumbnailURL 图片地址对应的缩略图地址，不在当前存储中的地址原样返回
+func ThumbnailURL(url string) string {
+	key, ok := KeyFromURL(url)
+	if !ok {
+		return url
+	}
+	return current.ThumbnailURL(key, ThumbnailWidth, ThumbnailHeight)
+}
+
+// DeleteObjects 批量删除对象，对象不存在视为删除成功
+func DeleteObjects(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return current.Delete(context.Background(), keys)
+}
+
+// OpenURL 读取当前存储中地址对应的对象，调用方负责关闭返回的 ReadCloser
+// 不在当前存储中的地址返回 ErrForeignURL，不会按地址发起下载
+func OpenURL(ctx context.Context, url string) (io.ReadCloser, error) {
+	key, ok := KeyFromURL(url)
+	if !ok {
+		return nil, ErrForeignURL
+	}
+	return current.Open(ctx, key)
+}
+
+// httpGet 下载存储驱动生成的地址内容，非 200 响应视为失败
+// 只用于驱动内部访问自身地址，不要传入用户提供的地址
+func httpGet(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,139 @@
+package tagging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"piaoji-server/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	legacyColumn  = "tags"        // 旧版票据上的 JSON 标签数组
+	backupColumn  = "tags_legacy" // 迁移完成后保留原数据的列名
+	backfillBatch = 500
+
+	// 自定义标签名在同一用户下唯一，排序规则不区分大小写，与 Key 一致
+	// 全局标签 user_id 为 NULL，不受该索引约束
+	uniqueNameIndex = "idx_tags_user_name"
+)
+
+// Backfill 将 tickets.tags 中的 JSON 标签迁移到 ticket_tags
+// 迁移完成后把旧列重命名为 tags_legacy，之后启动时不再重复执行
+func Backfill(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&model.Ticket{}, legacyColumn) {
+		return nil
+	}
+
+	type legacyRow struct {
+		ID     int64
+		UserID int64
+		Tags   []byte
+	}
+
+	var lastID int64
+	migrated := 0
+	for {
+		var rows []legacyRow
+		if err := db.Table("tickets").
+			Select("id, user_id, "+legacyColumn+" AS tags").
+			Where("id > ? AND "+legacyColumn+" IS NOT NULL AND JSON_LENGTH("+legacyColumn+") > 0", lastID).
+			Order("id ASC").Limit(backfillBatch).
+			Scan(&rows).Error; err != nil {
+			return fmt.Errorf("读取旧标签失败: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var links []model.TicketTag
+			for _, row := range rows {
+				var names []string
+				if err := json.Unmarshal(row.Tags, &names); err != nil {
+					log.Printf("[Tagging] 跳过无法解析的标签: TicketID=%d, tags=%s", row.ID, row.Tags)
+					continue
+				}
+				ids, err := Resolve(tx, row.UserID, names)
+				if err != nil {
+					return err
+				}
+				for _, name := range Normalize(names) {
+					links = append(links, model.TicketTag{TicketID: row.ID, TagID: ids[Key(name)]})
+				}
+			}
+			if len(links) == 0 {
+				return nil
+			}
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&links, queryBatchSize).Error
+		})
+		if err != nil {
+			return fmt.Errorf("迁移标签失败: %w", err)
+		}
+		migrated += len(rows)
+	}
+
+	// 全量重新统计使用次数
+	if err := db.Model(&model.Tag{}).Where("1 = 1").UpdateColumn("usage_count", usageCountExpr()).Error; err != nil {
+		return fmt.Errorf("统计标签使用次数失败: %w", err)
+	}
+
+	if err := migrator.RenameColumn(&model.Ticket{}, legacyColumn, backupColumn); err != nil {
+		return fmt.Errorf("重命名旧标签列失败: %w", err)
+	}
+
+	log.Printf("[Tagging] 已迁移 %d 张票据的标签到 ticket_tags", migrated)
+	return nil
+}
+
+// EnsureUniqueNames 合并同一用户下仅大小写不同的自定义标签（保留最早创建的一个），然后创建唯一索引
+// 索引已存在时跳过
+func EnsureUniqueNames(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if migrator.HasIndex(&model.Tag{}, uniqueNameIndex) {
+		return nil
+	}
+
+	var tags []model.Tag
+	if err := db.Select("id", "user_id", "name").
+		Where("type = ? AND user_id IS NOT NULL", model.TagTypeCustom).
+		Order("id ASC").Find(&tags).Error; err != nil {
+		return fmt.Errorf("读取自定义标签失败: %w", err)
+	}
+
+	type groupKey struct {
+		userID int64
+		name   string
+	}
+	targets := make(map[groupKey]int64, len(tags))
+	sources := make(map[int64][]int64)
+	for _, tag := range tags {
+		k := groupKey{*tag.UserID, Key(tag.Name)}
+		if target, ok := targets[k]; ok {
+			sources[target] = append(sources[target], tag.ID)
+			continue
+		}
+		targets[k] = tag.ID
+	}
+
+	for target, ids := range sources {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := Merge(tx, target, ids)
+			return err
+		}); err != nil {
+			return fmt.Errorf("合并重名标签失败: %w", err)
+		}
+	}
+	if len(sources) > 0 {
+		log.Printf("[Tagging] 已合并 %d 组仅大小写不同的重名标签", len(sources))
+	}
+
+	if err := db.Exec("CREATE UNIQUE INDEX " + uniqueNameIndex + " ON tags (user_id, name)").Error; err != nil {
+		return fmt.Errorf("创建标签名唯一索引失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package tagging
+
+import (
+	"fmt"
+	"piaoji-server/internal/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 按 ID 批量查询时每批的数量
+const queryBatchSize = 1000
+
+// DefaultColor 自动创建的自定义标签颜色
+const DefaultColor = "#07c160"
+
+// Normalize 去掉首尾空白、空名称和重复名称（不区分大小写，保留先出现的写法），保持原顺序
+func Normalize(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[Key(name)] {
+			continue
+		}
+		seen[Key(name)] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+// Key 标签名的比较键，与数据库排序规则一致不区分大小写
+func Key(name string) string {
+	return strings.ToLower(name)
+}
+
+// Lookup 查询用户可用的同名标签（全局标签或自己的自定义标签），返回 Key(名称) -> 标签
+func Lookup(tx *gorm.DB, userID int64, names []string) (map[string]model.Tag, error) {
+	result := make(map[string]model.Tag, len(names))
+	if len(names) == 0 {
+		return result, nil
+	}
+	var tags []model.Tag
+	if err := tx.Where("name IN ? AND (type = ? OR user_id = ?)", names, model.TagTypeGlobal, userID).
+		Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		// 同名时优先用户自己的标签
+		if existing, ok := result[Key(tag.Name)]; ok && existing.Type == model.TagTypeCustom {
+			continue
+		}
+		result[Key(tag.Name)] = tag
+	}
+	return result, nil
+}
+
+// Resolve 将标签名解析为标签 ID（Key(名称) -> ID），不存在的名称自动创建为自定义标签
+func Resolve(tx *gorm.DB, userID int64, names []string) (map[string]int64, error) {
+	names = Normalize(names)
+	found, err := Lookup(tx, userID, names)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64, len(names))
+	var missing []model.Tag
+	for _, name := range names {
+		if tag, ok := found[Key(name)]; ok {
+			ids[Key(name)] = tag.ID
+			continue
+		}
+		missing = append(missing, model.Tag{Name: name, Type: model.TagTypeCustom, UserID: &userID, Color: DefaultColor})
+	}
+	if len(missing) > 0 {
+		// 并发请求可能同时创建同名标签，唯一索引冲突时跳过，再用加锁读取查到对方提交的标签
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+			return nil, err
+		}
+		missingNames := make([]string, len(missing))
+		for i, tag := range missing {
+			missingNames[i] = tag.Name
+		}
+		created, err := Lookup(tx.Clauses(clause.Locking{Strength: "SHARE"}), userID, missingNames)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range missingNames {
+			tag, ok := created[Key(name)]
+			if !ok {
+				return nil, fmt.Errorf("创建标签失败: %s", name)
+			}
+			ids[Key(name)] = tag.ID
+		}
+	}
+	return ids, nil
+}
+
+// Attach 为新建的票据写入标签关联（使用各票据 Tags 中的名称），并刷新使用次数
+func Attach(tx *gorm.DB, userID int64, tickets []model.Ticket) error {
+	var names []string
+	for _, t := range tickets {
+		names = append(names, t.Tags...)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	ids, err := Resolve(tx, userID, names)
+	if err != nil {
+		return err
+	}
+
+	var links []model.TicketTag
+	tagIDs := make(map[int64]bool)
+	for _, t := range tickets {
+		for _, name := range Normalize(t.Tags) {
+			links = append(links, model.TicketTag{TicketID: t.ID, TagID: ids[Key(name)]})
+			tagIDs[ids[Key(name)]] = true
+		}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&links, queryBatchSize).Error; err != nil {
+		return err
+	}
+	return RefreshUsage(tx, keys(tagIDs))
+}
+
+// Set 将票据的启用标签替换为 names，停用标签的关联保持不变，返回替换后的标签名称
+func Set(tx *gorm.DB, userID, ticketID int64, names []string) ([]string, error) {
+	names = Normalize(names)
+	ids, err := Resolve(tx, userID, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldIDs []int64
+	if err := tx.Model(&model.TicketTag{}).Where("ticket_id = ?", ticketID).Pluck("tag_id", &oldIDs).Error; err != nil {
+		return nil, err
+	}
+
+	keep := make([]int64, 0, len(ids))
+	links := make([]model.TicketTag, 0, len(ids))
+	for _, name := range names {
+		keep = append(keep, ids[Key(name)])
+		links = append(links, model.TicketTag{TicketID: ticketID, TagID: ids[Key(name)]})
+	}
+
+	// 停用的标签不在票据中返回，客户端提交时不会带上，保留这些关联以便重新启用后恢复
+	active := tx.Model(&model.Tag{}).Select("id").Where("is_active = ?", true)
+	del := tx.Where("ticket_id = ? AND tag_id IN (?)", ticketID, active)
+	if len(keep) > 0 {
+		del = del.Where("tag_id NOT IN ?", keep)
+	}
+	if err := del.Delete(&model.TicketTag{}).Error; err != nil {
+		return nil, err
+	}
+	if len(links) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := RefreshUsage(tx, append(oldIDs, keep...)); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// Add 为多张票据追加标签
+func Add(tx *gorm.DB, userID int64, ticketIDs []int64, names []string) error {
+	ids, err := Resolve(tx, userID, names)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	links := make([]model.TicketTag, 0, len(ticketIDs)*len(ids))
+	for _, ticketID := range ticketIDs {
+		for _, tagID := range ids {
+			links = append(links, model.TicketTag{TicketID: ticketID, TagID: tagID})
+		}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&links, queryBatchSize).Error; err != nil {
+		return err
+	}
+	return RefreshUsage(tx, values(ids))
+}
+
+// CountAfterAdd 为票据追加 names 后各票据的标签数，用于检查数量上限
+// 按标签 ID 计数，包括停用标签的关联（停用的标签不在票据中返回，但仍占用名额）
+func CountAfterAdd(tx *gorm.DB, userID int64, ticketIDs []int64, names []string) (map[int64]int, error) {
+	names = Normalize(names)
+	found, err := Lookup(tx, userID, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []model.TicketTag
+	if err := tx.Select("ticket_id", "tag_id").Where("ticket_id IN ?", ticketIDs).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	linked := make(map[int64]map[int64]bool, len(ticketIDs))
+	for _, id := range ticketIDs {
+		linked[id] = map[int64]bool{}
+	}
+	for _, l := range links {
+		linked[l.TicketID][l.TagID] = true
+	}
+
+	counts := make(map[int64]int, len(ticketIDs))
+	for _, id := range ticketIDs {
+		n := len(linked[id])
+		for _, name := range names {
+			// 不存在的名称会新建标签，一定是新增的
+			if tag, ok := found[Key(name)]; !ok || !linked[id][tag.ID] {
+				n++
+			}
+		}
+		counts[id] = n
+	}
+	return counts, nil
+}
+
+// Remove 从多张票据移除标签，不存在的标签名忽略
+func Remove(tx *gorm.DB, userID int64, ticketIDs []int64, names []string) error {
+	found, err := Lookup(tx, userID, Normalize(names))
+	if err != nil || len(found) == 0 {
+		return err
+	}
+
+	tagIDs := make([]int64, 0, len(found))
+	for _, tag := range found {
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	if err := tx.Where("ticket_id IN ? AND tag_id IN ?", ticketIDs, tagIDs).
+		Delete(&model.TicketTag{}).Error; err != nil {
+		return err
+	}
+	return RefreshUsage(tx, tagIDs)
+}
+
+// RefreshUsage 重新统计标签的使用次数（关联的未删除票据数）
+func RefreshUsage(tx *gorm.DB, tagIDs []int64) error {
+	tagIDs = unique(tagIDs)
+	for start := 0; start < len(tagIDs); start += queryBatchSize {
+		end := min(start+queryBatchSize, len(tagIDs))
+		if err := tx.Model(&model.Tag{}).Where("id IN ?", tagIDs[start:end]).
+			UpdateColumn("usage_count", usageCountExpr()).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usageCountExpr 统计单个标签关联的未删除票据数
+func usageCountExpr() clause.Expr {
+	return gorm.Expr("(SELECT COUNT(*) FROM ticket_tags tt JOIN tickets t ON t.id = tt.ticket_id "+
+		"WHERE tt.tag_id = tags.id AND t.is_deleted = ?)", false)
+}
+
+// RefreshTicketUsage 票据移入/移出回收站后，刷新其标签的使用次数
+func RefreshTicketUsage(tx *gorm.DB, ticketIDs []int64) error {
+	if len(ticketIDs) == 0 {
+		return nil
+	}
+	var tagIDs []int64
+	if err := tx.Model(&model.TicketTag{}).Where("ticket_id IN ?", ticketIDs).
+		Distinct().Pluck("tag_id", &tagIDs).Error; err != nil {
+		return err
+	}
+	return RefreshUsage(tx, tagIDs)
+}
+
+// Fill 为票据填充标签名称，停用的标签不返回
+func Fill(db *gorm.DB, tickets []model.Ticket) error {
+	if len(tickets) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(tickets))
+	for i, t := range tickets {
+		ids[i] = t.ID
+	}
+
+	type row struct {
+		TicketID int64
+		Name     string
+	}
+	names := make(map[int64][]string, len(tickets))
+	for start := 0; start < len(ids); start += queryBatchSize {
+		end := min(start+queryBatchSize, len(ids))
+		var rows []row
+		if err := db.Table("ticket_tags AS tt").
+			Select("tt.ticket_id, tg.name").
+			Joins("JOIN tags tg ON tg.id = tt.tag_id").
+			Where("tt.ticket_id IN ? AND tg.is_active = ?", ids[start:end], true).
+			Order("tt.ticket_id, tt.created_at, tg.id").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, r := range rows {
+			names[r.TicketID] = append(names[r.TicketID], r.Name)
+		}
+	}
+
+	for i := range tickets {
+		tickets[i].Tags = names[tickets[i].ID]
+		if tickets[i].Tags == nil {
+			tickets[i].Tags = []string{}
+		}
+	}
+	return nil
+}
+
+// FillOne 为单张票据填充标签名称
+func FillOne(db *gorm.DB, ticket *model.Ticket) error {
+	tickets := []model.Ticket{*ticket}
+	if err := Fill(db, tickets); err != nil {
+		return err
+	}
+	ticket.Tags = tickets[0].Tags
+	return nil
+}
+
+func unique(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func keys(m map[int64]bool) []int64 {
+	result := make([]int64, 0, len(m))
+	for id := range m {
+		result = append(result, id)
+	}
+	return result
+}
+
+func values(m map[string]int64) []int64 {
+	result := make([]int64, 0, len(m))
+	for _, id := range m {
+		result = append(result, id)
+	}
+	return result
+}
+
+// Touch 更新带有这些标签的票据的 updated_at，便于客户端增量同步，返回涉及的票据数
+func Touch(tx *gorm.DB, tagIDs []int64) (int64, error) {
+	if len(tagIDs) == 0 {
+		return 0, nil
+	}
+	linked := tx.Model(&model.TicketTag{}).Select("ticket_id").Where("tag_id IN ?", tagIDs)
+
+	var count int64
+	if err := tx.Model(&model.Ticket{}).Where("id IN (?)", linked).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	err := tx.Model(&model.Ticket{}).Where("id IN (?)", linked).UpdateColumn("updated_at", time.Now()).Error
+	return count, err
+}
+
+// Merge 将 sourceIDs 标签合并到 targetID：票据改为关联目标标签，然后删除源标签
+// 返回涉及的票据数
+func Merge(tx *gorm.DB, targetID int64, sourceIDs []int64) (int64, error) {
+	sourceIDs = unique(sourceIDs)
+	if len(sourceIDs) == 0 {
+		return 0, nil
+	}
+
+	touched, err := Touch(tx, sourceIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	// 已带有目标标签的票据由 IGNORE 跳过
+	if err := tx.Exec(
+		"INSERT IGNORE INTO ticket_tags (ticket_id, tag_id, created_at) "+
+			"SELECT ticket_id, ?, MIN(created_at) FROM ticket_tags WHERE tag_id IN ? GROUP BY ticket_id",
+		targetID, sourceIDs,
+	).Error; err != nil {
+		return 0, err
+	}
+
+	// 源标签的子标签移到源标签的父标签下，关联由外键级联删除
+	if err := Detach(tx, sourceIDs); err != nil {
+		return 0, err
+	}
+	if err := tx.Where("id IN ?", sourceIDs).Delete(&model.Tag{}).Error; err != nil {
+		return 0, err
+	}
+	return touched, RefreshUsage(tx, []int64{targetID})
+}
@@ -0,0 +1,138 @@
+package tagging
+
+import (
+	"fmt"
+	"os"
+	"piaoji-server/internal/model"
+	"sort"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB 连接 PIAOJI_TEST_DSN 指定的 MySQL 测试库，未设置时跳过
+// 如 PIAOJI_TEST_DSN="root:pass@tcp(127.0.0.1:3306)/piaoji_test?charset=utf8mb4&parseTime=True&loc=Local"
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("PIAOJI_TEST_DSN")
+	if dsn == "" {
+		t.Skip("未设置 PIAOJI_TEST_DSN，跳过需要 MySQL 的测试")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接测试库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Ticket{}, &model.Tag{}, &model.TicketTag{}); err != nil {
+		t.Fatalf("迁移测试库失败: %v", err)
+	}
+	if err := EnsureUniqueNames(db); err != nil {
+		t.Fatalf("创建标签名唯一索引失败: %v", err)
+	}
+	return db
+}
+
+// testTicket 为一个不会与其他数据冲突的用户创建票据和标签，测试结束后删除
+func testTicket(t *testing.T, db *gorm.DB, tags ...model.Tag) (model.Ticket, []model.Tag) {
+	t.Helper()
+	userID := time.Now().UnixNano() % 1e15
+	ticket := model.Ticket{
+		TicketClientID: fmt.Sprintf("tagging-test-%d", userID),
+		UserID:         userID,
+		Name:           "测试票据",
+		Type:           model.TicketTypeMovie,
+		SortTime:       time.Now(),
+	}
+	if err := db.Create(&ticket).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := range tags {
+		tags[i].Type = model.TagTypeCustom
+		tags[i].UserID = &userID
+		tags[i].Color = DefaultColor
+		if err := db.Create(&tags[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		// is_active 默认为 true，false 需要单独更新
+		if !tags[i].IsActive {
+			db.Model(&tags[i]).Update("is_active", false)
+		}
+	}
+	t.Cleanup(func() {
+		db.Delete(&ticket)
+		db.Where("user_id = ?", userID).Delete(&model.Tag{})
+	})
+	return ticket, tags
+}
+
+func linkedTagIDs(t *testing.T, db *gorm.DB, ticketID int64) []int64 {
+	t.Helper()
+	var ids []int64
+	if err := db.Model(&model.TicketTag{}).Where("ticket_id = ?", ticketID).Pluck("tag_id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestSetKeepsInactiveLinks(t *testing.T) {
+	db := testDB(t)
+	ticket, tags := testTicket(t, db,
+		model.Tag{Name: "电影", IsActive: true},
+		model.Tag{Name: "约会", IsActive: true},
+		model.Tag{Name: "已停用", IsActive: false},
+	)
+	movie, date, inactive := tags[0], tags[1], tags[2]
+	for _, tag := range tags {
+		if err := db.Create(&model.TicketTag{TicketID: ticket.ID, TagID: tag.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 客户端看不到停用的标签，更新时只提交启用的标签
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := Set(tx, ticket.UserID, ticket.ID, []string{movie.Name})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Set 失败: %v", err)
+	}
+
+	got := linkedTagIDs(t, db, ticket.ID)
+	want := []int64{movie.ID, inactive.ID}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("更新后的关联 = %v, 期望 %v（%s 已移除，停用的 %s 保留）", got, want, date.Name, inactive.Name)
+	}
+}
+
+// dryRunDB 不连接数据库，只生成 SQL
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:3306)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSetDeletesOnlyActiveLinks(t *testing.T) {
+	db := dryRunDB(t)
+	var deletes []string
+	db.Callback().Delete().After("gorm:delete").Register("test:capture", func(d *gorm.DB) {
+		deletes = append(deletes, d.Dialector.Explain(d.Statement.SQL.String(), d.Statement.Vars...))
+	})
+
+	// 清空标签：只删除启用标签的关联
+	if _, err := Set(db, 1, 2, nil); err != nil {
+		t.Fatalf("Set 失败: %v", err)
+	}
+	want := "DELETE FROM `ticket_tags` WHERE ticket_id = 2 AND tag_id IN (SELECT `id` FROM `tags` WHERE is_active = true)"
+	if len(deletes) != 1 || deletes[0] != want {
+		t.Errorf("删除语句 = %q\n期望 %q", deletes, want)
+	}
+}
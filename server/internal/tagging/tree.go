@@ -0,0 +1,191 @@
+package tagging
+
+import (
+	"errors"
+	"fmt"
+	"piaoji-server/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrParentNotFound 父标签不存在或不是自己的自定义标签
+	ErrParentNotFound = errors.New("父标签不存在")
+	// ErrParentCycle 父标签是自身或自己的子孙标签
+	ErrParentCycle = errors.New("不能移动到自身或子标签下")
+	// ErrTooDeep 超过标签树最大层数
+	ErrTooDeep = fmt.Errorf("标签最多 %d 层", model.MaxTagDepth)
+)
+
+// Available 查询用户可用的全部标签（全局标签和自己的自定义标签）
+func Available(db *gorm.DB, userID int64) ([]model.Tag, error) {
+	var tags []model.Tag
+	err := db.Where("type = ? OR user_id = ?", model.TagTypeGlobal, userID).
+		Order("type ASC, sort ASC, usage_count DESC, id ASC").
+		Find(&tags).Error
+	return tags, err
+}
+
+// Tree 按 parent_id 把标签组织成树，返回根节点，同级保持输入顺序
+// 父标签不在 tags 中的视为根节点
+func Tree(tags []model.Tag) []model.Tag {
+	index := make(map[int64]int, len(tags))
+	for i, tag := range tags {
+		index[tag.ID] = i
+	}
+	children := make(map[int64][]int, len(tags))
+	var roots []int
+	for i, tag := range tags {
+		if tag.ParentID != nil {
+			if _, ok := index[*tag.ParentID]; ok {
+				children[*tag.ParentID] = append(children[*tag.ParentID], i)
+				continue
+			}
+		}
+		roots = append(roots, i)
+	}
+
+	var build func(i, depth int) model.Tag
+	build = func(i, depth int) model.Tag {
+		tag := tags[i]
+		tag.Children = nil
+		// 数据异常形成环时不会无限递归
+		if depth >= model.MaxTagDepth*2 {
+			return tag
+		}
+		for _, child := range children[tag.ID] {
+			tag.Children = append(tag.Children, build(child, depth+1))
+		}
+		return tag
+	}
+
+	result := make([]model.Tag, 0, len(roots))
+	for _, i := range roots {
+		result = append(result, build(i, 0))
+	}
+	return result
+}
+
+// Descendants 返回 ids 中各标签及其所有子孙标签的 ID
+func Descendants(tags []model.Tag, ids []int64) []int64 {
+	children := childIDs(tags)
+
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	queue := append([]int64(nil), ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+		queue = append(queue, children[id]...)
+	}
+	return result
+}
+
+// Expand 将标签名展开为同名标签及其所有子孙标签的 ID，用于按父标签筛选票据
+// 找不到的名称对应空切片
+func Expand(db *gorm.DB, userID int64, names []string) (map[string][]int64, error) {
+	tags, err := Available(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]int64, len(names))
+	for _, tag := range tags {
+		byName[Key(tag.Name)] = append(byName[Key(tag.Name)], tag.ID)
+	}
+	result := make(map[string][]int64, len(names))
+	for _, name := range names {
+		result[name] = Descendants(tags, byName[Key(name)])
+	}
+	return result, nil
+}
+
+// CheckParent 检查 parentID 能否作为标签 tagID 的父标签，tagID 为 0 表示新建标签
+// 父标签必须是用户自己的自定义标签，不能形成环，且移动后不超过最大层数
+func CheckParent(db *gorm.DB, userID, tagID, parentID int64) error {
+	var tags []model.Tag
+	if err := db.Select("id, parent_id").
+		Where("type = ? AND user_id = ?", model.TagTypeCustom, userID).
+		Find(&tags).Error; err != nil {
+		return err
+	}
+
+	parents := make(map[int64]*int64, len(tags))
+	for _, tag := range tags {
+		parents[tag.ID] = tag.ParentID
+	}
+	if _, ok := parents[parentID]; !ok {
+		return ErrParentNotFound
+	}
+
+	// 父标签所在层数，同时检查是否挂到自己的子孙下
+	depth := 0
+	for id := &parentID; id != nil; id = parents[*id] {
+		if *id == tagID {
+			return ErrParentCycle
+		}
+		depth++
+		if depth > model.MaxTagDepth {
+			break
+		}
+	}
+
+	// 移动已有标签时，它的子树整体下移
+	height := 1
+	if tagID != 0 {
+		height = subtreeHeight(tags, tagID)
+	}
+	if depth+height > model.MaxTagDepth {
+		return ErrTooDeep
+	}
+	return nil
+}
+
+// subtreeHeight 以 id 为根的子树层数
+func subtreeHeight(tags []model.Tag, id int64) int {
+	children := childIDs(tags)
+
+	height := 0
+	level := []int64{id}
+	for len(level) > 0 && height <= model.MaxTagDepth {
+		height++
+		var next []int64
+		for _, tagID := range level {
+			next = append(next, children[tagID]...)
+		}
+		level = next
+	}
+	return height
+}
+
+// childIDs 父标签 ID -> 子标签 ID
+func childIDs(tags []model.Tag) map[int64][]int64 {
+	children := make(map[int64][]int64, len(tags))
+	for _, tag := range tags {
+		if tag.ParentID != nil {
+			children[*tag.ParentID] = append(children[*tag.ParentID], tag.ID)
+		}
+	}
+	return children
+}
+
+// Detach 删除标签前把它的子标签移到它的父标签下
+func Detach(tx *gorm.DB, tagIDs []int64) error {
+	// 逐个处理并重新读取父标签，被删除的标签之间有父子关系时也不会留下悬空引用
+	for _, id := range tagIDs {
+		var tag model.Tag
+		if err := tx.Select("id, parent_id").First(&tag, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Tag{}).Where("parent_id = ?", id).
+			Update("parent_id", tag.ParentID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
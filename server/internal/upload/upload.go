@@ -0,0 +1,136 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"piaoji-server/internal/imaging"
+	"piaoji-server/internal/model"
+	"piaoji-server/internal/storage"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotConfirmed 照片不是当前用户已完成的上传
+var ErrNotConfirmed = errors.New("照片未上传或不属于当前用户")
+
+// KeyPrefix 用户上传照片的 key 前缀
+func KeyPrefix(userID int64) string {
+	return model.UploadKeyPrefix(userID)
+}
+
+// Owner 从 key（tickets/<userID>/...）中解析上传用户
+// key 包含在上传凭证中并经过签名，可以作为归属依据
+func Owner(key string) (int64, bool) {
+	rest, ok := strings.CutPrefix(key, "tickets/")
+	if !ok {
+		return 0, false
+	}
+	id, _, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(id, 10, 64)
+	return userID, err == nil && userID > 0
+}
+
+// Record 记录完成的上传，同一 key 重复回调时忽略
+// 启用图片处理时新记录进入处理队列
+func Record(db *gorm.DB, u *model.Upload) error {
+	if imaging.Enabled() {
+		u.ImageStatus = model.ImageStatusPending
+	}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(u)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 && u.ImageStatus == model.ImageStatusPending {
+		imaging.Submit(u.ID)
+	}
+	return nil
+}
+
+// Confirm 确认照片地址都是 userID 已完成的上传，并补记存储中存在但还没有记录的上传
+func Confirm(ctx context.Context, db *gorm.DB, userID int64, urls []string) error {
+	missing, err := Check(ctx, db, userID, urls)
+	if err != nil {
+		return err
+	}
+	return RecordAll(db, missing)
+}
+
+// Check 确认照片地址都是 userID 已完成的上传（包括图片处理去除元数据后的新地址），不写入数据库
+// 配置了回调的七牛云上传完成时一定有回调记录，没有记录即拒绝；其他存储没有回调，没有记录时查询存储中的对象，
+// 存在则作为待补记的上传返回，由调用方通过 RecordAll 写入。对象不存在或格式无法处理则拒绝
+func Check(ctx context.Context, db *gorm.DB, userID int64, urls []string) ([]model.Upload, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(urls))
+	for _, url := range urls {
+		key, ok := storage.KeyFromURL(url)
+		if !ok || !strings.HasPrefix(key, KeyPrefix(userID)) {
+			return nil, fmt.Errorf("%w: %s", ErrNotConfirmed, url)
+		}
+		keys = append(keys, key)
+	}
+
+	var recorded []model.Upload
+	if err := db.Select("object_key", "stripped_key", "image_status").
+		Where("user_id = ? AND (object_key IN ? OR stripped_key IN ?)", userID, keys, keys).
+		Find(&recorded).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(recorded))
+	for _, u := range recorded {
+		if u.ImageStatus == model.ImageStatusRejected {
+			return nil, fmt.Errorf("%w: %s（不支持的图片格式）", ErrNotConfirmed, storage.URL(u.Key))
+		}
+		done[u.Key] = true
+		if u.StrippedKey != "" {
+			done[u.StrippedKey] = true
+		}
+	}
+
+	// 回调记录是七牛云上传完成的唯一依据，对象存在但没有回调（如回调签名校验失败）也不接受
+	q, ok := storage.Qiniu()
+	callback := ok && q.HasCallback()
+	var missing []model.Upload
+	for _, key := range keys {
+		if done[key] {
+			continue
+		}
+		if callback {
+			return nil, fmt.Errorf("%w: %s", ErrNotConfirmed, storage.URL(key))
+		}
+		info, err := storage.Current().Stat(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotConfirmed, storage.URL(key))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("查询上传文件失败: %w", err)
+		}
+		missing = append(missing, model.Upload{
+			UserID: userID,
+			Key:    key,
+			Hash:   info.ETag,
+			Fsize:  info.Size,
+			Mime:   info.ContentType,
+		})
+	}
+	return missing, nil
+}
+
+// RecordAll 补记 Check 返回的上传
+func RecordAll(db *gorm.DB, uploads []model.Upload) error {
+	for i := range uploads {
+		if err := Record(db, &uploads[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
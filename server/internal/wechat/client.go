@@ -0,0 +1,256 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"piaoji-server/internal/config"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenRefreshAhead access_token 过期前提前刷新的时间
+	tokenRefreshAhead = 5 * time.Minute
+	// maxResponseBytes 微信接口响应的最大长度
+	maxResponseBytes = 1 << 20
+	// retryBackoff 第一次重试前的等待时间，之后每次翻倍
+	retryBackoff = 200 * time.Millisecond
+)
+
+// Client 小程序服务端接口客户端，进程内缓存 access_token
+type Client struct {
+	appID       string
+	secret      string
+	baseURL     string
+	timeout     time.Duration // 单次请求超时
+	maxAttempts int
+	http        *http.Client
+
+	mu           sync.Mutex // 保护下面的字段，并保证同一时间只有一个请求在获取 access_token
+	token        string
+	expiresAt    time.Time
+	forceRefresh bool // 微信返回 token 失效时，下次获取强制刷新
+}
+
+var defaultClient *Client
+
+// Init 按配置创建默认客户端
+func Init(cfg *config.WechatConfig) {
+	defaultClient = New(cfg)
+}
+
+// Default 默认客户端，未调用 Init 时按当前配置创建
+func Default() *Client {
+	if defaultClient == nil {
+		Init(&config.Cfg.Wechat)
+	}
+	return defaultClient
+}
+
+// New 按配置创建客户端
+func New(cfg *config.WechatConfig) *Client {
+	return &Client{
+		appID:       cfg.AppID,
+		secret:      cfg.Secret,
+		baseURL:     cfg.GetBaseURL(),
+		timeout:     cfg.GetTimeout(),
+		maxAttempts: cfg.GetMaxAttempts(),
+		http:        &http.Client{},
+	}
+}
+
+// Session code2Session 的结果
+type Session struct {
+	OpenID     string `json:"openid"`
+	SessionKey string `json:"session_key"`
+	UnionID    string `json:"unionid"`
+}
+
+// Code2Session 用 wx.login 的 code 换取 openid、session_key 和 unionid
+// code 只能使用一次：网络错误重试时如果上一次请求其实已到达微信，会得到 code 已被使用的错误
+func (c *Client) Code2Session(ctx context.Context, code string) (*Session, error) {
+	var resp Session
+	query := url.Values{
+		"appid":      {c.appID},
+		"secret":     {c.secret},
+		"js_code":    {code},
+		"grant_type": {"authorization_code"},
+	}
+	if err := c.call(ctx, http.MethodGet, "/sns/jscode2session", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.OpenID == "" || resp.SessionKey == "" {
+		return nil, errors.New("微信未返回 openid 或 session_key")
+	}
+	return &resp, nil
+}
+
+// AccessToken 获取接口调用凭证，过期前自动刷新
+// 使用稳定版接口（stable_token），多个实例各自获取不会使对方的 token 失效
+func (c *Client) AccessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && !c.forceRefresh && time.Now().Before(c.expiresAt.Add(-tokenRefreshAhead)) {
+		return c.token, nil
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	body := map[string]interface{}{
+		"grant_type":    "client_credential",
+		"appid":         c.appID,
+		"secret":        c.secret,
+		"force_refresh": c.forceRefresh,
+	}
+	if err := c.call(ctx, http.MethodPost, "/cgi-bin/stable_token", nil, body, &resp); err != nil {
+		return "", err
+	}
+	if resp.AccessToken == "" {
+		return "", errors.New("微信未返回 access_token")
+	}
+	c.token = resp.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	c.forceRefresh = false
+	return c.token, nil
+}
+
+// invalidate 微信返回 token 失效时丢弃缓存；其他请求已刷新过时不重复刷新
+func (c *Client) invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+		c.forceRefresh = true
+	}
+}
+
+// PhoneInfo 用户手机号
+type PhoneInfo struct {
+	PhoneNumber     string `json:"phoneNumber"`     // 带区号的手机号（国内不带区号）
+	PurePhoneNumber string `json:"purePhoneNumber"` // 不带区号的手机号
+	CountryCode     string `json:"countryCode"`
+	Watermark       struct {
+		Timestamp int64  `json:"timestamp"`
+		AppID     string `json:"appid"`
+	} `json:"watermark"`
+}
+
+// GetPhoneNumber 用 getPhoneNumber 按钮返回的 code 换取用户手机号
+func (c *Client) GetPhoneNumber(ctx context.Context, code string) (*PhoneInfo, error) {
+	var resp struct {
+		PhoneInfo PhoneInfo `json:"phone_info"`
+	}
+	if err := c.callWithToken(ctx, "/wxa/business/getuserphonenumber", map[string]string{"code": code}, &resp); err != nil {
+		return nil, err
+	}
+	if appID := resp.PhoneInfo.Watermark.AppID; appID != "" && appID != c.appID {
+		return nil, errors.New("手机号数据不属于当前小程序")
+	}
+	return &resp.PhoneInfo, nil
+}
+
+// callWithToken 调用需要 access_token 的 POST 接口，token 失效时刷新后重试一次
+func (c *Client) callWithToken(ctx context.Context, path string, body, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		token, err := c.AccessToken(ctx)
+		if err != nil {
+			return err
+		}
+		err = c.call(ctx, http.MethodPost, path, url.Values{"access_token": {token}}, body, out)
+		var e *Error
+		if attempt == 0 && errors.As(err, &e) && (e.Code == codeInvalidToken || e.Code == codeTokenExpired) {
+			c.invalidate(token)
+			continue
+		}
+		return err
+	}
+}
+
+// call 发送请求，网络错误、HTTP 5xx 和系统繁忙时按指数退避重试
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.do(ctx, method, path, query, body, out)
+		if err == nil || !retryable(err) || attempt >= c.maxAttempts {
+			return err
+		}
+		log.Printf("[Wechat] 请求 %s 失败，%v 后第 %d 次重试: %v", path, backoff, attempt, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// do 发送一次请求并解析 JSON 响应，body 不为 nil 时以 JSON 发送
+// 网络错误和 HTTP 错误包装为 ErrUnavailable，errcode 不为 0 时返回 *Error
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// 错误信息中的 URL 带有 secret，只保留底层错误
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%w: HTTP %d", ErrUnavailable, resp.StatusCode)
+		}
+		return fmt.Errorf("请求微信接口失败: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("%w: 读取响应失败: %v", ErrUnavailable, err)
+	}
+	var apiErr apiError
+	if err := json.Unmarshal(data, &apiErr); err != nil {
+		return fmt.Errorf("解析微信接口响应失败: %w", err)
+	}
+	if err := apiErr.err(); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析微信接口响应失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"piaoji-server/internal/config"
+	"sync"
+	"testing"
+)
+
+// fakeWechat 模拟微信接口，记录每个接口被调用的次数
+type fakeWechat struct {
+	t *testing.T
+
+	mu           sync.Mutex
+	calls        map[string]int
+	tokens       int    // 已签发的 access_token 数
+	forceRefresh []bool // 每次 stable_token 请求中的 force_refresh
+	expiresIn    int64
+
+	// 按路径返回的响应，参数为该路径第几次被调用（从 1 开始）和请求中的 access_token
+	handlers map[string]func(n int, token string) interface{}
+}
+
+func newFakeWechat(t *testing.T) (*fakeWechat, *Client) {
+	t.Helper()
+	f := &fakeWechat{t: t, calls: map[string]int{}, expiresIn: 7200, handlers: map[string]func(int, string) interface{}{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	c := New(&config.WechatConfig{
+		AppID:   "wx-test",
+		Secret:  "secret",
+		BaseURL: srv.URL,
+		Timeout: "1s",
+	})
+	return f, c
+}
+
+func (f *fakeWechat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.calls[r.URL.Path]++
+	n := f.calls[r.URL.Path]
+
+	var resp interface{}
+	if r.URL.Path == "/cgi-bin/stable_token" {
+		var body struct {
+			GrantType    string `json:"grant_type"`
+			AppID        string `json:"appid"`
+			ForceRefresh bool   `json:"force_refresh"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.GrantType != "client_credential" || body.AppID != "wx-test" {
+			f.t.Errorf("stable_token 请求体不正确: %+v, err=%v", body, err)
+		}
+		f.forceRefresh = append(f.forceRefresh, body.ForceRefresh)
+		f.tokens++
+		resp = map[string]interface{}{"access_token": fmt.Sprintf("token-%d", f.tokens), "expires_in": f.expiresIn}
+	}
+	handler := f.handlers[r.URL.Path]
+	f.mu.Unlock()
+
+	if handler != nil {
+		resp = handler(n, r.URL.Query().Get("access_token"))
+	}
+	if status, ok := resp.(int); ok {
+		w.WriteHeader(status)
+		return
+	}
+	if resp == nil {
+		f.t.Errorf("未模拟的接口: %s", r.URL.Path)
+		resp = map[string]interface{}{"errcode": 40001, "errmsg": "unexpected"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeWechat) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[path]
+}
+
+func TestAccessTokenCached(t *testing.T) {
+	f, c := newFakeWechat(t)
+	for i := 0; i < 3; i++ {
+		token, err := c.AccessToken(context.Background())
+		if err != nil {
+			t.Fatalf("获取 access_token 失败: %v", err)
+		}
+		if token != "token-1" {
+			t.Errorf("第 %d 次获取 token = %q, 期望复用 token-1", i+1, token)
+		}
+	}
+	if n := f.count("/cgi-bin/stable_token"); n != 1 {
+		t.Errorf("stable_token 调用 %d 次, 期望 1 次", n)
+	}
+}
+
+func TestAccessTokenConcurrent(t *testing.T) {
+	f, c := newFakeWechat(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.AccessToken(context.Background()); err != nil {
+				t.Errorf("获取 access_token 失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := f.count("/cgi-bin/stable_token"); n != 1 {
+		t.Errorf("并发获取时 stable_token 调用 %d 次, 期望 1 次", n)
+	}
+}
+
+func TestAccessTokenRefreshOnExpiry(t *testing.T) {
+	f, c := newFakeWechat(t)
+	// 有效期短于提前刷新的时间，每次获取都视为即将过期
+	f.expiresIn = int64(tokenRefreshAhead.Seconds()) - 1
+
+	first, err := c.AccessToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.AccessToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != "token-1" || second != "token-2" {
+		t.Errorf("token = %q, %q, 期望即将过期时刷新为 token-2", first, second)
+	}
+	if f.forceRefresh[1] {
+		t.Error("到期刷新不应强制刷新")
+	}
+}
+
+func TestCallWithTokenRefreshesInvalidToken(t *testing.T) {
+	for _, code := range []int{codeInvalidToken, codeTokenExpired} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			f, c := newFakeWechat(t)
+			f.handlers["/wxa/business/getuserphonenumber"] = func(n int, token string) interface{} {
+				if token == "token-1" {
+					return map[string]interface{}{"errcode": code, "errmsg": "access_token invalid"}
+				}
+				return map[string]interface{}{"errcode": 0, "phone_info": map[string]string{"phoneNumber": "13900000000"}}
+			}
+
+			info, err := c.GetPhoneNumber(context.Background(), "code")
+			if err != nil {
+				t.Fatalf("获取手机号失败: %v", err)
+			}
+			if info.PhoneNumber != "13900000000" {
+				t.Errorf("手机号 = %q", info.PhoneNumber)
+			}
+			if n := f.count("/cgi-bin/stable_token"); n != 2 {
+				t.Errorf("stable_token 调用 %d 次, 期望 token 失效后刷新 1 次", n)
+			}
+			if !f.forceRefresh[1] {
+				t.Error("token 失效后应强制刷新")
+			}
+			if n := f.count("/wxa/business/getuserphonenumber"); n != 2 {
+				t.Errorf("接口调用 %d 次, 期望刷新后重试 1 次", n)
+			}
+		})
+	}
+}
+
+func TestCallWithTokenRetriesOnlyOnce(t *testing.T) {
+	f, c := newFakeWechat(t)
+	f.handlers["/wxa/business/getuserphonenumber"] = func(n int, token string) interface{} {
+		return map[string]interface{}{"errcode": codeInvalidToken, "errmsg": "access_token invalid"}
+	}
+
+	_, err := c.GetPhoneNumber(context.Background(), "code")
+	var e *Error
+	if !errors.As(err, &e) || e.Code != codeInvalidToken {
+		t.Fatalf("err = %v, 期望 errcode %d", err, codeInvalidToken)
+	}
+	if n := f.count("/wxa/business/getuserphonenumber"); n != 2 {
+		t.Errorf("接口调用 %d 次, 期望 2 次", n)
+	}
+}
+
+func TestCode2SessionRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		fail  interface{} // 第一次调用的响应
+		calls int
+	}{
+		{"系统繁忙", map[string]interface{}{"errcode": codeSystemBusy, "errmsg": "system error"}, 2},
+		{"HTTP 5xx", http.StatusBadGateway, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, c := newFakeWechat(t)
+			f.handlers["/sns/jscode2session"] = func(n int, _ string) interface{} {
+				if n == 1 {
+					return tt.fail
+				}
+				return map[string]string{"openid": "openid", "session_key": "key"}
+			}
+
+			s, err := c.Code2Session(context.Background(), "code")
+			if err != nil {
+				t.Fatalf("Code2Session 失败: %v", err)
+			}
+			if s.OpenID != "openid" {
+				t.Errorf("openid = %q", s.OpenID)
+			}
+			if n := f.count("/sns/jscode2session"); n != tt.calls {
+				t.Errorf("调用 %d 次, 期望 %d 次", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestCode2SessionNoRetry(t *testing.T) {
+	for _, code := range []int{codeInvalidCode, codeCodeUsed, codeRiskyUser, codeFrequencyLimit} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			f, c := newFakeWechat(t)
+			f.handlers["/sns/jscode2session"] = func(int, string) interface{} {
+				return map[string]interface{}{"errcode": code, "errmsg": "error"}
+			}
+
+			_, err := c.Code2Session(context.Background(), "code")
+			var e *Error
+			if !errors.As(err, &e) || e.Code != code {
+				t.Fatalf("err = %v, 期望 errcode %d", err, code)
+			}
+			if n := f.count("/sns/jscode2session"); n != 1 {
+				t.Errorf("调用 %d 次, 期望不重试", n)
+			}
+		})
+	}
+}
+
+func TestCode2SessionMaxAttempts(t *testing.T) {
+	f, c := newFakeWechat(t)
+	c.maxAttempts = 2
+	f.handlers["/sns/jscode2session"] = func(int, string) interface{} {
+		return http.StatusServiceUnavailable
+	}
+
+	_, err := c.Code2Session(context.Background(), "code")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("err = %v, 期望 ErrUnavailable", err)
+	}
+	if n := f.count("/sns/jscode2session"); n != 2 {
+		t.Errorf("调用 %d 次, 期望 %d 次", n, 2)
+	}
+}
@@ -0,0 +1,118 @@
+package wechat
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// dataMaxAge 开放数据水印时间的有效期，超过视为重放
+	dataMaxAge = 10 * time.Minute
+	// dataClockSkew 允许水印时间比服务器时间超前的范围
+	dataClockSkew = time.Minute
+)
+
+var (
+	// ErrSignature rawData 签名校验失败
+	ErrSignature = errors.New("数据签名校验失败")
+	// ErrDecrypt 无法解密，通常是 session_key 已更换（用户在其他地方重新登录过）
+	ErrDecrypt = errors.New("数据解密失败，请重新登录后再试")
+	// ErrWatermark 水印中的 appid 不属于当前小程序，或数据已过期
+	ErrWatermark = errors.New("数据水印校验失败")
+)
+
+// Watermark 开放数据中的水印
+type Watermark struct {
+	AppID     string `json:"appid"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// CheckSignature 校验 wx.getUserInfo 返回的 rawData：signature = sha1(rawData + session_key)
+func CheckSignature(rawData, sessionKey, signature string) error {
+	sum := sha1.Sum([]byte(rawData + sessionKey))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(signature)) != 1 {
+		return ErrSignature
+	}
+	return nil
+}
+
+// DecryptData 解密 encryptedData 并校验水印，结果解析到 out
+func (c *Client) DecryptData(sessionKey, encryptedData, iv string, out interface{}) error {
+	return c.decryptData(sessionKey, encryptedData, iv, out, time.Now())
+}
+
+// decryptData 以 now 作为当前时间校验水印
+func (c *Client) decryptData(sessionKey, encryptedData, iv string, out interface{}, now time.Time) error {
+	plain, err := decrypt(sessionKey, encryptedData, iv)
+	if err != nil {
+		return err
+	}
+	var payload struct {
+		Watermark Watermark `json:"watermark"`
+	}
+	if err := json.Unmarshal(plain, &payload); err != nil {
+		return ErrDecrypt
+	}
+	if err := checkWatermark(payload.Watermark, c.appID, now); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(plain, out); err != nil {
+		return ErrDecrypt
+	}
+	return nil
+}
+
+// decrypt AES-128-CBC 解密，密钥和 iv 均为 Base64，填充方式为 PKCS#7
+func decrypt(sessionKey, encryptedData, iv string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil || len(key) != 16 {
+		return nil, ErrDecrypt
+	}
+	ivBytes, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(ivBytes) != aes.BlockSize {
+		return nil, ErrDecrypt
+	}
+	data, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, ErrDecrypt
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, ivBytes).CryptBlocks(plain, data)
+	return unpad(plain)
+}
+
+// unpad 去除 PKCS#7 填充
+func unpad(data []byte) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > aes.BlockSize || n > len(data) {
+		return nil, ErrDecrypt
+	}
+	if !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrDecrypt
+	}
+	return data[:len(data)-n], nil
+}
+
+// checkWatermark 水印 appid 须为当前小程序，时间在有效期内
+func checkWatermark(w Watermark, appID string, now time.Time) error {
+	if w.AppID == "" || w.AppID != appID {
+		return ErrWatermark
+	}
+	t := time.Unix(w.Timestamp, 0)
+	if t.Before(now.Add(-dataMaxAge)) || t.After(now.Add(dataClockSkew)) {
+		return ErrWatermark
+	}
+	return nil
+}
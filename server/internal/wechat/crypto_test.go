@@ -0,0 +1,119 @@
+package wechat
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 微信开放数据解密文档中的示例
+const (
+	sampleAppID         = "wx4f4bc4dec97d474b"
+	sampleSessionKey    = "tiihtNczf5v6AKRyjwEUhQ=="
+	sampleIV            = "r7BXXKkLb8qrSNn05n0qiA=="
+	sampleEncryptedData = "CiyLU1Aw2KjvrjMdj8YKliAjtP4gsMZMQmRzooG2xrDcvSnxIMXFufNstNGTyaGS9uT5geRa0W4oTOb1WT7fJlAC+oNPdbB+3hVbJSRgv+4lGOETKUQz6OYStslQ142dNCuabNPGBzlooOmB231qMM85d2/fV6ChevvXvQP8Hkue1poOFtnEtpyxVLW1zAo6/1Xx1COxFvrc2d7UL/lmHInNlxuacJXwu0fjpXfz/YqYzBIBzD6WUfTIF9GRHpOn/Hz7saL8xz+W//FRAUid1OksQaQx4CMs8LOddcQhULW4ucetDf96JcR3g0gfRK4PC7E/r7Z6xNrXd2UIeorGj5Ef7b1pJAYB6Y5anaHqZ9J6nKEBvB4DnNLIVWSgARns/8wR2SiRS7MNACwTyrGvt9ts8p12PKFdlqYTopNHR1Vf7XjfhQlVsAJdNiKdYmYVoKlaRv85IfVunYzO0IKXsyl7JCUjCpoG20f0a04COwfneQAGGwd5oa+T8yO5hzuyDb/XcxxmK01EpqOyuxINew=="
+)
+
+// sampleTime 示例数据水印中的时间
+var sampleTime = time.Unix(1477314187, 0)
+
+type sampleUserInfo struct {
+	OpenID    string    `json:"openId"`
+	UnionID   string    `json:"unionId"`
+	NickName  string    `json:"nickName"`
+	Watermark Watermark `json:"watermark"`
+}
+
+func TestDecryptData(t *testing.T) {
+	c := &Client{appID: sampleAppID}
+	var info sampleUserInfo
+	if err := c.decryptData(sampleSessionKey, sampleEncryptedData, sampleIV, &info, sampleTime.Add(time.Minute)); err != nil {
+		t.Fatalf("解密失败: %v", err)
+	}
+	if info.OpenID != "oGZUI0egBJY1zhBYw2KhdUfwVJJE" || info.UnionID != "ocMvos6NjeKLIBqg5Mr9QjxrP1FA" || info.NickName != "Band" {
+		t.Errorf("解密结果不正确: %+v", info)
+	}
+	if info.Watermark.AppID != sampleAppID || info.Watermark.Timestamp != sampleTime.Unix() {
+		t.Errorf("水印不正确: %+v", info.Watermark)
+	}
+}
+
+func TestDecryptDataBadKey(t *testing.T) {
+	c := &Client{appID: sampleAppID}
+	tests := []struct {
+		name          string
+		sessionKey    string
+		encryptedData string
+		iv            string
+	}{
+		{"错误的 session_key", "AAAAAAAAAAAAAAAAAAAAAA==", sampleEncryptedData, sampleIV},
+		{"session_key 长度错误", "dGlpaHQ=", sampleEncryptedData, sampleIV},
+		{"iv 长度错误", sampleSessionKey, sampleEncryptedData, "cjdCWA=="},
+		{"密文不是整块", sampleSessionKey, sampleEncryptedData[:20], sampleIV},
+		{"填充错误", sampleSessionKey, encryptBlock(t, sampleSessionKey, sampleIV, bytes.Repeat([]byte{0x11}, aes.BlockSize)), sampleIV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info sampleUserInfo
+			err := c.decryptData(tt.sessionKey, tt.encryptedData, tt.iv, &info, sampleTime)
+			if !errors.Is(err, ErrDecrypt) {
+				t.Errorf("err = %v, 期望 ErrDecrypt", err)
+			}
+		})
+	}
+}
+
+func TestDecryptDataWatermark(t *testing.T) {
+	tests := []struct {
+		name  string
+		appID string
+		now   time.Time
+	}{
+		{"appid 不一致", "wx0000000000000000", sampleTime},
+		{"数据已过期", sampleAppID, sampleTime.Add(dataMaxAge + time.Second)},
+		{"水印时间超前", sampleAppID, sampleTime.Add(-dataClockSkew - time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{appID: tt.appID}
+			var info sampleUserInfo
+			err := c.decryptData(sampleSessionKey, sampleEncryptedData, sampleIV, &info, tt.now)
+			if !errors.Is(err, ErrWatermark) {
+				t.Errorf("err = %v, 期望 ErrWatermark", err)
+			}
+		})
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	rawData := `{"nickName":"Band","gender":1,"language":"zh_CN","city":"Guangzhou","province":"Guangdong","country":"CN"}`
+	signature := "e769b3d4ad3895a1d2edb40eaa1822250a2abfd7"
+
+	if err := CheckSignature(rawData, sampleSessionKey, signature); err != nil {
+		t.Errorf("签名正确时返回错误: %v", err)
+	}
+	if err := CheckSignature(rawData+" ", sampleSessionKey, signature); !errors.Is(err, ErrSignature) {
+		t.Errorf("rawData 被修改时 err = %v, 期望 ErrSignature", err)
+	}
+	if err := CheckSignature(rawData, "AAAAAAAAAAAAAAAAAAAAAA==", signature); !errors.Is(err, ErrSignature) {
+		t.Errorf("session_key 不一致时 err = %v, 期望 ErrSignature", err)
+	}
+}
+
+// encryptBlock 用 AES-128-CBC 加密未填充的明文，用于构造填充错误的密文
+func encryptBlock(t *testing.T, sessionKey, iv string, plain []byte) string {
+	t.Helper()
+	key, _ := base64.StdEncoding.DecodeString(sessionKey)
+	ivBytes, _ := base64.StdEncoding.DecodeString(iv)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, ivBytes).CryptBlocks(out, plain)
+	return base64.StdEncoding.EncodeToString(out)
+}
@@ -0,0 +1,84 @@
+package wechat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 微信接口错误码
+const (
+	codeSystemBusy     = -1    // 系统繁忙，可重试
+	codeInvalidToken   = 40001 // access_token 无效
+	codeInvalidCode    = 40029 // code 无效
+	codeCodeUsed       = 40163 // code 已被使用
+	codeTokenExpired   = 42001 // access_token 已过期
+	codeFrequencyLimit = 45011 // 调用太频繁
+	codeRiskyUser      = 40226 // 高风险用户，登录被拦截
+)
+
+// ErrUnavailable 微信接口无法访问（网络错误、超时或 HTTP 错误），重试后仍失败
+var ErrUnavailable = errors.New("微信服务暂时不可用，请稍后重试")
+
+// Error 微信接口返回的错误（errcode 不为 0）
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("微信接口错误 %d: %s", e.Code, e.Message)
+}
+
+// UserMessage 可以展示给用户的错误提示，配置错误等用户无法处理的错误返回空字符串
+func (e *Error) UserMessage() string {
+	switch e.Code {
+	case codeSystemBusy:
+		return "微信系统繁忙，请稍后重试"
+	case codeInvalidCode, codeCodeUsed:
+		return "登录凭证已失效，请重新进入小程序"
+	case codeFrequencyLimit:
+		return "操作太频繁，请稍后重试"
+	case codeRiskyUser:
+		return "账号存在风险，已被微信拦截"
+	}
+	return ""
+}
+
+// Temporary 是否为临时错误，稍后重试可能成功
+func (e *Error) Temporary() bool {
+	return e.Code == codeSystemBusy || e.Code == codeFrequencyLimit
+}
+
+// Message 错误对应的用户提示，err 不是微信接口错误时返回 fallback
+func Message(err error, fallback string) string {
+	var e *Error
+	if errors.As(err, &e) && e.UserMessage() != "" {
+		return e.UserMessage()
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return ErrUnavailable.Error()
+	}
+	return fallback
+}
+
+// apiError 微信接口响应中的错误字段
+type apiError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e apiError) err() error {
+	if e.ErrCode == 0 {
+		return nil
+	}
+	return &Error{Code: e.ErrCode, Message: e.ErrMsg}
+}
+
+// retryable 是否需要重试：网络错误、超时、HTTP 5xx 和系统繁忙
+func retryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code == codeSystemBusy
+	}
+	return errors.Is(err, ErrUnavailable)
+}